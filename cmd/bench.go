@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"uploader/config"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// benchBlock is the size of the random data repeated through the synthetic
+// file.
+const benchBlock = 1024 * 1024
+
+func init() {
+	register(&Command{
+		Name:        "bench",
+		Description: "Measure the upload speed with different workers and part sizes",
+		Run:         runBench,
+	})
+}
+
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	size := fs.SizeSuffix(256 * fs.Mebi)
+	flags.Var(&size, "size", "Size of the synthetic file uploaded for every configuration")
+	workerList := flags.String("workers", "1,2,4,8", "Comma separated numbers of workers to try")
+	partSizeList := flags.String("part-sizes", "16M,64M,128M", "Comma separated part sizes to try")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader bench [options] [[remote]:/path]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 || size <= 0 {
+		flags.Usage()
+		return errors.New("bench needs a positive size and at most the remote folder to upload to")
+	}
+
+	workers, err := parseWorkerList(*workerList)
+	if err != nil {
+		return err
+	}
+	partSizes, err := parsePartSizes(*partSizeList)
+	if err != nil {
+		return err
+	}
+	remote, remotePath := "", "/"
+	if flags.NArg() == 1 {
+		if remote, remotePath, err = parseRemote(flags.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	// the files go to a folder of their own, deleted at the end
+	benchDir := path.Join(remotePath, ".uploader-bench-"+s.runID)
+	cleanup := s.uploader(profile, 1, 1)
+	if err := cleanup.CreateRemoteDir(benchDir); err != nil {
+		return err
+	}
+	defer func() {
+		if dir, err := cleanup.Stat(benchDir); err == nil {
+			err = cleanup.DeleteFile(dir.Id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Delete %s failed: %v\n", benchDir, err)
+			}
+		}
+	}()
+
+	type result struct {
+		workers  int
+		partSize fs.SizeSuffix
+		elapsed  time.Duration
+		err      error
+	}
+	var results []result
+	stopProgress := s.progress.StartProgress()
+	for _, partSize := range partSizes {
+		parts := (int64(size) + int64(partSize) - 1) / int64(partSize)
+		for i, n := range workers {
+			// more workers than parts send as fast as one per part
+			if i > 0 && int64(n) > parts {
+				continue
+			}
+			trial := *profile
+			trial.PartSize, trial.Workers = partSize, n
+			uploader := s.uploader(&trial, n, 1)
+			src := newBenchSource(fmt.Sprintf("bench-%dw-%s.bin", n, partSize), int64(size))
+
+			s.progress.AddTransfer(1, src.Size())
+			start := time.Now()
+			err := uploader.UploadSource(src, benchDir)
+			results = append(results, result{n, partSize, time.Since(start), err})
+			if file, err := uploader.Stat(path.Join(benchDir, src.Name())); err == nil {
+				uploader.DeleteFile(file.Id)
+			}
+			// the trials would keep their stall watch running otherwise
+			uploader.Close()
+		}
+	}
+	stopProgress()
+
+	fmt.Printf("%7s %10s %9s %12s\n", "workers", "part size", "time", "speed")
+	var fastest *result
+	for i, r := range results {
+		if r.err != nil {
+			fmt.Printf("%7d %10s  failed: %v\n", r.workers, r.partSize, r.err)
+			continue
+		}
+		fmt.Printf("%7d %10s %9s %10s/s\n", r.workers, r.partSize, r.elapsed.Round(100*time.Millisecond), benchSpeed(size, r.elapsed))
+		if fastest == nil || r.elapsed < fastest.elapsed {
+			fastest = &results[i]
+		}
+	}
+	if fastest == nil {
+		return errors.New("every upload failed")
+	}
+	fmt.Printf("\nFastest: WORKERS=%d PART_SIZE=%s at %s/s\n", fastest.workers, fastest.partSize, benchSpeed(size, fastest.elapsed))
+	return nil
+}
+
+// benchSpeed returns the bytes per second of size bytes sent in elapsed.
+func benchSpeed(size fs.SizeSuffix, elapsed time.Duration) fs.SizeSuffix {
+	return fs.SizeSuffix(float64(size) / elapsed.Seconds())
+}
+
+func parseWorkerList(list string) ([]int, error) {
+	var workers []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of workers %q", field)
+		}
+		workers = append(workers, n)
+	}
+	return workers, nil
+}
+
+func parsePartSizes(list string) ([]fs.SizeSuffix, error) {
+	var partSizes []fs.SizeSuffix
+	for _, field := range strings.Split(list, ",") {
+		var partSize fs.SizeSuffix
+		if err := partSize.Set(strings.TrimSpace(field)); err != nil || partSize <= 0 {
+			return nil, fmt.Errorf("invalid part size %q", field)
+		}
+		if partSize > maxPartSize {
+			return nil, fmt.Errorf("part size %s is bigger than the 2000Mi Telegram accepts", partSize)
+		}
+		partSizes = append(partSizes, partSize)
+	}
+	return partSizes, nil
+}
+
+// benchSource is a synthetic file of random data, which doesn't compress.
+type benchSource struct {
+	name  string
+	size  int64
+	block []byte
+}
+
+func newBenchSource(name string, size int64) *benchSource {
+	block := make([]byte, benchBlock)
+	rand.Read(block)
+	return &benchSource{name: name, size: size, block: block}
+}
+
+func (s *benchSource) Name() string       { return s.name }
+func (s *benchSource) Size() int64        { return s.size }
+func (s *benchSource) ModTime() time.Time { return time.Time{} }
+func (s *benchSource) String() string     { return "bench:" + s.name }
+
+func (s *benchSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	length = min(length, s.size-offset)
+	return io.NopCloser(io.LimitReader(&benchReader{block: s.block, offset: offset}, length)), nil
+}
+
+// benchReader repeats block endlessly from offset.
+type benchReader struct {
+	block  []byte
+	offset int64
+}
+
+func (r *benchReader) Read(p []byte) (int, error) {
+	n := copy(p, r.block[r.offset%int64(len(r.block)):])
+	r.offset += int64(n)
+	return n, nil
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"uploader/config"
+	"uploader/pkg/services"
+)
+
+func init() {
+	register(&Command{
+		Name:        "bisync",
+		Description: "Synchronise a local folder and a remote folder in both directions",
+		Run:         runBisync,
+	})
+}
+
+func runBisync(args []string) error {
+	flags := flag.NewFlagSet("bisync", flag.ExitOnError)
+	resync := flags.Bool("resync", false, "Start over: copy the files only on one side to the other and store the result as the baseline")
+	dryRun := flags.Bool("dry-run", false, "Only show what would be copied or deleted")
+	transfers := flags.Int("transfers", 0, "Number of files to copy simultaneously, 0 for TRANSFERS")
+	yes := flags.Bool("yes", false, "Don't ask before deleting files")
+	maxDelete := flags.Int("max-delete", 50, "Abort when a run would delete more than this percentage of the files of a side, 0 for no limit")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader bisync [options] localdir [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("bisync needs the local and the remote folder")
+	}
+	if info, err := os.Stat(flags.Arg(0)); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", flags.Arg(0))
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	if *transfers == 0 {
+		*transfers = s.cfg.Transfers
+	}
+	uploader := s.uploader(profile, 0, *transfers)
+
+	opts := services.BisyncOptions{
+		Server:    profile.ApiURL,
+		Resync:    *resync,
+		DryRun:    *dryRun,
+		Transfers: *transfers,
+		MaxDelete: *maxDelete,
+	}
+	stopProgress := func() {}
+	if !*dryRun && !*yes && !s.cfg.AssumeYes {
+		// the deletions are only known after comparing both sides, the
+		// progress is shown once they are confirmed
+		opts.Confirm = func(plan *services.BisyncResult) error {
+			var summary []string
+			for _, p := range plan.DeletedLocal {
+				summary = append(summary, "delete local "+p)
+			}
+			for _, p := range plan.DeletedRemote {
+				summary = append(summary, "delete remote "+p)
+			}
+			if err := Confirm(summary, false); err != nil {
+				return err
+			}
+			stopProgress = s.progress.StartProgress()
+			return nil
+		}
+	} else {
+		stopProgress = s.progress.StartProgress()
+	}
+
+	result, err := uploader.Bisync(flags.Arg(0), remotePath, opts)
+	s.progress.Wait()
+	stopProgress()
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if *dryRun {
+		prefix = "would "
+	}
+	printPaths := func(verb string, paths []string) {
+		for _, p := range paths {
+			fmt.Printf("%s%s %s\n", prefix, verb, p)
+		}
+	}
+	printPaths("upload", result.Uploaded)
+	printPaths("download", result.Downloaded)
+	printPaths("delete local", result.DeletedLocal)
+	printPaths("delete remote", result.DeletedRemote)
+	for _, p := range result.Conflicts {
+		fmt.Printf("conflict %s\n", p)
+	}
+	for _, p := range result.Changed {
+		fmt.Printf("changed %s\n", p)
+	}
+
+	if result.Failed > 0 {
+		return fmt.Errorf("%d files failed to sync", result.Failed)
+	}
+	if len(result.Conflicts) > 0 {
+		return fmt.Errorf("%d files changed on both sides, resolve them and run bisync again", len(result.Conflicts))
+	}
+	if len(result.Changed) > 0 {
+		return fmt.Errorf("%d files changed while syncing, run bisync again", len(result.Changed))
+	}
+	s.log.Info("bisync complete!")
+	return nil
+}
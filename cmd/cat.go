@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"uploader/config"
+)
+
+func init() {
+	register(&Command{
+		Name:        "cat",
+		Description: "Write a remote file to stdout",
+		Run:         runCat,
+	})
+}
+
+func runCat(args []string) error {
+	flags := flag.NewFlagSet("cat", flag.ExitOnError)
+	offset := flags.Int64("offset", 0, "Start at this byte of the file")
+	count := flags.Int64("count", -1, "Only write this many bytes, -1 for up to the end")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader cat [options] [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("cat needs the remote file")
+	}
+	if *offset < 0 {
+		return errors.New("-offset can't be negative")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(os.Stdout, 1024*1024)
+	if err := s.uploader(profile, 0, 0).Cat(remotePath, w, *offset, *count); err != nil {
+		w.Flush()
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,45 @@
+// Package cmd implements the uploader subcommands.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Command is a subcommand of the uploader, invoked as `uploader <name> [args]`.
+type Command struct {
+	Name        string
+	Description string
+	Run         func(args []string) error
+}
+
+var commands = map[string]*Command{}
+
+func register(c *Command) {
+	run := c.Run
+	c.Run = func(args []string) error {
+		return finish(run(args))
+	}
+	commands[c.Name] = c
+}
+
+// Lookup returns the command with the given name.
+func Lookup(name string) (*Command, bool) {
+	c, ok := commands[name]
+	return c, ok
+}
+
+// PrintCommands writes the list of available commands to w.
+func PrintCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].Description)
+	}
+}
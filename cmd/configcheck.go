@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"uploader/config"
+	"uploader/pkg/i18n"
+	"uploader/pkg/pb"
+	"uploader/pkg/services"
+	"uploader/pkg/state"
+	"uploader/pkg/transport"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// maxPartSize is the biggest file Telegram accepts from accounts without
+// premium, so the biggest part Teldrive can store.
+const maxPartSize = 2000 * fs.Mebi
+
+func init() {
+	register(&Command{
+		Name:        "config",
+		Description: "Create the configuration, or check it and the connection to the server",
+		Run:         runConfig,
+	})
+}
+
+func runConfig(args []string) error {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader config init")
+		fmt.Fprintln(os.Stderr, "       uploader config check [remote]")
+	}
+	flags.Parse(args)
+	switch {
+	case flags.NArg() == 1 && flags.Arg(0) == "init":
+		return runConfigInit()
+	case flags.NArg() == 0 || flags.NArg() > 2 || flags.Arg(0) != "check":
+		flags.Usage()
+		return errors.New("config needs init, or check and at most the remote to check")
+	}
+	remote := strings.TrimSuffix(flags.Arg(1), ":")
+
+	c := &configCheck{}
+	if err := config.LoadConfig(); err != nil {
+		c.fail("configuration can't be read: %v", err)
+		return c.result()
+	}
+	cfg := config.GetConfig()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		c.fail("%v", err)
+		return c.result()
+	}
+	c.checkSettings(cfg, profile)
+	if c.errors > 0 {
+		// the server is only asked with a valid configuration
+		return c.result()
+	}
+
+	channelMap := ""
+	if remote == "" {
+		channelMap = cfg.ChannelMap
+	}
+	c.checkServer(newSession().uploader(profile, 0, 0), profile.ApiURL, profile.ChannelID, channelMap)
+	return c.result()
+}
+
+// configCheck prints the outcome of every check, counting the failed ones.
+// A quiet check only prints the problems.
+type configCheck struct {
+	errors int
+	quiet  bool
+	out    io.Writer
+}
+
+// printf prints the translated message after its outcome, e.g. warning.
+func (c *configCheck) printf(outcome, format string, args ...interface{}) {
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "%-9s%s\n", i18n.T(outcome), i18n.Sprintf(format, args...))
+}
+
+func (c *configCheck) ok(format string, args ...interface{}) {
+	if !c.quiet {
+		c.printf("ok", format, args...)
+	}
+}
+
+func (c *configCheck) warn(format string, args ...interface{}) {
+	c.printf("warning", format, args...)
+}
+
+func (c *configCheck) fail(format string, args ...interface{}) {
+	c.errors++
+	c.printf("error", format, args...)
+}
+
+func (c *configCheck) result() error {
+	if c.errors > 0 {
+		return errors.New(i18n.Sprintf("%d problems found in the configuration", c.errors))
+	}
+	return nil
+}
+
+// checkServer checks that the server at apiURL accepts the session token of
+// uploader, then that channelID, unless 0, and the channels of channelMap
+// are channels of the user. It returns false when the server can't be
+// listed.
+func (c *configCheck) checkServer(uploader *services.UploadService, apiURL string, channelID int64, channelMap string) bool {
+	if _, err := uploader.List("/"); err != nil {
+		c.fail("server %s can't be listed, check API_URL and SESSION_TOKEN, which expires with the Teldrive session: %v", apiURL, err)
+		return false
+	}
+	c.ok("server %s accepts the session token", apiURL)
+
+	channels, err := uploader.Channels()
+	if err != nil {
+		c.warn("channels can't be listed to check them: %v", err)
+		return true
+	}
+	known := map[int64]bool{}
+	for _, channel := range channels {
+		known[channel.ChannelID] = true
+	}
+	checkChannel := func(name string, id int64) {
+		if known[id] {
+			c.ok("%s %d is a channel of the user", name, id)
+		} else {
+			c.fail("%s %d isn't a channel of the user, pick one of the channels shown in the Teldrive settings", name, id)
+		}
+	}
+	if channelID == 0 {
+		c.ok("CHANNEL_ID is unset, the default channel set in the Teldrive settings is used")
+	} else {
+		checkChannel("CHANNEL_ID", channelID)
+	}
+	if channelMap != "" {
+		rules, _ := services.ParseChannelMap(channelMap)
+		for _, rule := range rules {
+			checkChannel("CHANNEL_MAP channel of "+rule.Prefix, rule.ChannelID)
+		}
+	}
+	return true
+}
+
+// checkSettings checks the values of the configuration without the
+// server.
+func (c *configCheck) checkSettings(cfg *config.Config, profile *config.Profile) {
+	partSize := cfg.PartSize
+	if profile.PartSize != 0 {
+		partSize = profile.PartSize
+	}
+	switch {
+	case partSize > maxPartSize:
+		c.fail("PART_SIZE %s is bigger than the 2000Mi Telegram accepts, lower it", partSize)
+	case partSize < 5*fs.Mebi:
+		c.warn("PART_SIZE %s is small, files are split in many parts and upload slowly", partSize)
+	default:
+		c.ok("PART_SIZE %s", partSize)
+	}
+
+	workers, transfers := cfg.Workers, cfg.Transfers
+	if profile.Workers != 0 {
+		workers = profile.Workers
+	}
+	if profile.Transfers != 0 {
+		transfers = profile.Transfers
+	}
+	switch {
+	case workers < 1 || transfers < 1:
+		c.fail("WORKERS %d and TRANSFERS %d must be at least 1", workers, transfers)
+	case workers*transfers > 64:
+		c.warn("WORKERS %d times TRANSFERS %d sends %d parts at once, Telegram may rate limit the uploads", workers, transfers, workers*transfers)
+	default:
+		c.ok("WORKERS %d, TRANSFERS %d", workers, transfers)
+	}
+	if cfg.SpinnerType < 0 || cfg.SpinnerType > pb.MaxSpinnerType {
+		c.fail("SPINNER_TYPE must be 0..%d", pb.MaxSpinnerType)
+	}
+	if cfg.ListPageSize < 1 || cfg.ListConcurrency < 1 {
+		c.fail("LIST_PAGE_SIZE %d and LIST_CONCURRENCY %d must be at least 1", cfg.ListPageSize, cfg.ListConcurrency)
+	}
+
+	choices := []struct {
+		name, value, allowed string
+		valid                func(string) bool
+	}{
+		{"FAIR_SHARE", cfg.FairShare, "equal or small-first", services.ValidFairShare},
+		{"FLATTEN", cfg.Flatten, "suffix or prefix", services.ValidFlattenPolicy},
+		{"COMPRESS", cfg.Compress, "zstd or gzip", services.ValidCompression},
+		{"SPARSE", cfg.Sparse, "warn or pack", services.ValidSparse},
+		{"API_COMPAT", cfg.APICompat, "auto, v1.5, v1 or legacy", services.ValidCompat},
+		{"HTTP_VERSION", cfg.HTTPVersion, "1.1 or 2", transport.ValidHTTPVersion},
+		{"STALL_ACTION", cfg.StallAction, "retry or abort", services.ValidStallAction},
+		{"OVERSIZE", cfg.Oversize, "fail or split", services.ValidOversizeAction},
+		{"HASH", cfg.Hash, "md5, sha256, blake3 or xxh3", services.ValidHashAlgorithm},
+		{"UI_LANGUAGE", cfg.UILanguage, "auto, en or es", i18n.Valid},
+		{"LOCK", cfg.Lock, "dest or global", func(lock string) bool { return lock == state.LockDest || lock == state.LockGlobal }},
+	}
+	for _, choice := range choices {
+		if choice.value != "" && !choice.valid(choice.value) {
+			c.fail("%s %q is unknown, use %s", choice.name, choice.value, i18n.T(choice.allowed))
+		}
+	}
+	if cfg.ChannelMap != "" {
+		if _, err := services.ParseChannelMap(cfg.ChannelMap); err != nil {
+			c.fail("CHANNEL_MAP: %v", err)
+		}
+	}
+	if cfg.TransferWindow != "" {
+		if _, err := services.ParseTransferWindow(cfg.TransferWindow); err != nil {
+			c.fail("TRANSFER_WINDOW: %v", err)
+		}
+	}
+	if cfg.PartNameTemplate != "" {
+		if _, err := services.ParsePartNameTemplate(cfg.PartNameTemplate); err != nil {
+			c.fail("PART_NAME_TEMPLATE: %v", err)
+		}
+	}
+}
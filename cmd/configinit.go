@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"uploader/config"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/term"
+)
+
+// runConfigInit asks for the settings of the default server, checks them
+// against it and writes them to upload.env.
+func runConfigInit() error {
+	stdin := bufio.NewReader(os.Stdin)
+	if _, err := os.Stat(config.File); err == nil {
+		if !askYesNo(stdin, config.File+" exists, replace it?", false) {
+			return errors.New(config.File + " kept as it is")
+		}
+	}
+
+	s := newSession()
+	var profile *config.Profile
+	for {
+		apiURL := ask(stdin, "Teldrive URL", "http://localhost:8080")
+		token, err := askSecret(stdin, "Session token, the user-session cookie of the Teldrive app")
+		if err != nil {
+			return err
+		}
+		profile = &config.Profile{ApiURL: strings.TrimSuffix(apiURL, "/"), SessionToken: token}
+		if _, err := s.uploader(profile, 0, 0).List("/"); err != nil {
+			fmt.Fprintf(os.Stderr, "The server doesn't accept these: %v\n", err)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "Connected.")
+		break
+	}
+
+	uploader := s.uploader(profile, 0, 0)
+	channels, err := uploader.Channels()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "The channels can't be listed: %v\n", err)
+	}
+	for i, channel := range channels {
+		fmt.Fprintf(os.Stderr, "  %d) %s (%d)\n", i+1, channel.ChannelName, channel.ChannelID)
+	}
+	for {
+		answer := ask(stdin, "Channel, by number or ID, empty for the default of the Teldrive settings", "")
+		if answer == "" {
+			break
+		}
+		n, err := strconv.ParseInt(answer, 10, 64)
+		switch {
+		case err != nil:
+			fmt.Fprintln(os.Stderr, "Enter a number")
+			continue
+		case n >= 1 && int(n) <= len(channels):
+			profile.ChannelID = channels[n-1].ChannelID
+		default:
+			profile.ChannelID = n
+		}
+		break
+	}
+
+	var partSize fs.SizeSuffix
+	for {
+		if err := partSize.Set(ask(stdin, "Part size", "1000M")); err != nil || partSize <= 0 || partSize > maxPartSize {
+			fmt.Fprintln(os.Stderr, "Enter a size up to 2000M, e.g. 500M")
+			continue
+		}
+		break
+	}
+	workers := askInt(stdin, "Parts uploaded at once for every file", 4)
+	transfers := askInt(stdin, "Files uploaded at once", 4)
+	encrypt := askYesNo(stdin, "Encrypt the files?", false)
+
+	lines := []string{
+		fmt.Sprintf("API_URL=%q", profile.ApiURL),
+		fmt.Sprintf("SESSION_TOKEN=%q", profile.SessionToken),
+		fmt.Sprintf("CHANNEL_ID=%d", profile.ChannelID),
+		fmt.Sprintf("PART_SIZE=%s", partSize),
+		fmt.Sprintf("WORKERS=%d", workers),
+		fmt.Sprintf("TRANSFERS=%d", transfers),
+		fmt.Sprintf("ENCRYPT_FILES=%t", encrypt),
+	}
+	// the file holds the session token
+	if err := os.WriteFile(config.File, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s, check it any time with: uploader config check\n", config.File)
+	return nil
+}
+
+// ask prompts for a value, returning def for an empty answer.
+func ask(stdin *bufio.Reader, prompt string, def string) string {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	}
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+// askSecret prompts for a value without echoing it on a terminal.
+func askSecret(stdin *bufio.Reader, prompt string) (string, error) {
+	for {
+		var answer string
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Fprintf(os.Stderr, "%s: ", prompt)
+			secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return "", err
+			}
+			answer = string(secret)
+		} else {
+			answer = ask(stdin, prompt, "")
+		}
+		if answer = strings.TrimSpace(answer); answer != "" {
+			return answer, nil
+		}
+		if _, err := stdin.Peek(1); err != nil && !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("no session token given")
+		}
+	}
+}
+
+func askInt(stdin *bufio.Reader, prompt string, def int) int {
+	for {
+		n, err := strconv.Atoi(ask(stdin, prompt, strconv.Itoa(def)))
+		if err == nil && n >= 1 {
+			return n
+		}
+		fmt.Fprintln(os.Stderr, "Enter a number of at least 1")
+	}
+}
+
+func askYesNo(stdin *bufio.Reader, prompt string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	fmt.Fprintf(os.Stderr, "%s [%s] ", prompt, hint)
+	answer, _ := stdin.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
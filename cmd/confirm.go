@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNotConfirmed is returned by Confirm when the user doesn't go on.
+var ErrNotConfirmed = errors.New("not confirmed, pass -yes to go on without asking")
+
+// Confirm prints what a run about to remove data will do and asks whether
+// to go on, unless yes is set. Without a terminal to ask on it doesn't go
+// on, so unattended runs need yes.
+func Confirm(summary []string, yes bool) error {
+	if yes || len(summary) == 0 {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "This will:")
+	for _, line := range summary {
+		fmt.Fprintf(os.Stderr, "  - %s\n", line)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return ErrNotConfirmed
+	}
+	fmt.Fprint(os.Stderr, "Continue? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return ErrNotConfirmed
+}
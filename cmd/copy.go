@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"uploader/config"
+	"uploader/pkg/services"
+	"uploader/pkg/state"
+)
+
+func init() {
+	register(&Command{
+		Name:        "copy",
+		Description: "Copy files from one Teldrive server to another",
+		Run:         runCopy,
+	})
+}
+
+// parseRemote splits a remote:/path argument. An empty remote name is the
+// default server of upload.env.
+func parseRemote(arg string) (remote, remotePath string, err error) {
+	remote, remotePath, ok := strings.Cut(arg, ":")
+	if !ok || !strings.HasPrefix(remotePath, "/") {
+		return "", "", fmt.Errorf("invalid remote path %q, must be remote:/path", arg)
+	}
+	return remote, remotePath, nil
+}
+
+func runCopy(args []string) error {
+	flags := flag.NewFlagSet("copy", flag.ExitOnError)
+	workers := flags.Int("workers", 0, "Number of current workers to use when uploading multi-parts")
+	transfers := flags.Int("transfers", 0, "Number of current files to copy at once")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader copy [options] remote1:/path remote2:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("copy needs a source and a destination")
+	}
+
+	srcRemote, srcPath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	dstRemote, dstPath, err := parseRemote(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	s := newSession()
+
+	srcProfile, err := config.GetProfile(srcRemote)
+	if err != nil {
+		return err
+	}
+	dstProfile, err := config.GetProfile(dstRemote)
+	if err != nil {
+		return err
+	}
+
+	source := s.uploader(srcProfile, *workers, *transfers)
+	uploader := s.uploader(dstProfile, *workers, *transfers, services.WithHistory(state.NewHistory(s.runID)))
+
+	if err := uploader.CreateRemoteDir(dstPath); err != nil {
+		return err
+	}
+
+	stopProgress := s.progress.StartProgress()
+	err = uploader.CopyFrom(source, srcRemote, srcPath, dstPath)
+	s.progress.Wait()
+	stopProgress()
+	if err != nil {
+		return err
+	}
+
+	if status := s.progress.Status(); status.Failed > 0 {
+		return fmt.Errorf("%d files failed to copy", status.Failed)
+	}
+	s.log.Info("copy complete!")
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"uploader/config"
+	"uploader/pkg/state"
+)
+
+func init() {
+	register(&Command{
+		Name:        "dedup-backup",
+		Description: "Back up a directory uploading only the chunks not stored yet",
+		Run:         runDedupBackup,
+	})
+}
+
+func runDedupBackup(args []string) error {
+	flags := flag.NewFlagSet("dedup-backup", flag.ExitOnError)
+	sourcePath := flags.String("path", "", "Directory to back up")
+	repo := flags.String("dest", "", "Remote directory of the backup repository")
+	transfers := flags.Int("transfers", 0, "Number of chunks to upload at once")
+	flags.Parse(args)
+	if *sourcePath == "" || *repo == "" {
+		flags.Usage()
+		return errors.New("dedup-backup needs -path and -dest")
+	}
+	if info, err := os.Stat(*sourcePath); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", *sourcePath)
+	}
+
+	s := newSession()
+	profile, err := config.GetProfile("")
+	if err != nil {
+		return err
+	}
+	repoDir := path.Clean("/" + *repo)
+	index, err := state.LoadChunkIndex(profile.ApiURL + repoDir)
+	if err != nil {
+		return err
+	}
+
+	uploader := s.uploader(profile, 0, *transfers)
+	if err := uploader.CreateRemoteDir(repoDir); err != nil {
+		return err
+	}
+
+	stopProgress := s.progress.StartProgress()
+	snapshot, err := uploader.DedupBackup(*sourcePath, repoDir, index)
+	s.progress.Wait()
+	stopProgress()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot of %d files saved, %d chunks stored in the repository\n", len(snapshot.Files), index.Len())
+	return nil
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"uploader/config"
+	"uploader/pkg/services"
+	"uploader/pkg/state"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Policies of the dedupe command.
+const (
+	dedupeList        = "list"
+	dedupeNewest      = "newest"
+	dedupeOldest      = "oldest"
+	dedupeRename      = "rename"
+	dedupeInteractive = "interactive"
+)
+
+func init() {
+	register(&Command{
+		Name:        "dedupe",
+		Description: "Find duplicate files on the remote and delete or rename them",
+		Run:         runDedupe,
+	})
+}
+
+func runDedupe(args []string) error {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	byHash := flags.Bool("hash", false, "Find files with the same content hash recorded by -checksum uploads, whatever their names")
+	policy := flags.String("policy", dedupeList, "What to do with duplicates: list, newest or oldest to keep only that file, rename to number the others, or interactive")
+	dryRun := flags.Bool("dry-run", false, "Only show what would be deleted or renamed")
+	yes := flags.Bool("yes", false, "Don't ask before deleting duplicates")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader dedupe [options] [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("dedupe needs the remote path to scan")
+	}
+	switch *policy {
+	case dedupeList, dedupeNewest, dedupeOldest, dedupeRename, dedupeInteractive:
+	default:
+		return fmt.Errorf("unknown policy %q, use list, newest, oldest, rename or interactive", *policy)
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	uploader := s.uploader(profile, 0, 0)
+
+	var hashes *state.HashIndex
+	if *byHash {
+		if hashes, err = state.LoadHashIndex(profile.ApiURL); err != nil {
+			return err
+		}
+	}
+
+	groups, err := uploader.FindDuplicates(remotePath, hashes)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Println("No duplicates found")
+		return nil
+	}
+
+	if !*dryRun && (*policy == dedupeNewest || *policy == dedupeOldest) {
+		deletes := 0
+		for _, group := range groups {
+			deletes += len(group.Files) - 1
+		}
+		summary := []string{fmt.Sprintf("delete %d duplicate files of %d groups below %s, keeping the %s of each", deletes, len(groups), remotePath, *policy)}
+		if err := Confirm(summary, *yes || s.cfg.AssumeYes); err != nil {
+			return err
+		}
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	for _, group := range groups {
+		printGroup(group)
+		action := *policy
+		keep := -1
+		switch action {
+		case dedupeNewest:
+			keep = len(group.Files) - 1
+		case dedupeOldest:
+			keep = 0
+		case dedupeInteractive:
+			action, keep = askDedupe(stdin, len(group.Files))
+		}
+
+		switch {
+		case keep >= 0:
+			for i, file := range group.Files {
+				if i == keep {
+					continue
+				}
+				fmt.Printf("  delete %s\n", path.Join(group.Dir, file.Name))
+				if *dryRun {
+					continue
+				}
+				if err := uploader.DeleteFile(file.Id); err != nil {
+					return err
+				}
+			}
+		case action == dedupeRename:
+			if err := renameDuplicates(uploader, group, *dryRun); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func printGroup(group services.DuplicateGroup) {
+	fmt.Printf("%s: %d duplicates of %s\n", group.Dir, len(group.Files), group.Files[0].Name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, file := range group.Files {
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%s\n", i+1, file.Name, fs.SizeSuffix(file.Size), file.ModTime, file.Id)
+	}
+	w.Flush()
+}
+
+// askDedupe asks what to do with a group of n duplicates, returning the
+// action and the index of the file to keep, -1 for none.
+func askDedupe(stdin *bufio.Reader, n int) (string, int) {
+	for {
+		fmt.Printf("Keep which file (1-%d), r to rename the others, s to skip? ", n)
+		answer, err := stdin.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		switch {
+		case answer == "r":
+			return dedupeRename, -1
+		case answer == "s" || err != nil:
+			return dedupeList, -1
+		}
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= n {
+			return dedupeInteractive, i - 1
+		}
+	}
+}
+
+// renameDuplicates numbers all the files of a group with the same name but
+// the oldest, like "file (1).txt", skipping the names already taken.
+func renameDuplicates(uploader *services.UploadService, group services.DuplicateGroup, dryRun bool) error {
+	taken := map[string]bool{}
+	for _, file := range group.Files {
+		taken[file.Name] = true
+	}
+	seen := map[string]bool{}
+	for _, file := range group.Files {
+		if !seen[file.Name] {
+			seen[file.Name] = true
+			continue
+		}
+		name := nextFreeName(file, taken)
+		taken[name] = true
+		fmt.Printf("  rename %s to %s\n", path.Join(group.Dir, file.Name), name)
+		if dryRun {
+			continue
+		}
+		if err := uploader.RenameFile(file.Id, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nextFreeName(file types.FileInfo, taken map[string]bool) string {
+	ext := path.Ext(file.Name)
+	base := strings.TrimSuffix(file.Name, ext)
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !taken[name] {
+			return name
+		}
+	}
+}
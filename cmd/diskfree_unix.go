@@ -0,0 +1,14 @@
+//go:build !windows
+
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the bytes free for the user on the disk of dir.
+func freeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
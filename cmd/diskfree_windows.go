@@ -0,0 +1,18 @@
+//go:build windows
+
+package cmd
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes free for the user on the disk of dir.
+func freeSpace(dir string) (int64, error) {
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &free, &total, &totalFree); err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"uploader/config"
+	"uploader/pkg/services"
+
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	register(&Command{
+		Name:        "du",
+		Description: "Show the size of every remote directory",
+		Run:         runDu,
+	})
+}
+
+func runDu(args []string) error {
+	flags := flag.NewFlagSet("du", flag.ExitOnError)
+	depth := flags.Int("depth", 1, "Show directories down to this depth below the path, -1 for all")
+	concurrency := flags.Int("concurrency", 0, "Number of directories to list at once, 0 for LIST_CONCURRENCY")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader du [options] [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("du needs the remote path")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+
+	usage, err := s.uploader(profile, 0, 0).DiskUsage(remotePath, *concurrency)
+	if err != nil {
+		return err
+	}
+	printUsage(usage, 0, *depth)
+	return nil
+}
+
+func printUsage(d *services.DirUsage, level, depth int) {
+	fmt.Printf("%10s %8d files  %s%s\n", fs.SizeSuffix(d.Size), d.Files, strings.Repeat("  ", level), d.Path)
+	if depth >= 0 && level >= depth {
+		return
+	}
+	for _, sub := range d.Dirs {
+		printUsage(sub, level+1, depth)
+	}
+}
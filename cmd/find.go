@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"text/tabwriter"
+	"uploader/config"
+	"uploader/pkg/services"
+
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	register(&Command{
+		Name:        "find",
+		Description: "Find files on the remote by name or regular expression",
+		Run:         runFind,
+	})
+	register(&Command{
+		Name:        "search",
+		Description: "Same as find",
+		Run:         runFind,
+	})
+}
+
+func runFind(args []string) error {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	name := flags.String("name", "", "Exact name of the files to find")
+	pattern := flags.String("regex", "", "Regular expression matching part of the names")
+	recursive := flags.Bool("r", false, "Search the folders below the path too")
+	concurrency := flags.Int("concurrency", 0, "Number of folders to list at once with -r, 0 for LIST_CONCURRENCY")
+	asJSON := flags.Bool("json", false, "Print the files as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader find [options] [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("find needs the remote path to search")
+	}
+	if *name == "" && *pattern == "" {
+		return errors.New("find needs -name or -regex")
+	}
+	opts := services.SearchOptions{Name: *name, Recursive: *recursive, Concurrency: *concurrency}
+	if *pattern != "" {
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			return fmt.Errorf("invalid -regex: %w", err)
+		}
+		opts.Pattern = re
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+
+	found, err := s.uploader(profile, 0, 0).Search(remotePath, opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if found == nil {
+			found = []services.Match{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(found)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range found {
+		size := fs.SizeSuffix(f.Size).String()
+		if f.Type == "folder" {
+			size = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", size, f.ModTime, f.Path)
+	}
+	return w.Flush()
+}
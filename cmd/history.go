@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"uploader/pkg/state"
+
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	register(&Command{
+		Name:        "history",
+		Description: "Show the transfers recorded by previous runs",
+		Run:         runHistory,
+	})
+}
+
+func runHistory(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	since := flags.Duration("since", 0, "Only show transfers newer than this, e.g. 24h")
+	result := flags.String("result", "", "Only show transfers with this result: uploaded, skipped or failed")
+	match := flags.String("match", "", "Only show transfers whose path or destination contains this text")
+	runID := flags.String("run", "", "Only show transfers of this run ID")
+	limit := flags.Int("limit", 0, "Only show the last N matching transfers")
+	format := flags.String("format", "table", "Output format: table, json or csv")
+	flags.Parse(args)
+
+	cutoff := time.Time{}
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+
+	transfers, err := state.ReadHistory(func(t state.Transfer) bool {
+		if t.Time.Before(cutoff) {
+			return false
+		}
+		if *result != "" && t.Result != *result {
+			return false
+		}
+		if *runID != "" && t.RunID != *runID {
+			return false
+		}
+		if *match != "" && !strings.Contains(t.Path, *match) && !strings.Contains(t.Dest, *match) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(transfers) > *limit {
+		transfers = transfers[len(transfers)-*limit:]
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(transfers)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"time", "runId", "path", "dest", "size", "duration", "speed", "result", "error"})
+		for _, t := range transfers {
+			w.Write([]string{
+				t.Time.Format(time.RFC3339),
+				t.RunID,
+				t.Path,
+				t.Dest,
+				strconv.FormatInt(t.Size, 10),
+				strconv.FormatFloat(t.Duration, 'f', 3, 64),
+				strconv.FormatFloat(t.Speed, 'f', 0, 64),
+				t.Result,
+				t.Error,
+			})
+		}
+		w.Flush()
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tRESULT\tSIZE\tDURATION\tSPEED\tPATH\tDEST")
+		for _, t := range transfers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.Time.Local().Format("2006-01-02 15:04:05"),
+				t.Result,
+				fs.SizeSuffix(t.Size).ByteUnit(),
+				(time.Duration(t.Duration * float64(time.Second))).Round(time.Second),
+				fs.SizeSuffix(int64(t.Speed)).ByteRateUnit(),
+				t.Path,
+				t.Dest,
+			)
+		}
+		return w.Flush()
+	default:
+		return errors.New("unknown format " + strconv.Quote(*format))
+	}
+}
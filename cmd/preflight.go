@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"uploader/config"
+	"uploader/pkg/i18n"
+	"uploader/pkg/services"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Preflight checks an upload run before it sends any data, so the
+// misconfigurations are reported all at once instead of failing the run
+// halfway: the settings first, then the server, the destination and the
+// local space the run needs. Only the problems are printed, to stderr.
+type Preflight struct {
+	check configCheck
+}
+
+// NewPreflight returns a preflight check without problems.
+func NewPreflight() *Preflight {
+	return &Preflight{check: configCheck{quiet: true, out: os.Stderr}}
+}
+
+// Settings checks the values of cfg, with the flags of the run applied,
+// and that the local files written by the run can be created. The server
+// is only worth asking when it returns nil.
+func (p *Preflight) Settings(cfg *config.Config) error {
+	p.check.checkSettings(cfg, &config.Profile{})
+	outputs := []struct{ name, file string }{
+		{"STATUS_FILE", cfg.StatusFile},
+		{"EVENTS_FILE", cfg.EventsFile},
+		{"MANIFEST", cfg.Manifest},
+	}
+	for _, output := range outputs {
+		if output.file == "" || services.IsURL(output.file) {
+			continue
+		}
+		dir := filepath.Dir(output.file)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			p.check.fail("%s %s can't be written, the folder %s doesn't exist", output.name, output.file, dir)
+		}
+	}
+	return p.Result()
+}
+
+// Server checks that the server accepts the session token, that the
+// channels uploaded to are channels of the user and, unless dest is empty,
+// that the folder dest exists or, unless mustExist, can be created.
+func (p *Preflight) Server(uploader *services.UploadService, cfg *config.Config, dest string, mustExist bool) {
+	if !p.check.checkServer(uploader, cfg.ApiURL, cfg.ChannelID, cfg.ChannelMap) || dest == "" {
+		return
+	}
+
+	// the folders are looked up from the top, the first missing one and
+	// the ones below it are created by the run
+	dest = path.Clean("/" + dest)
+	dir := "/"
+	for _, name := range strings.Split(strings.TrimPrefix(dest, "/"), "/") {
+		if name == "" {
+			break
+		}
+		dir = path.Join(dir, name)
+		file, err := uploader.Stat(dir)
+		switch {
+		case errors.Is(err, fs.ErrorObjectNotFound):
+			if mustExist {
+				p.check.fail("destination %s doesn't exist, create it or drop -no-create-dirs", dest)
+			}
+			return
+		case err != nil:
+			p.check.fail("destination %s can't be checked: %v", dest, err)
+			return
+		case file.Type != "folder":
+			p.check.fail("destination %s can't be created, %s is a file", dest, dir)
+			return
+		}
+	}
+}
+
+// Spool checks that SPOOL_DIR can be written and has room for a part of
+// every one of the workers of the transfers files uploaded at once.
+func (p *Preflight) Spool(cfg *config.Config, workers, transfers int) {
+	if cfg.SpoolDir == "" {
+		return
+	}
+	file, err := os.CreateTemp(cfg.SpoolDir, "uploader-preflight-")
+	if err != nil {
+		p.check.fail("SPOOL_DIR %s can't be written: %v", cfg.SpoolDir, err)
+		return
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	need := int64(cfg.PartSize) * int64(workers) * int64(transfers)
+	free, err := freeSpace(cfg.SpoolDir)
+	if err != nil {
+		p.check.warn("free space of SPOOL_DIR %s can't be checked: %v", cfg.SpoolDir, err)
+		return
+	}
+	if free < need {
+		p.check.warn("SPOOL_DIR %s may need %s for the parts of %d workers of %d transfers, only %s is free", cfg.SpoolDir, fs.SizeSuffix(need), workers, transfers, fs.SizeSuffix(free))
+	}
+}
+
+// Local checks that the temporary files of the run can be written: the
+// parity files of PARITY, which take its percentage of the size of every
+// file in the temporary folder. The space is only known to be enough when
+// source is a single local file.
+func (p *Preflight) Local(cfg *config.Config, source string) {
+	if cfg.Parity <= 0 {
+		return
+	}
+	tmp := os.TempDir()
+	dir, err := os.MkdirTemp(tmp, "uploader-preflight-")
+	if err != nil {
+		p.check.fail("the temporary folder %s for the PARITY files can't be written, set TMPDIR (TMP on Windows) to another one: %v", tmp, err)
+		return
+	}
+	os.Remove(dir)
+
+	info, err := os.Stat(source)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	need := info.Size() * int64(cfg.Parity) / 100
+	free, err := freeSpace(tmp)
+	if err != nil {
+		p.check.warn("free space of the temporary folder %s can't be checked: %v", tmp, err)
+		return
+	}
+	if free < need {
+		p.check.fail("PARITY %d%% of %s needs %s in the temporary folder %s, only %s is free", cfg.Parity, source, fs.SizeSuffix(need), tmp, fs.SizeSuffix(free))
+	}
+}
+
+// Result returns an error counting the problems found, or nil.
+func (p *Preflight) Result() error {
+	if p.check.errors > 0 {
+		return errors.New(i18n.Sprintf("%d problems found before uploading, nothing was sent", p.check.errors))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"uploader/config"
+	"uploader/pkg/services"
+	"uploader/pkg/state"
+)
+
+func init() {
+	register(&Command{
+		Name:        "rcat",
+		Description: "Upload the standard input as a single file",
+		Run:         runRcat,
+	})
+}
+
+func runRcat(args []string) error {
+	flags := flag.NewFlagSet("rcat", flag.ExitOnError)
+	workers := flags.Int("workers", 0, "Number of parts to buffer and upload at once")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ... | uploader rcat [options] [remote]:/path/file")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("rcat needs the destination file")
+	}
+
+	remote, filePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	destDir, fileName := path.Split(filePath)
+	if fileName == "" {
+		return fmt.Errorf("%s is not a file path", flags.Arg(0))
+	}
+
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	uploader := s.uploader(profile, *workers, 1, services.WithHistory(state.NewHistory(s.runID)))
+
+	destDir = path.Clean(destDir)
+	if err := uploader.CreateRemoteDir(destDir); err != nil {
+		return err
+	}
+
+	stopProgress := s.progress.StartProgress()
+	err = uploader.UploadStream(os.Stdin, "-", fileName, destDir)
+	stopProgress()
+	return err
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"uploader/config"
+)
+
+func init() {
+	register(&Command{
+		Name:        "restore-meta",
+		Description: "Restore the uploaded metadata of a file on a local copy",
+		Run:         runRestoreMeta,
+	})
+}
+
+func runRestoreMeta(args []string) error {
+	flags := flag.NewFlagSet("restore-meta", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader restore-meta [remote]:/path/file localfile")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("restore-meta needs the remote file and its local copy")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(flags.Arg(1)); err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	return s.uploader(profile, 0, 0).RestoreMetadata(remotePath, flags.Arg(1))
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"uploader/config"
+	"uploader/pkg/logger"
+	"uploader/pkg/pb"
+	"uploader/pkg/services"
+	"uploader/pkg/state"
+	"uploader/pkg/transport"
+
+	"go.uber.org/zap"
+)
+
+// session holds what the commands talking to Teldrive servers share: the
+// configuration, the progress display and the logger of the run.
+type session struct {
+	ctx      context.Context
+	cfg      *config.Config
+	wg       sync.WaitGroup
+	progress *pb.Progress
+	log      *zap.Logger
+	runID    string
+
+	mu        sync.Mutex
+	uploaders []*services.UploadService
+}
+
+// sessions are the sessions of the running command, finished by finish.
+var (
+	sessionsMu sync.Mutex
+	sessions   []*session
+)
+
+func newSession() *session {
+	config.InitConfig()
+	s := &session{
+		ctx:   context.Background(),
+		cfg:   config.GetConfig(),
+		runID: state.NewRunID(),
+	}
+	s.progress = pb.NewProgress(
+		&s.wg,
+		pb.OptionSetWriter(os.Stderr),
+		pb.OptionSetThrottle(65*time.Millisecond),
+	)
+	s.progress.SetRunID(s.runID)
+	s.log = logger.InitLogger().With(zap.String("runId", s.runID))
+	s.progress.SetLogger(s.log)
+	sessionsMu.Lock()
+	sessions = append(sessions, s)
+	sessionsMu.Unlock()
+	return s
+}
+
+// finish closes the upload services of the sessions of the command that
+// ran, returning its error or services.ErrStalled if one of them was
+// cancelled by STALL_ACTION=abort.
+func finish(err error) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	stalled := false
+	for _, s := range sessions {
+		s.mu.Lock()
+		for _, uploader := range s.uploaders {
+			uploader.Close()
+			stalled = stalled || uploader.Stalled()
+		}
+		s.uploaders = nil
+		s.mu.Unlock()
+	}
+	sessions = nil
+	if stalled {
+		return fmt.Errorf("%w, no data was sent for STALL_TIMEOUT", services.ErrStalled)
+	}
+	return err
+}
+
+// uploader returns an upload service for the server of profile, workers and
+// transfers default to the ones of the profile or the configured values when
+// 0, as do the part size and encryption.
+func (s *session) uploader(profile *config.Profile, workers, transfers int, options ...services.UploadOption) *services.UploadService {
+	if workers == 0 {
+		workers = s.cfg.Workers
+		if profile.Workers != 0 {
+			workers = profile.Workers
+		}
+	}
+	if transfers == 0 {
+		transfers = s.cfg.Transfers
+		if profile.Transfers != 0 {
+			transfers = profile.Transfers
+		}
+	}
+	partSize := s.cfg.PartSize
+	if profile.PartSize != 0 {
+		partSize = profile.PartSize
+	}
+	encryptFiles := s.cfg.EncryptFiles
+	if profile.EncryptFiles != nil {
+		encryptFiles = *profile.EncryptFiles
+	}
+	options = append([]services.UploadOption{
+		services.WithPartTimeout(int64(s.cfg.MinSpeed), s.cfg.TimeoutSlack),
+		services.WithSlowPart(int64(s.cfg.SlowPart)),
+		services.WithFileBwLimit(int64(s.cfg.BwLimitFile)),
+		services.WithStallTimeout(s.cfg.StallTimeout, s.cfg.StallAction),
+		services.WithCleanupOnFailure(s.cfg.CleanupOnFailure),
+		services.WithBufferSize(int64(s.cfg.BufferSize)),
+		services.WithMaxMemory(int64(s.cfg.MaxMemory)),
+		services.WithListing(s.cfg.ListPageSize, s.cfg.ListConcurrency),
+		services.WithSourceTransport(transport.New(s.cfg.TransportOptions())),
+	}, options...)
+	// the bots and the channels of the map belong to the default server
+	if bots := services.ParseBots(s.cfg.Bots); len(bots) > 0 && profile.ApiURL == s.cfg.ApiURL {
+		options = append(options, services.WithBots(bots))
+	}
+	if s.cfg.ChannelMap != "" && profile.ApiURL == s.cfg.ApiURL {
+		if rules, err := services.ParseChannelMap(s.cfg.ChannelMap); err == nil {
+			options = append(options, services.WithChannelMap(rules))
+		} else {
+			s.log.Warn("invalid channel map", zap.Error(err))
+		}
+	}
+	if sessions, err := state.LoadSessionIndex(profile.ApiURL); err == nil {
+		options = append(options, services.WithSessionIndex(sessions))
+	} else {
+		s.log.Warn("load upload sessions failed", zap.Error(err))
+	}
+	client := services.NewClient(profile.ApiURL, profile.SessionToken, s.cfg.APICompat, transport.New(s.cfg.TransportOptions())).SetHeader("X-Run-Id", s.runID)
+	uploader := services.NewUploadService(client, workers, transfers, int64(partSize), encryptFiles, s.cfg.RandomisePart, profile.ChannelID, false, services.NewPacer(s.ctx), s.ctx, s.progress, &s.wg, s.log, options...)
+	s.mu.Lock()
+	s.uploaders = append(s.uploaders, uploader)
+	s.mu.Unlock()
+	return uploader
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"uploader/config"
+	"uploader/pkg/types"
+)
+
+func init() {
+	register(&Command{
+		Name:        "share",
+		Description: "Create, list and revoke public share links",
+		Run:         runShare,
+	})
+}
+
+func shareUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: uploader share create [-expire duration] [-password password] [remote]:/path")
+	fmt.Fprintln(os.Stderr, "       uploader share list [remote]:/path")
+	fmt.Fprintln(os.Stderr, "       uploader share revoke [remote]:/path")
+}
+
+func runShare(args []string) error {
+	if len(args) == 0 {
+		shareUsage()
+		return errors.New("share needs create, list or revoke")
+	}
+	action, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("share "+action, flag.ExitOnError)
+	var expire time.Duration
+	var password string
+	switch action {
+	case "create":
+		flags.DurationVar(&expire, "expire", 0, "Expire the link after this long, e.g. 72h, 0 to never expire")
+		flags.StringVar(&password, "password", "", "Protect the link with this password")
+	case "list", "revoke":
+	default:
+		shareUsage()
+		return fmt.Errorf("unknown share action %q", action)
+	}
+	flags.Usage = func() {
+		shareUsage()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("share needs the remote path")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	uploader := s.uploader(profile, 0, 0)
+	remotePath = path.Clean(remotePath)
+
+	file, err := uploader.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "create":
+		var expiresAt time.Time
+		if expire > 0 {
+			expiresAt = time.Now().Add(expire)
+		}
+		if err := uploader.CreateShare(file.Id, password, expiresAt); err != nil {
+			return err
+		}
+		share, err := uploader.GetShare(file.Id)
+		if err != nil {
+			return err
+		}
+		if share == nil {
+			return fmt.Errorf("%s: share link not found after creating it", remotePath)
+		}
+		fmt.Println(shareLink(profile, share))
+		return nil
+	case "revoke":
+		if err := uploader.DeleteShare(file.Id); err != nil {
+			return fmt.Errorf("%s: %w", remotePath, err)
+		}
+		fmt.Fprintf(os.Stderr, "revoked the share link of %s\n", remotePath)
+		return nil
+	}
+
+	// list the shares of the path and, for a folder, of its entries
+	files := []types.FileInfo{*file}
+	if file.Type == "folder" {
+		entries, err := uploader.List(remotePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, entries...)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, f := range files {
+		filePath := remotePath
+		if i > 0 {
+			filePath = path.Join(remotePath, f.Name)
+		}
+		share, err := uploader.GetShare(f.Id)
+		if err != nil {
+			return err
+		}
+		if share == nil {
+			continue
+		}
+		expires := "never"
+		if share.ExpiresAt != nil {
+			expires = share.ExpiresAt.Local().Format(time.RFC3339)
+		}
+		protected := ""
+		if share.Protected {
+			protected = "password"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", filePath, shareLink(profile, share), expires, protected)
+	}
+	return w.Flush()
+}
+
+// shareLink returns the public URL of share.
+func shareLink(profile *config.Profile, share *types.Share) string {
+	return strings.TrimRight(profile.ApiURL, "/") + "/share/" + share.Id
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"uploader/config"
+
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	register(&Command{
+		Name:        "stat",
+		Description: "Show the metadata of a remote file",
+		Run:         runStat,
+	})
+}
+
+func runStat(args []string) error {
+	flags := flag.NewFlagSet("stat", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the metadata as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader stat [options] [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("stat needs the remote path")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	uploader := s.uploader(profile, 0, 0)
+
+	file, err := uploader.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+	meta, err := uploader.Metadata(file.Id)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(meta)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Path:\t%s\n", remotePath)
+	fmt.Fprintf(w, "ID:\t%s\n", meta.Id)
+	fmt.Fprintf(w, "Type:\t%s\n", meta.Type)
+	if meta.Type != "folder" {
+		fmt.Fprintf(w, "Size:\t%s (%d bytes)\n", fs.SizeSuffix(meta.Size), meta.Size)
+		fmt.Fprintf(w, "MIME type:\t%s\n", meta.MimeType)
+		fmt.Fprintf(w, "Parts:\t%d\n", len(meta.Parts))
+		fmt.Fprintf(w, "Channel:\t%d\n", meta.ChannelID)
+		fmt.Fprintf(w, "Encrypted:\t%t\n", meta.Encrypted)
+	}
+	fmt.Fprintf(w, "Created:\t%s\n", meta.CreatedAt.Local().Format(time.RFC3339))
+	fmt.Fprintf(w, "Modified:\t%s\n", meta.UpdatedAt.Local().Format(time.RFC3339))
+	return w.Flush()
+}
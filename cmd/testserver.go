@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"uploader/pkg/testserver"
+)
+
+func init() {
+	register(&Command{
+		Name:        "test-server",
+		Description: "Serve an in-memory Teldrive API with injected faults for testing",
+		Run:         runTestServer,
+	})
+}
+
+func runTestServer(args []string) error {
+	flags := flag.NewFlagSet("test-server", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "Address to listen on")
+	token := flags.String("token", "", "Session token the requests must send, any when empty")
+	var faults testserver.Faults
+	flags.Float64Var(&faults.Conflict, "conflict", 0, "Chance from 0 to 1 of answering a file creation with 409 Conflict")
+	flags.Float64Var(&faults.RateLimit, "rate-limit", 0, "Chance from 0 to 1 of answering a request with 429 Too Many Requests")
+	flags.Float64Var(&faults.ServerError, "server-error", 0, "Chance from 0 to 1 of answering a request with 500 Internal Server Error")
+	flags.Int64Var(&faults.Seed, "seed", 0, "Seed of the faults, to repeat them from run to run")
+	verbose := flags.Bool("verbose", false, "Print every request with the status it was answered with")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader test-server [options]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errors.New("test-server takes no arguments")
+	}
+	for _, chance := range []float64{faults.Conflict, faults.RateLimit, faults.ServerError} {
+		if chance < 0 || chance > 1 {
+			return fmt.Errorf("fault chance %g isn't between 0 and 1", chance)
+		}
+	}
+
+	server := testserver.New(faults)
+	server.Token = *token
+	var handler http.Handler = server
+	if *verbose {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			server.ServeHTTP(rec, r)
+			fmt.Fprintf(os.Stderr, "%d %s %s %s\n", rec.status, r.Method, r.URL, time.Since(start).Round(time.Millisecond))
+		})
+	}
+	fmt.Fprintf(os.Stderr, "Test server listening on http://%s, set API_URL to it\n", *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+// statusRecorder keeps the status written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
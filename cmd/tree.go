@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"uploader/config"
+	"uploader/pkg/services"
+
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	register(&Command{
+		Name:        "tree",
+		Description: "Show the remote folders and files as a tree",
+		Run:         runTree,
+	})
+}
+
+func runTree(args []string) error {
+	flags := flag.NewFlagSet("tree", flag.ExitOnError)
+	depth := flags.Int("depth", 2, "Show folders down to this depth below the path, -1 for all")
+	dirsOnly := flags.Bool("d", false, "Only show folders")
+	concurrency := flags.Int("concurrency", 0, "Number of folders to list at once, 0 for LIST_CONCURRENCY")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader tree [options] [remote]:/path")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("tree needs the remote path")
+	}
+
+	if *depth == 0 || *depth < -1 {
+		return errors.New("-depth must be at least 1, or -1 for all")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+
+	// listing a folder shows the level below it
+	listDepth := *depth
+	if listDepth > 0 {
+		listDepth--
+	}
+	root, err := s.uploader(profile, 0, 0).Tree(remotePath, listDepth, *concurrency)
+	if err != nil {
+		return err
+	}
+
+	branch, last, indent, lastIndent := "├── ", "└── ", "│   ", "    "
+	if config.GetConfig().ASCII {
+		branch, last, indent = "|-- ", "`-- ", "|   "
+	}
+	fmt.Printf("%s [%s]\n", root.Path, treeSize(root))
+	var print func(n *services.TreeNode, prefix string)
+	print = func(n *services.TreeNode, prefix string) {
+		children := n.Children
+		if *dirsOnly {
+			children = nil
+			for _, child := range n.Children {
+				if child.Type == "folder" {
+					children = append(children, child)
+				}
+			}
+		}
+		for i, child := range children {
+			connector, next := branch, indent
+			if i == len(children)-1 {
+				connector, next = last, lastIndent
+			}
+			name := child.Name
+			if child.Type == "folder" {
+				name += "/"
+			}
+			fmt.Printf("%s%s%s [%s]\n", prefix, connector, name, treeSize(child))
+			print(child, prefix+next)
+		}
+	}
+	print(root, "")
+	return nil
+}
+
+// treeSize formats the size of n, marking the sizes of folders that weren't
+// listed all the way down.
+func treeSize(n *services.TreeNode) string {
+	switch {
+	case n.Complete:
+		return fs.SizeSuffix(n.Size).String()
+	case n.Listed:
+		return fs.SizeSuffix(n.Size).String() + "+"
+	default:
+		return "?"
+	}
+}
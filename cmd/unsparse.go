@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"uploader/config"
+)
+
+func init() {
+	register(&Command{
+		Name:        "unsparse",
+		Description: "Download a sparse file uploaded with SPARSE=pack",
+		Run:         runUnsparse,
+	})
+}
+
+func runUnsparse(args []string) error {
+	flags := flag.NewFlagSet("unsparse", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader unsparse [remote]:/path/file localfile")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("unsparse needs the remote file, without .sparse, and the local file to create")
+	}
+
+	remote, remotePath, err := parseRemote(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	return s.uploader(profile, 0, 0).Unsparse(remotePath, flags.Arg(1))
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"uploader/config"
+	"uploader/pkg/services"
+	"uploader/pkg/state"
+
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	register(&Command{
+		Name:        "uploads",
+		Description: "List and abort unfinished upload sessions",
+		Run:         runUploads,
+	})
+}
+
+func uploadsUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: uploader uploads ls [remote]")
+	fmt.Fprintln(os.Stderr, "       uploader uploads rm [remote] <hash>")
+}
+
+func runUploads(args []string) error {
+	flags := flag.NewFlagSet("uploads", flag.ExitOnError)
+	flags.Usage = uploadsUsage
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) == 0 {
+		uploadsUsage()
+		return errors.New("uploads needs ls or rm")
+	}
+
+	action, args := args[0], args[1:]
+	var remote, hash string
+	switch {
+	case action == "ls" && len(args) <= 1:
+		if len(args) == 1 {
+			remote = args[0]
+		}
+	case action == "rm" && len(args) == 1:
+		hash = args[0]
+	case action == "rm" && len(args) == 2:
+		remote, hash = args[0], args[1]
+	default:
+		uploadsUsage()
+		return fmt.Errorf("invalid uploads command")
+	}
+
+	s := newSession()
+	profile, err := config.GetProfile(remote)
+	if err != nil {
+		return err
+	}
+	sessions, err := state.LoadSessionIndex(profile.ApiURL)
+	if err != nil {
+		return err
+	}
+	uploader := s.uploader(profile, 0, 0, services.WithSessionIndex(sessions))
+
+	if action == "rm" {
+		if err := uploader.AbortUpload(hash); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "deleted upload session %s\n", hash)
+		return nil
+	}
+
+	uploads, err := uploader.Uploads()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tSTARTED\tPARTS\tUPLOADED\tSIZE\tPATH")
+	for _, upload := range uploads {
+		size := "?"
+		if upload.Size >= 0 {
+			size = fs.SizeSuffix(upload.Size).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", upload.Hash, upload.Started.Format(time.DateTime), upload.Parts, fs.SizeSuffix(upload.Bytes), size, upload.Path)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"uploader/config"
+	"uploader/pkg/consts"
+	"uploader/pkg/services"
+)
+
+func init() {
+	register(&Command{
+		Name:        "version",
+		Description: "Show the version of the uploader, and check the server with -check",
+		Run:         runVersion,
+	})
+}
+
+func runVersion(args []string) error {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	check := flags.Bool("check", false, "Query the version of the server and check that its API matches the uploader")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: uploader version [-check] [remote]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errors.New("version takes at most the remote to check")
+	}
+
+	fmt.Printf("uploader %s\n", consts.Version)
+	if consts.Commit != "" {
+		fmt.Printf("commit: %s %s\n", consts.Commit, consts.CommitDate)
+	}
+	fmt.Printf("go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if !*check {
+		return nil
+	}
+
+	s := newSession()
+	profile, err := config.GetProfile(strings.TrimSuffix(flags.Arg(0), ":"))
+	if err != nil {
+		return err
+	}
+	uploader := s.uploader(profile, 0, 0)
+
+	version, err := uploader.ServerVersion()
+	if err != nil {
+		return err
+	}
+	if version != nil {
+		fmt.Printf("server: %s %s (%s %s/%s)\n", profile.ApiURL, version.Version, version.GoVersion, version.Os, version.Arch)
+	} else {
+		fmt.Printf("server: %s unknown version\n", profile.ApiURL)
+	}
+
+	fmt.Printf("api: %s\n", services.APIProfileFor(version).Name)
+
+	problems, err := uploader.CheckCompatibility(version)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, "warning:", problem)
+	}
+	if len(problems) > 0 {
+		return errors.New("the server may not be compatible with this uploader")
+	}
+	fmt.Println("server API is compatible")
+	return nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// rclonePrefix selects a remote of the default rclone config in AUTH_FROM.
+const rclonePrefix = "rclone:"
+
+// LoadAuth takes the API URL and the session token, and the channel unless
+// set, from the teldrive remote of an rclone config: rclone:<remote> for a
+// remote of the default rclone config, or the path of a config file for
+// its first teldrive remote, optionally followed by #<remote>.
+func (c *Config) LoadAuth(spec string) error {
+	var file, remote string
+	if strings.HasPrefix(spec, rclonePrefix) {
+		remote = strings.TrimPrefix(spec, rclonePrefix)
+		if remote == "" {
+			return fmt.Errorf("auth from %q: missing the rclone remote name", spec)
+		}
+		var err error
+		if file, err = rcloneConfigPath(); err != nil {
+			return err
+		}
+	} else {
+		file, remote, _ = strings.Cut(spec, "#")
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("RCLONE_ENCRYPT_")) {
+		return fmt.Errorf("%s is encrypted, export the remote to a plain config file", file)
+	}
+	cfg, err := ini.Load(data)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file, err)
+	}
+
+	var section *ini.Section
+	if remote != "" {
+		if section, err = cfg.GetSection(remote); err != nil {
+			return fmt.Errorf("no remote %q in %s", remote, file)
+		}
+	} else {
+		for _, s := range cfg.Sections() {
+			if s.Key("type").String() == "teldrive" {
+				section = s
+				break
+			}
+		}
+		if section == nil {
+			return fmt.Errorf("no teldrive remote in %s", file)
+		}
+	}
+	if kind := section.Key("type").String(); kind != "teldrive" {
+		return fmt.Errorf("remote %q in %s is a %s remote, not teldrive", section.Name(), file, kind)
+	}
+
+	apiURL := section.Key("api_host").String()
+	token := section.Key("access_token").String()
+	if apiURL == "" || token == "" {
+		return fmt.Errorf("remote %q in %s has no api_host or access_token", section.Name(), file)
+	}
+	c.ApiURL = apiURL
+	c.SessionToken = token
+	if c.ChannelID == 0 && section.HasKey("channel_id") {
+		channelID, err := strconv.ParseInt(section.Key("channel_id").String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("remote %q in %s: invalid channel_id: %w", section.Name(), file, err)
+		}
+		c.ChannelID = channelID
+	}
+	return nil
+}
+
+// CheckAuth returns an error if the API URL or the session token is
+// missing.
+func (c *Config) CheckAuth() error {
+	if c.ApiURL == "" || c.SessionToken == "" {
+		return errors.New("API_URL and SESSION_TOKEN are required, or AUTH_FROM to take them from an rclone remote")
+	}
+	return nil
+}
+
+// rcloneConfigPath returns the path of the config file rclone uses by
+// default.
+func rcloneConfigPath() (string, error) {
+	if path := os.Getenv("RCLONE_CONFIG"); path != "" {
+		return path, nil
+	}
+	var candidates []string
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".config", "rclone", "rclone.conf"))
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "rclone", "rclone.conf"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".rclone.conf"))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("rclone config file not found, set RCLONE_CONFIG")
+}
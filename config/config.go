@@ -1,42 +1,234 @@
 package config
 
 import (
-	"github.com/joho/godotenv"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"uploader/pkg/pb"
+	"uploader/pkg/transport"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rclone/rclone/fs"
 )
 
 type Config struct {
-	ApiURL            string        `envconfig:"API_URL" required:"true"`
-	SessionToken      string        `envconfig:"SESSION_TOKEN" required:"true"`
+	ApiURL            string        `envconfig:"API_URL"`
+	SessionToken      string        `envconfig:"SESSION_TOKEN"`
+	AuthFrom          string        `envconfig:"AUTH_FROM"`
+	Dest              string        `envconfig:"DEST"`
 	PartSize          fs.SizeSuffix `envconfig:"PART_SIZE"`
 	ChannelID         int64         `envconfig:"CHANNEL_ID"`
+	ChannelMap        string        `envconfig:"CHANNEL_MAP"`
+	Bots              string        `envconfig:"BOTS"`
 	Workers           int           `envconfig:"WORKERS" default:"4"`
 	Transfers         int           `envconfig:"TRANSFERS" default:"4"`
 	RandomisePart     bool          `envconfig:"RANDOMISE_PART" default:"true"`
 	EncryptFiles      bool          `envconfig:"ENCRYPT_FILES" default:"false"`
 	DeleteAfterUpload bool          `envconfig:"DELETE_AFTER_UPLOAD" default:"false"`
 	Debug             bool          `envconfig:"DEBUG" default:"false"`
+	Theme             string        `envconfig:"THEME" default:"default"`
+	SpinnerType       int           `envconfig:"SPINNER_TYPE" default:"9"`
+	ASCII             bool          `envconfig:"ASCII" default:"false"`
+	StatusFile        string        `envconfig:"STATUS_FILE"`
+	StatusInterval    time.Duration `envconfig:"STATUS_INTERVAL" default:"1s"`
+	EventsFile        string        `envconfig:"EVENTS_FILE"`
+	Manifest          string        `envconfig:"MANIFEST"`
+	TerminalTitle     bool          `envconfig:"TERMINAL_TITLE" default:"true"`
+	SpeedWindow       time.Duration `envconfig:"SPEED_WINDOW" default:"10s"`
+	GroupBars         bool          `envconfig:"GROUP_BARS" default:"false"`
+	Verbose           bool          `envconfig:"VERBOSE" default:"false"`
+	Notify            bool          `envconfig:"NOTIFY" default:"false"`
+	UILanguage        string        `envconfig:"UI_LANGUAGE" default:"auto"`
+	Dump              string        `envconfig:"DUMP"`
+	OtlpEndpoint      string        `envconfig:"OTLP_ENDPOINT"`
+	MaxTransfer       fs.SizeSuffix `envconfig:"MAX_TRANSFER"`
+	DailyBudget       fs.SizeSuffix `envconfig:"DAILY_BUDGET"`
+	TransferWindow    string        `envconfig:"TRANSFER_WINDOW"`
+	ExpectContinue    bool          `envconfig:"EXPECT_CONTINUE" default:"false"`
+	NoChunked         bool          `envconfig:"NO_CHUNKED" default:"false"`
+	KeepAlive         time.Duration `envconfig:"KEEPALIVE" default:"30s"`
+	MaxIdleConns      int           `envconfig:"MAX_IDLE_CONNS" default:"100"`
+	IdleConnTimeout   time.Duration `envconfig:"IDLE_CONN_TIMEOUT" default:"90s"`
+	MaxIdleConnsHost  int           `envconfig:"MAX_IDLE_CONNS_PER_HOST" default:"0"`
+	MaxConnsHost      int           `envconfig:"MAX_CONNS_PER_HOST" default:"0"`
+	HTTPVersion       string        `envconfig:"HTTP_VERSION"`
+	APICompat         string        `envconfig:"API_COMPAT" default:"auto"`
+	FairShare         string        `envconfig:"FAIR_SHARE"`
+	SmallFiles        fs.SizeSuffix `envconfig:"SMALL_FILES"`
+	SmallTransfers    int           `envconfig:"SMALL_FILE_TRANSFERS" default:"4"`
+	SinglePass        bool          `envconfig:"SINGLE_PASS" default:"false"`
+	BufferSize        fs.SizeSuffix `envconfig:"BUFFER_SIZE"`
+	SpoolDir          string        `envconfig:"SPOOL_DIR"`
+	MaxMemory         fs.SizeSuffix `envconfig:"MAX_MEMORY"`
+	MinSpeed          fs.SizeSuffix `envconfig:"MIN_SPEED" default:"64K"`
+	TimeoutSlack      time.Duration `envconfig:"TIMEOUT_SLACK" default:"1m"`
+	SlowPart          fs.SizeSuffix `envconfig:"SLOW_PART"`
+	BwLimitFile       fs.SizeSuffix `envconfig:"BWLIMIT_FILE"`
+	StallTimeout      time.Duration `envconfig:"STALL_TIMEOUT" default:"0"`
+	StallAction       string        `envconfig:"STALL_ACTION" default:"retry"`
+	CleanupOnFailure  bool          `envconfig:"CLEANUP_ON_FAILURE" default:"false"`
+	S3Endpoint        string        `envconfig:"S3_ENDPOINT"`
+	S3Region          string        `envconfig:"S3_REGION"`
+	Compress          string        `envconfig:"COMPRESS"`
+	Sparse            string        `envconfig:"SPARSE"`
+	SplitSize         fs.SizeSuffix `envconfig:"SPLIT_SIZE"`
+	MaxFileSize       fs.SizeSuffix `envconfig:"MAX_FILE_SIZE"`
+	Oversize          string        `envconfig:"OVERSIZE" default:"fail"`
+	Parity            int           `envconfig:"PARITY" default:"0"`
+	Thumbnails        bool          `envconfig:"THUMBNAILS" default:"false"`
+	PreserveMetadata  bool          `envconfig:"PRESERVE_METADATA" default:"false"`
+	VideoMetadata     bool          `envconfig:"VIDEO_METADATA" default:"false"`
+	Photos            bool          `envconfig:"PHOTOS" default:"false"`
+	MaxDepth          int           `envconfig:"MAX_DEPTH" default:"0"`
+	Settle            time.Duration `envconfig:"SETTLE" default:"0"`
+	AssumeYes         bool          `envconfig:"ASSUME_YES" default:"false"`
+	Preflight         bool          `envconfig:"PREFLIGHT" default:"true"`
+	Lock              string        `envconfig:"LOCK"`
+	RewriteRules      string        `envconfig:"REWRITE_RULES"`
+	Flatten           string        `envconfig:"FLATTEN"`
+	PartNameTemplate  string        `envconfig:"PART_NAME_TEMPLATE"`
+	IgnoreCase        bool          `envconfig:"IGNORE_CASE" default:"false"`
+	SizeOnly          bool          `envconfig:"SIZE_ONLY" default:"false"`
+	Checksum          bool          `envconfig:"CHECKSUM" default:"false"`
+	Hash              string        `envconfig:"HASH" default:"sha256"`
+	ListPageSize      int           `envconfig:"LIST_PAGE_SIZE" default:"500"`
+	ListConcurrency   int           `envconfig:"LIST_CONCURRENCY" default:"8"`
+}
+
+// Profile is a Teldrive server. Besides the default one, more can be
+// configured with the <NAME>_API_URL, <NAME>_SESSION_TOKEN and
+// <NAME>_CHANNEL_ID variables, e.g. OLD_API_URL for the profile "old".
+// The other fields override the defaults of the uploads to the profile
+// when set.
+type Profile struct {
+	ApiURL       string        `envconfig:"API_URL" required:"true"`
+	SessionToken string        `envconfig:"SESSION_TOKEN" required:"true"`
+	ChannelID    int64         `envconfig:"CHANNEL_ID"`
+	Dest         string        `envconfig:"DEST"`
+	PartSize     fs.SizeSuffix `envconfig:"PART_SIZE"`
+	Workers      int           `envconfig:"WORKERS"`
+	Transfers    int           `envconfig:"TRANSFERS"`
+	EncryptFiles *bool         `envconfig:"ENCRYPT_FILES"`
 }
 
 var config Config
 
-func InitConfig() {
+// File is the configuration file, read from the working directory.
+const File = "upload.env"
 
-	err := godotenv.Load("upload.env")
-	if err != nil {
+// fileKeys are the variables set from File rather than the environment.
+var fileKeys = map[string]bool{}
+
+// EnvPrefix prefixes the environment variables overriding a setting of
+// upload.env and of the environment, e.g. TELDRIVE_UPLOAD_WORKERS for
+// WORKERS, or TELDRIVE_UPLOAD_OLD_API_URL for OLD_API_URL.
+const EnvPrefix = "TELDRIVE_UPLOAD_"
+
+func InitConfig() {
+	if err := LoadConfig(); err != nil {
 		panic(err)
 	}
+}
 
-	err = envconfig.Process("", &config)
+// LoadConfig reads the configuration from upload.env and the environment,
+// returning what's invalid instead of panicking like InitConfig.
+func LoadConfig() error {
+	// the variables set in the environment win over upload.env, which
+	// can be left out when everything is set there
+	if err := setFileVars(); err != nil {
+		return err
+	}
+	for _, env := range os.Environ() {
+		if name, value, ok := strings.Cut(env, "="); ok && strings.HasPrefix(name, EnvPrefix) {
+			os.Setenv(strings.TrimPrefix(name, EnvPrefix), value)
+			delete(fileKeys, strings.TrimPrefix(name, EnvPrefix))
+		}
+	}
+
+	err := envconfig.Process("", &config)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	if config.PartSize == 0 {
 		config.PartSize = 1000 * fs.Mebi
 	}
+	if config.SpinnerType < 0 || config.SpinnerType > pb.MaxSpinnerType {
+		return fmt.Errorf("SPINNER_TYPE must be 0..%d", pb.MaxSpinnerType)
+	}
+	if config.AuthFrom != "" {
+		return config.LoadAuth(config.AuthFrom)
+	}
+	return nil
 }
 
 func GetConfig() *Config {
 	return &config
 }
+
+// TransportOptions returns the options of the connections to the servers.
+func (c *Config) TransportOptions() transport.Options {
+	return transport.Options{
+		ExpectContinue:      c.ExpectContinue,
+		NoChunked:           c.NoChunked,
+		KeepAlive:           c.KeepAlive,
+		MaxIdleConns:        c.MaxIdleConns,
+		IdleConnTimeout:     c.IdleConnTimeout,
+		MaxIdleConnsPerHost: c.MaxIdleConnsHost,
+		MaxConnsPerHost:     c.MaxConnsHost,
+		HTTPVersion:         c.HTTPVersion,
+	}
+}
+
+// GetProfile returns the Teldrive server configured under name, or the
+// default one if name is empty.
+func GetProfile(name string) (*Profile, error) {
+	if name == "" {
+		if err := config.CheckAuth(); err != nil {
+			return nil, err
+		}
+		return &Profile{ApiURL: config.ApiURL, SessionToken: config.SessionToken, ChannelID: config.ChannelID, Dest: config.Dest}, nil
+	}
+	var profile Profile
+	if err := envconfig.Process(name, &profile); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return &profile, nil
+}
+
+// UseProfile makes the uploads go to the server of the profile named name,
+// with the defaults it sets.
+func (c *Config) UseProfile(name string) error {
+	profile, err := GetProfile(name)
+	if err != nil {
+		return err
+	}
+	c.ApiURL = profile.ApiURL
+	c.SessionToken = profile.SessionToken
+	c.ChannelID = profile.ChannelID
+	c.Dest = profile.Dest
+	if profile.PartSize != 0 {
+		c.PartSize = profile.PartSize
+	}
+	if profile.Workers != 0 {
+		c.Workers = profile.Workers
+	}
+	if profile.Transfers != 0 {
+		c.Transfers = profile.Transfers
+	}
+	if profile.EncryptFiles != nil {
+		c.EncryptFiles = *profile.EncryptFiles
+	}
+	return nil
+}
+
+// DestPath returns the remote folder of dest, relative to the DEST root of
+// the server unless it starts with a slash, or the root itself if dest is
+// empty.
+func (c *Config) DestPath(dest string) string {
+	if !strings.HasPrefix(dest, "/") && c.Dest != "" {
+		dest = path.Join(c.Dest, dest)
+	}
+	return path.Clean("/" + dest)
+}
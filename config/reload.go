@@ -0,0 +1,82 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/rclone/rclone/fs"
+)
+
+// setFileVars sets the variables of File that aren't set in the
+// environment, and unsets the ones set from it before and since removed.
+func setFileVars() error {
+	values, err := godotenv.Read(File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for key := range fileKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(fileKeys, key)
+		}
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !fileKeys[key] {
+			continue
+		}
+		if _, set := os.LookupEnv(EnvPrefix + key); set {
+			continue
+		}
+		os.Setenv(key, value)
+		fileKeys[key] = true
+	}
+	return nil
+}
+
+// Reload reads File again and returns the configuration it gives now,
+// without changing the one of GetConfig. The variables set in the
+// environment keep their values.
+func Reload() (*Config, error) {
+	if err := setFileVars(); err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := envconfig.Process("", &c); err != nil {
+		return nil, err
+	}
+	if c.PartSize == 0 {
+		c.PartSize = 1000 * fs.Mebi
+	}
+	return &c, nil
+}
+
+// Watch calls reload with the configuration given by File every time it
+// changes, checking every interval until ctx is done.
+func Watch(ctx context.Context, interval time.Duration, reload func(*Config, error)) {
+	stamp := func() string {
+		info, err := os.Stat(File)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s %d", info.ModTime(), info.Size())
+	}
+	last := stamp()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if current := stamp(); current != last {
+			last = current
+			reload(Reload())
+		}
+	}
+}
@@ -2,43 +2,187 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
+	"os/exec"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
+	"uploader/cmd"
 	"uploader/config"
+	"uploader/pkg/archive"
+	"uploader/pkg/diagnostics"
+	"uploader/pkg/i18n"
 	"uploader/pkg/logger"
+	"uploader/pkg/notify"
 	"uploader/pkg/pb"
+	"uploader/pkg/rewrite"
 	"uploader/pkg/services"
+	"uploader/pkg/state"
+	"uploader/pkg/tracing"
+	"uploader/pkg/transport"
 
 	"flag"
 
 	"github.com/rclone/rclone/fs"
-	"github.com/rclone/rclone/lib/pacer"
-	"github.com/rclone/rclone/lib/rest"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// exitQuotaExceeded is the exit code of a run stopped by the transfer quota.
+const exitQuotaExceeded = 3
+
+// exitStalled is the exit code of a run cancelled by STALL_ACTION=abort.
+const exitStalled = 4
+
 func main() {
-	sourcePath := flag.String("path", "", "File or directory path to upload")
-	destDir := flag.String("dest", "", "Remote directory for uploaded files")
+	if len(os.Args) > 1 {
+		if command, ok := cmd.Lookup(os.Args[1]); ok {
+			i18n.SetLanguage(i18n.Auto)
+			if err := command.Run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+				if errors.Is(err, services.ErrStalled) {
+					os.Exit(exitStalled)
+				}
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	os.Exit(upload())
+}
+
+func upload() int {
+	sourcePath := flag.String("path", "", "File or directory path, glob pattern like *.mkv or **/*.mkv, http(s) URL or s3://bucket/prefix to upload")
+	destDir := flag.String("dest", "", "Remote directory for uploaded files, relative to DEST unless it starts with /")
+	profile := flag.String("profile", "", "Upload to the server of this profile with its defaults, e.g. its DEST, PART_SIZE and WORKERS")
+	authFrom := flag.String("auth-from", "", "Take the API URL and session token from an rclone teldrive remote, rclone:<remote>, or the path of an rclone config file")
+	noCreateDirs := flag.Bool("no-create-dirs", false, "Fail if the -dest folder doesn't exist instead of creating it and its parents")
+	noPreflight := flag.Bool("no-preflight", false, "Don't check the settings, server, destination and temporary space before uploading")
+	destName := flag.String("dest-name", "", "Remote name of the uploaded file, when uploading a single file")
 	workers := flag.Int("workers", 0, "Number of current workers to use when uploading multi-parts")
 	transfers := flag.Int("transfers", 0, "Number of current files to upload at once")
+	theme := flag.String("theme", "", "Progress bar theme: default, blocks, arrows or ascii")
+	ascii := flag.Bool("ascii", false, "Only use ASCII characters in the progress display")
+	speedWindow := flag.Duration("speed-window", 0, "Time over which the speeds and ETAs are averaged, e.g. 30s")
+	verbose := flag.Bool("verbose", false, "Show the state of every part under the bars of the files uploaded in parts")
+	groupBars := flag.Bool("group-bars", false, "Show the bars of a folder upload under their folder, with its progress")
+	noTitle := flag.Bool("no-title", false, "Don't show the upload progress in the terminal title")
+	expectContinue := flag.Bool("expect-continue", false, "Send the Expect: 100-continue header with requests that have a body")
+	noChunked := flag.Bool("no-chunked", false, "Don't use chunked transfer encoding for requests")
+	http1 := flag.Bool("http1", false, "Always use HTTP/1.1")
+	http2 := flag.Bool("http2", false, "Always use HTTP/2, in clear text for http:// servers")
+	maxIdleConnsPerHost := flag.Int("max-idle-conns-per-host", 0, "Maximum number of idle connections kept open to the server")
+	maxConnsPerHost := flag.Int("max-conns-per-host", 0, "Maximum number of connections to the server")
+	dump := flag.String("dump", "", "Log API calls for debugging: headers, bodies and/or auth, comma separated")
+	pprofAddr := flag.String("pprof", "", "Serve pprof profiling data on this address, e.g. :6060")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile to this file")
+	memProfile := flag.String("memprofile", "", "Write a memory profile to this file when the upload finishes")
+	notifyDone := flag.Bool("notify", false, "Send a desktop notification when the upload finishes or fails")
+	lang := flag.String("lang", "", "Language of the progress summary and errors: auto, en or es")
+	statusFile := flag.String("status-file", "", "Periodically write the upload progress as JSON to this file")
+	eventsFile := flag.String("events-file", "", "Write the progress events as JSON lines to this file")
+	manifest := flag.String("manifest", "", "At the end of the run, write the list of uploaded files as JSON to this file, or POST it to this URL")
+	transferWindow := flag.String("transfer-window", "", "Only transfer data during this daily time window, e.g. 23:00-07:00")
+	resume := flag.Bool("resume", false, "Upload the files left over by a run stopped by the transfer quota")
+	partNameTemplate := flag.String("part-name", "", "Template of the part names when RANDOMISE_PART is false, e.g. {{.Name}}.{{.PartNo}}of{{.Total}}")
+	ignoreCase := flag.Bool("ignore-case", false, "Treat names differing only in case as the same file when checking for existing files")
+	sizeOnly := flag.Bool("size-only", false, "Replace remote files whose size differs from the local file instead of failing")
+	checksum := flag.Bool("checksum", false, "Compare files with the uploaded ones by content hash instead of name and size")
+	hashAlgorithm := flag.String("hash", "", "Content hash algorithm of -checksum: md5, sha256, blake3 or xxh3")
+	flatten := flag.Bool("flatten", false, "Upload all the files of the folder tree into the destination itself")
+	flattenPolicy := flag.String("flatten-policy", services.FlattenSuffix, "How -flatten renames files with a taken name: suffix or prefix")
+	rewriteRules := flag.String("rewrite", "", "File of rules rewriting the relative paths of uploaded files, one `pattern => replacement` per line")
+	photos := flag.Bool("photos", false, "Sort the uploaded files into YYYY/MM folders by photo capture date or modification time")
+	maxDepth := flag.Int("max-depth", 0, "Only upload the files of a folder down to this many levels below it")
+	settle := flag.Duration("settle", 0, "Defer the upload of files modified less than this long ago, e.g. 30s")
+	noRecurse := flag.Bool("no-recurse", false, "Only upload the files directly in the folder, same as -max-depth 1")
+	videoMetadata := flag.Bool("video-metadata", false, "Send the duration, resolution and codec of videos with the file")
+	thumbnails := flag.Bool("thumbnails", false, "Upload a thumbnail of every image and video into a .thumbnails folder next to it")
+	preserveMetadata := flag.Bool("preserve-metadata", false, "Upload the permissions, owner and extended attributes of every file into a .meta folder next to it")
+	parity := flag.Int("parity", 0, "Upload PAR2 recovery files with this redundancy in percent next to every file")
+	compress := flag.String("compress", "", "Compress files before uploading them: zstd or gzip")
+	sparse := flag.String("sparse", "", "Detect sparse files and warn about them, or pack to upload only their data")
+	lock := flag.String("lock", "", "Wait for other runs uploading to the same destination (dest) or any other run (global) to finish first")
+	yes := flag.Bool("yes", false, "Don't ask before a run that deletes local files or replaces remote ones")
+	flag.BoolVar(yes, "y", false, "Same as -yes")
+	archiveFormat := flag.String("archive", "", "Upload the directory as a single archive: "+strings.Join(archive.Formats, ", "))
+	var maxTransfer, dailyBudget, splitSize, maxFileSize, minSpeed, slowPart, bwLimitFile, bufferSize, maxMemory, smallFiles fs.SizeSuffix
+	flag.Var(&maxTransfer, "max-transfer", "Stop starting new files after uploading this much data, e.g. 200G")
+	flag.Var(&dailyBudget, "daily-budget", "Stop starting new files once this much data was uploaded today, e.g. 500G")
+	fairShare := flag.String("fair-share", "", "Share the part workers of all files, handing free ones out by policy: equal or small-first")
+	singlePass := flag.Bool("single-pass", false, "Read every file once, sequentially, computing its MIME type and checksum while uploading it")
+	flag.Var(&smallFiles, "small-files", "Upload files up to this size in a lane of their own, e.g. 10M")
+	smallTransfers := flag.Int("small-file-transfers", 0, "Number of current files to upload at once in the small file lane")
+	flag.Var(&bufferSize, "buffer-size", "Read every part being sent ahead through a buffer of this size, e.g. 16M")
+	spoolDir := flag.String("spool-dir", "", "Copy every part to this fast local folder, e.g. /dev/shm, before sending it")
+	flag.Var(&maxMemory, "max-memory", "Maximum memory used to buffer file data, e.g. 1G")
+	flag.Var(&minSpeed, "min-speed", "Send a part again when it's uploaded slower than this per second on average, or off, e.g. 64K")
+	stallTimeout := flag.Duration("stall-timeout", 0, "Send the parts again, or cancel the run, when no data was sent for this long, e.g. 5m")
+	stallAction := flag.String("stall-action", "", "What to do when the upload stalls: retry or abort")
+	cleanupOnFailure := flag.Bool("cleanup-on-failure", false, "Remove the parts uploaded for failed files instead of keeping them to resume")
+	flag.Var(&slowPart, "slow-part", "Log a warning for every part uploaded slower than this per second, e.g. 1M")
+	flag.Var(&bwLimitFile, "bwlimit-file", "Cap the upload speed of every file to this per second, e.g. 2M")
+	flag.Var(&splitSize, "split-size", "Upload files bigger than this as numbered volumes of this size, e.g. 2G")
+	flag.Var(&maxFileSize, "max-file-size", "Biggest file the server takes; bigger ones are refused up front or split, see -oversize")
+	oversize := flag.String("oversize", "", "What to do with files bigger than -max-file-size: fail or split")
+	failPartEvery := flag.Int("fail-part-every", 0, "Fail every Nth part upload, to test retries and resuming")
+	injectLatency := flag.Duration("inject-latency", 0, "Delay every request to the server by this long, to test slow networks")
+	flag.Usage = usage
 	flag.Parse()
 
-	if *sourcePath == "" || *destDir == "" {
-		if runtime.GOOS == "windows" {
-			fmt.Println("Usage: ./uploader.exe -path <file_or_directory_path> -dest <remote_directory>")
-			return
-		}
-		fmt.Println("Usage: ./uploader -path <file_or_directory_path> -dest <remote_directory>")
-		return
+	// the errors found before loading upload.env are shown in the language
+	// of the flag or the locale
+	i18n.SetLanguage(i18n.Auto)
+	if i18n.Valid(*lang) {
+		i18n.SetLanguage(*lang)
+	}
+
+	if *sourcePath == "" && flag.NArg() == 1 {
+		*sourcePath = flag.Arg(0)
+	}
+	if !*resume && *sourcePath == "" {
+		usage()
+		return 0
+	}
+	if *destName != "" && strings.ContainsAny(*destName, "/\\") {
+		fmt.Fprintln(os.Stderr, i18n.T("The -dest-name must be a file name, without folders"))
+		return 2
+	}
+	if *http1 && *http2 {
+		fmt.Fprintln(os.Stderr, i18n.T("Use either -http1 or -http2"))
+		return 2
+	}
+	if *archiveFormat != "" && !archive.Valid(*archiveFormat) {
+		fmt.Fprint(os.Stderr, i18n.Sprintf("Unknown archive format %q, use one of: %s\n", *archiveFormat, strings.Join(archive.Formats, ", ")))
+		return 2
 	}
 
 	config.InitConfig()
 	config := config.GetConfig()
+	if *profile != "" {
+		if err := config.UseProfile(*profile); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+			return 2
+		}
+	}
+	if *authFrom != "" {
+		if err := config.LoadAuth(*authFrom); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+			return 2
+		}
+	}
+	if err := config.CheckAuth(); err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+		return 2
+	}
+	if !*resume && *destDir == "" && config.Dest == "" {
+		usage()
+		return 0
+	}
 
 	numTransfers := config.Transfers
 	if *transfers != 0 {
@@ -50,12 +194,245 @@ func main() {
 		numWorkers = *workers
 	}
 
-	var wg sync.WaitGroup
-	progress := pb.NewProgress(
-		&wg,
+	if *theme != "" {
+		config.Theme = *theme
+	}
+	if *ascii {
+		config.ASCII = true
+	}
+	if *statusFile != "" {
+		config.StatusFile = *statusFile
+	}
+	if *eventsFile != "" {
+		config.EventsFile = *eventsFile
+	}
+	if *manifest != "" {
+		config.Manifest = *manifest
+	}
+	if *noTitle {
+		config.TerminalTitle = false
+	}
+	if *verbose {
+		config.Verbose = true
+	}
+	if *groupBars {
+		config.GroupBars = true
+	}
+	if *speedWindow > 0 {
+		config.SpeedWindow = *speedWindow
+	}
+	if *notifyDone {
+		config.Notify = true
+	}
+	if *lang != "" {
+		config.UILanguage = *lang
+	}
+	if !i18n.Valid(config.UILanguage) {
+		fmt.Fprint(os.Stderr, i18n.Sprintf("Unknown language %q, use auto, en or es\n", config.UILanguage))
+		return 2
+	}
+	i18n.SetLanguage(config.UILanguage)
+	if *dump != "" {
+		config.Dump = *dump
+	}
+	if *expectContinue {
+		config.ExpectContinue = true
+	}
+	if *noChunked {
+		config.NoChunked = true
+	}
+	if *http1 {
+		config.HTTPVersion = transport.HTTP1
+	}
+	if *http2 {
+		config.HTTPVersion = transport.HTTP2
+	}
+	if *maxIdleConnsPerHost != 0 {
+		config.MaxIdleConnsHost = *maxIdleConnsPerHost
+	}
+	if *maxConnsPerHost != 0 {
+		config.MaxConnsHost = *maxConnsPerHost
+	}
+	if *transferWindow != "" {
+		config.TransferWindow = *transferWindow
+	}
+	if *compress != "" {
+		config.Compress = *compress
+	}
+	if *sparse != "" {
+		config.Sparse = *sparse
+	}
+	if *partNameTemplate != "" {
+		config.PartNameTemplate = *partNameTemplate
+	}
+	if *ignoreCase {
+		config.IgnoreCase = true
+	}
+	if *sizeOnly {
+		config.SizeOnly = true
+	}
+	if *checksum {
+		config.Checksum = true
+	}
+	if *hashAlgorithm != "" {
+		config.Hash = *hashAlgorithm
+	}
+	if *flatten {
+		config.Flatten = *flattenPolicy
+	}
+	if *rewriteRules != "" {
+		config.RewriteRules = *rewriteRules
+	}
+	if *photos {
+		config.Photos = true
+	}
+	if *maxDepth != 0 {
+		config.MaxDepth = *maxDepth
+	}
+	if *noRecurse {
+		config.MaxDepth = 1
+	}
+	if *settle != 0 {
+		config.Settle = *settle
+	}
+	if *videoMetadata {
+		config.VideoMetadata = true
+	}
+	if *thumbnails {
+		config.Thumbnails = true
+	}
+	if *preserveMetadata {
+		config.PreserveMetadata = true
+	}
+	if *parity != 0 {
+		config.Parity = *parity
+	}
+	if *singlePass {
+		config.SinglePass = true
+	}
+	if *fairShare != "" {
+		config.FairShare = *fairShare
+	}
+	if smallFiles != 0 {
+		config.SmallFiles = smallFiles
+	}
+	if *smallTransfers != 0 {
+		config.SmallTransfers = *smallTransfers
+	}
+	if bufferSize != 0 {
+		config.BufferSize = bufferSize
+	}
+	if *spoolDir != "" {
+		config.SpoolDir = *spoolDir
+	}
+	if maxMemory != 0 {
+		config.MaxMemory = maxMemory
+	}
+	if minSpeed != 0 {
+		config.MinSpeed = minSpeed
+	}
+	if slowPart != 0 {
+		config.SlowPart = slowPart
+	}
+	if bwLimitFile != 0 {
+		config.BwLimitFile = bwLimitFile
+	}
+	if *stallTimeout > 0 {
+		config.StallTimeout = *stallTimeout
+	}
+	if *stallAction != "" {
+		config.StallAction = *stallAction
+	}
+	if *cleanupOnFailure {
+		config.CleanupOnFailure = true
+	}
+	if splitSize != 0 {
+		config.SplitSize = splitSize
+	}
+	if maxFileSize != 0 {
+		config.MaxFileSize = maxFileSize
+	}
+	if *oversize != "" {
+		config.Oversize = *oversize
+	}
+	if maxTransfer != 0 {
+		config.MaxTransfer = maxTransfer
+	}
+	if dailyBudget != 0 {
+		config.DailyBudget = dailyBudget
+	}
+	if *yes {
+		config.AssumeYes = true
+	}
+	if *lock != "" {
+		config.Lock = *lock
+	}
+	if config.Lock != "" && config.Lock != state.LockDest && config.Lock != state.LockGlobal {
+		fmt.Fprint(os.Stderr, i18n.Sprintf("Unknown lock %q, use dest or global\n", config.Lock))
+		return 2
+	}
+
+	if *noPreflight {
+		config.Preflight = false
+	}
+	preflight := cmd.NewPreflight()
+	if config.Preflight {
+		if err := preflight.Settings(config); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+			return 2
+		}
+	}
+
+	var destructive []string
+	if config.DeleteAfterUpload && *resume {
+		destructive = append(destructive, "delete the queued local files after uploading them")
+	} else if config.DeleteAfterUpload && !services.IsURL(*sourcePath) && !services.IsS3(*sourcePath) {
+		destructive = append(destructive, fmt.Sprintf("delete the local files of %s after uploading them", *sourcePath))
+	}
+	if config.SizeOnly {
+		destructive = append(destructive, fmt.Sprintf("replace the remote files of %s whose size differs from the uploaded ones", *destDir))
+	}
+	if config.Checksum {
+		destructive = append(destructive, fmt.Sprintf("replace the remote files of %s whose content changed since they were uploaded", *destDir))
+	}
+	if err := cmd.Confirm(destructive, config.AssumeYes); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	barTheme, knownTheme := pb.Themes[config.Theme]
+	if !knownTheme {
+		barTheme = pb.Themes["default"]
+	}
+	spinnerType := config.SpinnerType
+	if config.ASCII {
+		barTheme = pb.Themes["ascii"]
+		spinnerType = pb.ASCIISpinnerType
+	}
+
+	progressOptions := []pb.ProgressOption{
 		pb.OptionSetWriter(os.Stderr),
-		pb.OptionSetThrottle(65*time.Millisecond),
-	)
+		pb.OptionSetThrottle(65 * time.Millisecond),
+		pb.OptionSetBarTheme(barTheme),
+		pb.OptionSetSpinnerType(spinnerType),
+		pb.OptionSetStatusFile(config.StatusFile, config.StatusInterval),
+		pb.OptionShowInTerminalTitle(config.TerminalTitle),
+		pb.OptionSetSpeedWindow(config.SpeedWindow),
+		pb.OptionGroupBars(config.GroupBars),
+		pb.OptionShowParts(config.Verbose),
+	}
+	if config.EventsFile != "" {
+		events, err := os.Create(config.EventsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+			return 2
+		}
+		defer events.Close()
+		progressOptions = append(progressOptions, pb.OptionAddRenderer(pb.NewJSONRenderer(events, config.StatusInterval)))
+	}
+
+	var wg sync.WaitGroup
+	progress := pb.NewProgress(&wg, progressOptions...)
 
 	fs.GetConfig(context.TODO()).LogLevel = fs.LogLevelDebug
 	var log *zap.Logger
@@ -64,24 +441,198 @@ func main() {
 	} else {
 		log = logger.InitLogger()
 	}
+	runID := state.NewRunID()
+	log = log.With(zap.String("runId", runID))
+	defer log.Sync()
+	progress.SetRunID(runID)
+	progress.SetLogger(log)
+
 	fs.LogPrint = func(level fs.LogLevel, text string) {
 		log.Debug(text)
 	}
 
-	authCookie := &http.Cookie{
-		Name:  "user-session",
-		Value: config.SessionToken,
+	log = log.WithOptions(zap.WithFatalHook(fatalHandler{console: !config.Debug, notify: config.Notify}))
+
+	if *pprofAddr != "" {
+		diagnostics.StartPprofServer(*pprofAddr, log)
+	}
+	if *cpuProfile != "" {
+		stopCPUProfile, err := diagnostics.StartCPUProfile(*cpuProfile)
+		if err != nil {
+			log.Fatal("start cpu profile failed", zap.Error(err))
+		}
+		defer stopCPUProfile()
+	}
+
+	if !knownTheme {
+		log.Warn("unknown progress theme, using default", zap.String("theme", config.Theme))
 	}
 
 	ctx := context.Background()
 
-	httpClient := rest.NewClient(http.DefaultClient).SetRoot(config.ApiURL).SetCookie(authCookie)
+	if !services.ValidCompat(config.APICompat) {
+		log.Fatal("unknown api compatibility profile, use auto, v1.5, v1 or legacy", zap.String("apiCompat", config.APICompat))
+	}
+	if !transport.ValidHTTPVersion(config.HTTPVersion) {
+		log.Fatal("unknown http version, use 1.1 or 2", zap.String("httpVersion", config.HTTPVersion))
+	}
+	httpTransport := transport.New(config.TransportOptions())
+	if *failPartEvery > 0 || *injectLatency > 0 {
+		log.Warn("injecting faults into the requests to the server", zap.Int("failPartEvery", *failPartEvery), zap.Duration("latency", *injectLatency))
+		httpTransport = transport.NewFaultTransport(httpTransport, transport.Faults{FailPartEvery: *failPartEvery, Latency: *injectLatency}, log)
+	}
+	if config.Dump != "" {
+		dumpFlags, err := transport.ParseDumpFlags(config.Dump)
+		if err != nil {
+			log.Fatal("invalid dump flags", zap.Error(err))
+		}
+		httpTransport = transport.NewDumpTransport(httpTransport, dumpFlags, log)
+	}
+
+	shutdownTracing, err := tracing.Init(ctx, config.OtlpEndpoint, runID)
+	if err != nil {
+		log.Fatal("init tracing failed", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+	httpTransport = tracing.NewTransport(httpTransport)
+
+	httpClient := services.NewClient(config.ApiURL, config.SessionToken, config.APICompat, httpTransport).SetHeader("X-Run-Id", runID)
 
-	pacer := fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(400*time.Millisecond),
-		pacer.MaxSleep(5*time.Second), pacer.DecayConstant(2), pacer.AttackConstant(0)))
+	pacer := services.NewPacer(ctx)
 
 	// progress := mpb.New(mpb.WithWaitGroup(&wg))
 
+	uploadOptions := []services.UploadOption{
+		services.WithHistory(state.NewHistory(runID)),
+		services.WithQuota(int64(config.MaxTransfer), int64(config.DailyBudget)),
+		services.WithS3(config.S3Endpoint, config.S3Region),
+		services.WithMaxDepth(config.MaxDepth),
+		services.WithSettle(config.Settle),
+		services.WithSourceTransport(transport.New(config.TransportOptions())),
+	}
+	if bots := services.ParseBots(config.Bots); len(bots) > 0 {
+		uploadOptions = append(uploadOptions, services.WithBots(bots))
+	}
+	if config.ChannelMap != "" {
+		rules, err := services.ParseChannelMap(config.ChannelMap)
+		if err != nil {
+			log.Fatal("invalid channel map", zap.Error(err))
+		}
+		uploadOptions = append(uploadOptions, services.WithChannelMap(rules))
+	}
+	if config.PartNameTemplate != "" {
+		tmpl, err := services.ParsePartNameTemplate(config.PartNameTemplate)
+		if err != nil {
+			log.Fatal("invalid part name template", zap.Error(err))
+		}
+		uploadOptions = append(uploadOptions, services.WithPartNameTemplate(tmpl))
+	}
+	if config.IgnoreCase {
+		uploadOptions = append(uploadOptions, services.WithIgnoreCase())
+	}
+	if config.SizeOnly {
+		uploadOptions = append(uploadOptions, services.WithSizeOnly())
+	}
+	sessions, err := state.LoadSessionIndex(config.ApiURL)
+	if err != nil {
+		log.Fatal("load upload sessions failed", zap.Error(err))
+	}
+	uploadOptions = append(uploadOptions, services.WithSessionIndex(sessions))
+	if config.Checksum {
+		index, err := state.LoadHashIndex(config.ApiURL)
+		if err != nil {
+			log.Fatal("load hash index failed", zap.Error(err))
+		}
+		if !services.ValidHashAlgorithm(config.Hash) {
+			log.Fatal("unknown hash algorithm, use md5, sha256, blake3 or xxh3", zap.String("hash", config.Hash))
+		}
+		uploadOptions = append(uploadOptions, services.WithChecksum(index), services.WithHashAlgorithm(config.Hash))
+	}
+	if config.Flatten != "" {
+		if !services.ValidFlattenPolicy(config.Flatten) {
+			log.Fatal("unknown flatten policy, use suffix or prefix", zap.String("flatten", config.Flatten))
+		}
+		uploadOptions = append(uploadOptions, services.WithFlatten(config.Flatten))
+	}
+	if config.RewriteRules != "" {
+		rules, err := rewrite.Load(config.RewriteRules)
+		if err != nil {
+			log.Fatal("load rewrite rules failed", zap.Error(err))
+		}
+		uploadOptions = append(uploadOptions, services.WithRewriteRules(rules))
+	}
+	if config.VideoMetadata {
+		uploadOptions = append(uploadOptions, services.WithVideoMetadata())
+	}
+	if config.Thumbnails {
+		uploadOptions = append(uploadOptions, services.WithThumbnails())
+	}
+	if config.PreserveMetadata {
+		uploadOptions = append(uploadOptions, services.WithPreserveMetadata())
+	}
+	if config.Parity > 0 {
+		if _, err := exec.LookPath(services.Par2Command); err != nil {
+			log.Fatal("parity files need par2cmdline installed", zap.Error(err))
+		}
+		uploadOptions = append(uploadOptions, services.WithParity(config.Parity))
+	}
+	if config.SplitSize > 0 {
+		uploadOptions = append(uploadOptions, services.WithSplitSize(int64(config.SplitSize)))
+	}
+	if config.MaxFileSize > 0 {
+		if !services.ValidOversizeAction(config.Oversize) {
+			log.Fatal("unknown oversize action, use fail or split", zap.String("oversize", config.Oversize))
+		}
+		uploadOptions = append(uploadOptions, services.WithMaxFileSize(int64(config.MaxFileSize), config.Oversize))
+	}
+	if config.Compress != "" {
+		if !services.ValidCompression(config.Compress) {
+			log.Fatal("unknown compression, use zstd or gzip", zap.String("compress", config.Compress))
+		}
+		uploadOptions = append(uploadOptions, services.WithCompression(config.Compress))
+	}
+	if config.Sparse != "" {
+		if !services.ValidSparse(config.Sparse) {
+			log.Fatal("unknown sparse file handling, use warn or pack", zap.String("sparse", config.Sparse))
+		}
+		uploadOptions = append(uploadOptions, services.WithSparse(config.Sparse))
+	}
+	uploadOptions = append(uploadOptions,
+		services.WithPartTimeout(int64(config.MinSpeed), config.TimeoutSlack),
+		services.WithSlowPart(int64(config.SlowPart)),
+		services.WithFileBwLimit(int64(config.BwLimitFile)),
+		services.WithBufferSize(int64(config.BufferSize)),
+		services.WithSpoolDir(config.SpoolDir),
+		services.WithMaxMemory(int64(config.MaxMemory)),
+		services.WithListing(config.ListPageSize, config.ListConcurrency))
+	if config.SinglePass {
+		uploadOptions = append(uploadOptions, services.WithSinglePass())
+	}
+	if !services.ValidStallAction(config.StallAction) {
+		log.Fatal("unknown stall action, use retry or abort", zap.String("stallAction", config.StallAction))
+	}
+	uploadOptions = append(uploadOptions, services.WithStallTimeout(config.StallTimeout, config.StallAction))
+	uploadOptions = append(uploadOptions, services.WithCleanupOnFailure(config.CleanupOnFailure))
+	if config.Manifest != "" {
+		uploadOptions = append(uploadOptions, services.WithRunManifest())
+	}
+	if config.FairShare != "" {
+		if !services.ValidFairShare(config.FairShare) {
+			log.Fatal("unknown fair share policy, use equal or small-first", zap.String("fairShare", config.FairShare))
+		}
+		uploadOptions = append(uploadOptions, services.WithFairShare(config.FairShare))
+	}
+	if config.SmallFiles > 0 {
+		uploadOptions = append(uploadOptions, services.WithSmallFileLane(int64(config.SmallFiles), config.SmallTransfers))
+	}
+	if config.TransferWindow != "" {
+		window, err := services.ParseTransferWindow(config.TransferWindow)
+		if err != nil {
+			log.Fatal("invalid transfer window", zap.Error(err))
+		}
+		uploadOptions = append(uploadOptions, services.WithTransferWindow(window))
+	}
+
 	uploader := services.NewUploadService(
 		httpClient,
 		numWorkers,
@@ -96,36 +647,156 @@ func main() {
 		progress,
 		&wg,
 		log,
+		uploadOptions...,
 	)
+	defer uploader.Close()
 
-	path := *destDir
-	if len(path) == 0 || path[0] != '/' {
-		path = "/" + path
+	if config.Preflight {
+		// a resumed run checks the folders of its files as it creates them
+		dest := ""
+		if !*resume {
+			dest = config.DestPath(*destDir)
+		}
+		preflight.Server(uploader, config, dest, *noCreateDirs)
+		preflight.Local(config, *sourcePath)
+		preflight.Spool(config, numWorkers, numTransfers)
+		if err := preflight.Result(); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.T("Error:"), err)
+			return 1
+		}
 	}
 
-	err := uploader.CreateRemoteDir(path)
+	if config.Lock != "" {
+		// the files of a resumed run may go anywhere
+		lockDest := ""
+		if config.Lock == state.LockDest && !*resume {
+			lockDest = config.DestPath(*destDir)
+		}
+		lock, err := state.LockRun(ctx, config.ApiURL, lockDest, func() {
+			log.Info("another run is uploading to the destination, waiting for it to finish", zap.String("lock", config.Lock))
+		})
+		if err != nil {
+			log.Fatal("take the run lock failed", zap.Error(err))
+		}
+		defer lock.Unlock()
+	}
 
-	if err != nil {
+	stopWatching := watchConfig(ctx, config, uploader, *transferWindow != "", log)
+	defer stopWatching()
+
+	if *resume {
+		queued, err := state.LoadQueue()
+		if err != nil {
+			log.Fatal("load queued files failed", zap.Error(err))
+		}
+		if len(queued) == 0 {
+			log.Info("no queued files to resume")
+			return 0
+		}
+
+		dests := make([]string, 0, len(queued))
+		for _, file := range queued {
+			dests = append(dests, file.Dest)
+		}
+		if err := uploader.EnsureRemoteDirs(dests...); err != nil {
+			log.Fatal("create remote dir failed", zap.Error(err))
+		}
+		stopProgress := uploader.Progress.StartProgress()
+		for _, file := range queued {
+			src, err := uploader.OpenSource(file.Path)
+			if err != nil {
+				log.Error("get queued file info failed", zap.String("path", file.Path), zap.Error(err))
+				continue
+			}
+			uploader.Progress.AddTransfer(1, src.Size())
+			uploader.EnqueueFile(file.Path, file.Dest)
+		}
+		uploader.Progress.Wait()
+		stopProgress()
+		sendManifest(uploader, config.Manifest, log)
+
+		return finishQuota(uploader, log, true)
+	}
+
+	path := config.DestPath(*destDir)
+
+	if *noCreateDirs {
+		exists, err := uploader.RemoteDirExists(path)
+		if err != nil {
+			log.Fatal("check remote dir failed", zap.Error(err))
+		}
+		if !exists {
+			log.Fatal("remote dir doesn't exist", zap.String("dest", path))
+		}
+	} else if err := uploader.CreateRemoteDirs(path); err != nil {
 		log.Fatal("create remote dir failed", zap.Error(err))
 	}
 
 	stopProgress := uploader.Progress.StartProgress()
 
-	if fileInfo, err := os.Stat(*sourcePath); err == nil {
-		if fileInfo.IsDir() {
-			info, err := uploader.GetFilesInDirectoryInfo(*sourcePath)
+	if services.IsURL(*sourcePath) {
+		src, err := uploader.OpenSource(*sourcePath)
+		if err != nil {
+			log.Fatal("open source url failed", zap.Error(err))
+		}
+		if *destName != "" {
+			src = services.Rename(src, *destName)
+		}
+		uploader.Progress.AddTransfer(1, src.Size())
+		err = uploader.UploadSource(src, path)
+		if err != nil && !errors.Is(err, services.ErrQuotaExceeded) {
+			log.Fatal("upload failed", zap.Error(err))
+		}
+	} else if services.IsS3(*sourcePath) {
+		err = uploader.UploadS3(*sourcePath, path)
+		if err != nil {
+			log.Fatal("upload s3 objects failed", zap.Error(err))
+		}
+	} else if _, err := os.Stat(*sourcePath); err != nil && services.IsGlob(*sourcePath) {
+		// cmd and PowerShell leave the patterns to the programs
+		if *destName != "" {
+			log.Fatal("-dest-name only applies to single files", zap.String("path", *sourcePath))
+		}
+		matches, err := services.ExpandGlob(*sourcePath)
+		if err != nil {
+			log.Fatal("expand glob pattern failed", zap.Error(err))
+		}
+		if len(matches.Files) == 0 {
+			log.Warn("no files match the pattern", zap.String("path", *sourcePath))
+		}
+		uploader.Progress.AddTransfer(len(matches.Files), matches.Size)
+		if err := uploader.UploadGlob(matches, path); err != nil {
+			log.Fatal("upload matching files failed", zap.Error(err))
+		}
+	} else if fileInfo, err := os.Stat(*sourcePath); err == nil {
+		if fileInfo.IsDir() && *destName != "" {
+			log.Fatal("-dest-name only applies to single files", zap.String("path", *sourcePath))
+		}
+		if fileInfo.IsDir() && *archiveFormat != "" {
+			err = uploader.UploadArchive(*sourcePath, *archiveFormat, path)
 			if err != nil {
-				log.Fatal("get files in directory info failed", zap.Error(err))
+				log.Fatal("upload archive failed", zap.Error(err))
+			}
+		} else if fileInfo.IsDir() {
+			if config.Photos {
+				err = uploader.UploadPhotos(*sourcePath, path)
+			} else {
+				err = uploader.UploadFilesInDirectory(*sourcePath, path)
 			}
-			uploader.Progress.AddTransfer(info.TotalFiles, info.TotalSize)
-			err = uploader.UploadFilesInDirectory(*sourcePath, path)
 			if err != nil {
 				log.Fatal("upload files in directory failed", zap.Error(err))
 			}
 		} else {
 			uploader.Progress.AddTransfer(1, fileInfo.Size())
-			err := uploader.UploadFile(*sourcePath, path)
+			src, err := uploader.OpenSource(*sourcePath)
 			if err != nil {
+				log.Fatal("open source failed", zap.Error(err))
+			}
+			if *destName != "" {
+				src = services.Rename(src, *destName)
+			}
+			err = uploader.UploadSource(src, path)
+			if err != nil && !errors.Is(err, services.ErrQuotaExceeded) {
 				log.Fatal("upload failed", zap.Error(err))
 			}
 		}
@@ -134,6 +805,174 @@ func main() {
 	}
 	uploader.Progress.Wait()
 	stopProgress()
+	sendManifest(uploader, config.Manifest, log)
 
+	if uploader.Stalled() {
+		log.Error("upload cancelled, no data was sent", zap.Duration("for", config.StallTimeout))
+		return exitStalled
+	}
 	log.Info("uploads complete!")
+
+	if *memProfile != "" {
+		if err := diagnostics.WriteMemProfile(*memProfile); err != nil {
+			log.Error("write memory profile failed", zap.Error(err))
+		}
+	}
+	if config.Debug || *pprofAddr != "" {
+		diagnostics.LogRuntimeStats(log)
+	}
+
+	if config.Notify {
+		status := uploader.Progress.Status()
+		title := i18n.T("Upload finished")
+		if status.Failed > 0 {
+			title = i18n.T("Upload finished with errors")
+		}
+		message := i18n.Sprintf("%d uploaded, %d already present, %d failed", status.Uploaded, status.Existing, status.Failed)
+		if err := notify.Send(title, message); err != nil {
+			log.Warn("send desktop notification failed", zap.Error(err))
+		}
+	}
+
+	return finishQuota(uploader, log, false)
+}
+
+// configReloadInterval is how often upload.env is checked for changes
+// during a run.
+const configReloadInterval = 5 * time.Second
+
+// watchConfig applies the changes of upload.env that are safe while
+// uploading, the log level and the transfer window unless set by an
+// option, and returns the function stopping it.
+func watchConfig(ctx context.Context, cfg *config.Config, uploader *services.UploadService, windowFlag bool, log *zap.Logger) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	debug, transferWindow := cfg.Debug, cfg.TransferWindow
+	go config.Watch(ctx, configReloadInterval, func(c *config.Config, err error) {
+		if err != nil {
+			log.Warn("reload configuration failed, keeping the current one", zap.Error(err))
+			return
+		}
+		if c.Debug != debug {
+			debug = c.Debug
+			logger.SetDebug(c.Debug)
+			log.Info("configuration reloaded", zap.Bool("debug", c.Debug))
+		}
+		if c.TransferWindow != transferWindow && !windowFlag {
+			var window *services.TransferWindow
+			if c.TransferWindow != "" {
+				if window, err = services.ParseTransferWindow(c.TransferWindow); err != nil {
+					log.Warn("reload transfer window failed, keeping the current one", zap.Error(err))
+					return
+				}
+			}
+			transferWindow = c.TransferWindow
+			uploader.SetTransferWindow(window)
+			log.Info("configuration reloaded", zap.String("transferWindow", c.TransferWindow))
+		}
+	})
+	return cancel
+}
+
+// sendManifest writes or posts the files uploaded by the run to target, if
+// set. A failure is logged, the files are uploaded anyway.
+func sendManifest(uploader *services.UploadService, target string, log *zap.Logger) {
+	if target == "" {
+		return
+	}
+	m := uploader.RunManifest()
+	if err := services.SendRunManifest(m, target); err != nil {
+		log.Error("send manifest failed", zap.String("target", target), zap.Error(err))
+		return
+	}
+	log.Info("manifest sent", zap.String("target", target), zap.Int("files", len(m.Files)))
+}
+
+// finishQuota saves the files left out by the transfer quota for a later
+// -resume run and returns the exit code of the run. A resumed run tried
+// every queued file, so it queues the ones failing again along with the
+// ones left out, and clears the saved queue when there are none. Another
+// run keeps the failures queued by a resumed run.
+func finishQuota(uploader *services.UploadService, log *zap.Logger, resumed bool) int {
+	remaining := uploader.RemainingFiles()
+	if resumed {
+		remaining = append(remaining, uploader.FailedFiles()...)
+	} else if !uploader.QuotaExceeded() {
+		return 0
+	} else if queued, err := state.LoadQueue(); err != nil {
+		log.Warn("load queued files failed", zap.Error(err))
+	} else {
+		for _, file := range queued {
+			if file.Error != services.ErrQuotaExceeded.Error() {
+				remaining = append(remaining, file)
+			}
+		}
+	}
+
+	if len(remaining) == 0 {
+		if err := state.ClearQueue(); err != nil {
+			log.Warn("clear queued files failed", zap.Error(err))
+		}
+		return 0
+	}
+	if err := state.SaveQueue(remaining); err != nil {
+		log.Error("save queued files failed", zap.Error(err))
+	}
+	if !uploader.QuotaExceeded() {
+		log.Warn("queued files failed again, run with -resume to retry them", zap.Int("remainingFiles", len(remaining)))
+		return 0
+	}
+	log.Warn("transfer quota reached, run with -resume to upload the remaining files", zap.Int("remainingFiles", len(remaining)))
+	return exitQuotaExceeded
+}
+
+// hiddenFlags are the developer flags left out of the usage.
+var hiddenFlags = map[string]bool{
+	"fail-part-every": true,
+	"inject-latency":  true,
+}
+
+func usage() {
+	binary := "./uploader"
+	if runtime.GOOS == "windows" {
+		binary = "./uploader.exe"
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s -path <file_or_directory_path> -dest <remote_directory>\n", binary)
+	fmt.Fprintf(os.Stderr, "       %s <command> [options]\n\n", binary)
+	cmd.PrintCommands(os.Stderr)
+	fmt.Fprintln(os.Stderr, "\nUpload options:")
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(os.Stderr)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// fatalHandler shows the error of a fatal log to the user, in their
+// language, before it exits the program: on the console, which only shows
+// the log in debug mode, and in a desktop notification.
+type fatalHandler struct {
+	console bool
+	notify  bool
+}
+
+func (h fatalHandler) OnWrite(ce *zapcore.CheckedEntry, fields []zapcore.Field) {
+	message := i18n.T(ce.Message)
+	for _, field := range fields {
+		switch {
+		case field.Type == zapcore.ErrorType:
+			message += ": " + field.Interface.(error).Error()
+		case field.Type == zapcore.StringType:
+			message += " (" + field.String + ")"
+		}
+	}
+	if h.console {
+		fmt.Fprintln(os.Stderr, i18n.T("Error:"), message)
+	}
+	if h.notify {
+		notify.Send(i18n.T("Upload failed"), message)
+	}
+	os.Exit(1)
 }
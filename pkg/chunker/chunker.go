@@ -0,0 +1,77 @@
+// Package chunker splits a stream into content-defined chunks, so an insert
+// or a removal in a file only changes the chunks around it.
+package chunker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const (
+	// MinSize is the smallest chunk, except for the last one of a stream.
+	MinSize = 1 << 20
+	// AvgSize is the expected chunk size.
+	AvgSize = 4 << 20
+	// MaxSize is the biggest chunk.
+	MaxSize = 16 << 20
+)
+
+// gear maps every byte to a random value for the rolling gear hash.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed, the table must never change or the
+	// chunk boundaries of already stored data would move
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker reads a stream and returns it chunk by chunk.
+type Chunker struct {
+	r    *bufio.Reader
+	mask uint64
+	buf  []byte
+}
+
+// New returns a chunker reading from r.
+func New(r io.Reader) *Chunker {
+	maskBits := bits.Len(AvgSize) - 1
+	return &Chunker{
+		r:    bufio.NewReaderSize(r, 1<<20),
+		mask: (1<<maskBits - 1) << (64 - maskBits),
+		buf:  make([]byte, 0, MaxSize),
+	}
+}
+
+// Next returns the next chunk, which is only valid until the following
+// call, or io.EOF at the end of the stream.
+func (c *Chunker) Next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var hash uint64
+	for len(c.buf) < MaxSize {
+		b, err := c.r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			if len(c.buf) == 0 {
+				return nil, io.EOF
+			}
+			return c.buf, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		hash = hash<<1 + gear[b]
+		if len(c.buf) >= MinSize && hash&c.mask == 0 {
+			break
+		}
+	}
+	return c.buf, nil
+}
@@ -0,0 +1,10 @@
+// Package consts holds the build information set by the release builds.
+package consts
+
+// Set with -ldflags "-X uploader/pkg/consts.Version=..." when building a
+// release.
+var (
+	Version    = "dev"
+	Commit     = ""
+	CommitDate = ""
+)
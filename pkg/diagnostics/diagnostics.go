@@ -0,0 +1,73 @@
+// Package diagnostics exposes profiling helpers for tuning high throughput runs.
+package diagnostics
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+
+	"go.uber.org/zap"
+)
+
+// StartPprofServer serves the net/http/pprof handlers on addr in the
+// background, along with the expvar counters at /debug/vars.
+func StartPprofServer(addr string, logger *zap.Logger) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		logger.Info("pprof server listening", zap.String("addr", addr))
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("pprof server failed", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+}
+
+// StartCPUProfile writes a CPU profile to path until the returned function is called.
+func StartCPUProfile(path string) (func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := runtimepprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		runtimepprof.StopCPUProfile()
+		return f.Close()
+	}, nil
+}
+
+// WriteMemProfile writes a heap profile to path.
+func WriteMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	runtime.GC()
+	return runtimepprof.WriteHeapProfile(f)
+}
+
+// LogRuntimeStats logs goroutine and memory usage counters.
+func LogRuntimeStats(logger *zap.Logger) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	logger.Info("runtime stats",
+		zap.Int("goroutines", runtime.NumGoroutine()),
+		zap.Uint64("heapAlloc", m.HeapAlloc),
+		zap.Uint64("heapSys", m.HeapSys),
+		zap.Uint64("totalAlloc", m.TotalAlloc),
+		zap.Uint32("numGC", m.NumGC),
+	)
+}
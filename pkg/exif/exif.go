@@ -0,0 +1,152 @@
+// Package exif reads the capture date of photos from their EXIF data.
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoDate is returned when a file has no readable EXIF date.
+var ErrNoDate = errors.New("exif: no capture date")
+
+const (
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+// DateTaken returns when the photo at filePath was taken, read from the
+// EXIF data of JPEG files and TIFF based raw files (DNG, CR2, NEF, ARW...).
+// EXIF dates have no time zone, they are returned in the local one.
+func DateTaken(filePath string) (time.Time, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil {
+		return time.Time{}, ErrNoDate
+	}
+	switch {
+	case magic[0] == 0xff && magic[1] == 0xd8:
+		tiff, err := jpegExif(r)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return tiffDate(bytes.NewReader(tiff))
+	case string(magic) == "II*\x00", string(magic) == "MM\x00*":
+		return tiffDate(f)
+	}
+	return time.Time{}, ErrNoDate
+}
+
+// jpegExif returns the TIFF structure of the Exif APP1 segment.
+func jpegExif(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(2); err != nil {
+		return nil, err
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, ErrNoDate
+		}
+		if marker[0] != 0xff {
+			return nil, ErrNoDate
+		}
+		// start of scan, the metadata segments are over
+		if marker[1] == 0xda {
+			return nil, ErrNoDate
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, ErrNoDate
+		}
+		if marker[1] != 0xe1 {
+			if _, err := r.Discard(length); err != nil {
+				return nil, ErrNoDate
+			}
+			continue
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrNoDate
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// tiffDate returns DateTimeOriginal, or DateTime if missing, of a TIFF
+// structure.
+func tiffDate(r io.ReaderAt) (time.Time, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return time.Time{}, ErrNoDate
+	}
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, ErrNoDate
+	}
+
+	ifd0 := readIFD(r, order, int64(order.Uint32(header[4:])))
+	if offset, ok := ifd0[tagExifIFD]; ok {
+		exifIFD := readIFD(r, order, int64(order.Uint32(offset)))
+		if t, err := readDate(r, order, exifIFD[tagDateTimeOriginal]); err == nil {
+			return t, nil
+		}
+	}
+	return readDate(r, order, ifd0[tagDateTime])
+}
+
+// readIFD returns the 4 byte value or offset field of every entry of the
+// image file directory at offset.
+func readIFD(r io.ReaderAt, order binary.ByteOrder, offset int64) map[uint16][]byte {
+	entries := map[uint16][]byte{}
+	count := make([]byte, 2)
+	if _, err := r.ReadAt(count, offset); err != nil {
+		return entries
+	}
+	n := int(order.Uint16(count))
+	buf := make([]byte, 12*n)
+	if _, err := r.ReadAt(buf, offset+2); err != nil {
+		return entries
+	}
+	for i := 0; i < n; i++ {
+		entry := buf[i*12 : i*12+12]
+		entries[order.Uint16(entry[:2])] = entry[8:12]
+	}
+	return entries
+}
+
+// readDate reads an ASCII date entry, "2006:01:02 15:04:05" stored at the
+// offset of the entry value.
+func readDate(r io.ReaderAt, order binary.ByteOrder, value []byte) (time.Time, error) {
+	if value == nil {
+		return time.Time{}, ErrNoDate
+	}
+	buf := make([]byte, 19)
+	if _, err := r.ReadAt(buf, int64(order.Uint32(value))); err != nil {
+		return time.Time{}, ErrNoDate
+	}
+	s := strings.TrimRight(string(buf), "\x00 ")
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+	if err != nil || t.Year() < 1900 {
+		return time.Time{}, ErrNoDate
+	}
+	return t, nil
+}
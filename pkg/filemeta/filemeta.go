@@ -0,0 +1,54 @@
+// Package filemeta captures and restores the file system metadata of files:
+// permissions, ownership, modification time and extended attributes.
+package filemeta
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Metadata is the file system metadata of a file. Ownership and extended
+// attributes are only captured on Linux and macOS.
+type Metadata struct {
+	Mode    fs.FileMode       `json:"mode"`
+	UID     *int              `json:"uid,omitempty"`
+	GID     *int              `json:"gid,omitempty"`
+	User    string            `json:"user,omitempty"`
+	Group   string            `json:"group,omitempty"`
+	ModTime time.Time         `json:"modTime"`
+	Xattrs  map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// Capture returns the metadata of the file at path.
+func Capture(path string) (*Metadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{Mode: info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky), ModTime: info.ModTime()}
+	if err := capturePlatform(path, info, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Apply restores m on the file at path. Everything that can be restored is,
+// and the errors of the rest are joined, e.g. changing the owner without
+// the privileges to do so.
+func Apply(path string, m *Metadata) error {
+	var errs []error
+	if err := os.Chmod(path, m.Mode); err != nil {
+		errs = append(errs, err)
+	}
+	if err := applyPlatform(path, m); err != nil {
+		errs = append(errs, err)
+	}
+	if !m.ModTime.IsZero() {
+		if err := os.Chtimes(path, m.ModTime, m.ModTime); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package filemeta
+
+import "io/fs"
+
+func capturePlatform(path string, info fs.FileInfo, m *Metadata) error {
+	return nil
+}
+
+func applyPlatform(path string, m *Metadata) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+//go:build linux || darwin
+
+package filemeta
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func capturePlatform(path string, info fs.FileInfo, m *Metadata) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid := int(st.Uid), int(st.Gid)
+		m.UID, m.GID = &uid, &gid
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			m.User = u.Username
+		}
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			m.Group = g.Name
+		}
+	}
+
+	names, err := listXattrs(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err != nil {
+			return err
+		}
+		if m.Xattrs == nil {
+			m.Xattrs = map[string][]byte{}
+		}
+		m.Xattrs[name] = value
+	}
+	return nil
+}
+
+// applyPlatform restores the owner, by name if it exists here or by ID
+// otherwise, and the extended attributes.
+func applyPlatform(path string, m *Metadata) error {
+	var errs []error
+	if m.UID != nil && m.GID != nil {
+		uid, gid := *m.UID, *m.GID
+		if u, err := user.Lookup(m.User); m.User != "" && err == nil {
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+		if g, err := user.LookupGroup(m.Group); m.Group != "" && err == nil {
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, value := range m.Xattrs {
+		if err := unix.Setxattr(path, name, value, 0); err != nil {
+			errs = append(errs, &os.PathError{Op: "setxattr " + name, Path: path, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Getxattr(path, name, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,112 @@
+package i18n
+
+// spanish translates the messages shown to the user into Spanish.
+var spanish = map[string]string{
+	// progress summary
+	"Transferred: %s%s / %s%s%s, %d%%, %s%s/s, ETA %s": "Transferido: %s%s / %s%s%s, %d%%, %s%s/s, ETA %s",
+	"Transferred: %d / %d files%s, %d%%":               "Transferido: %d / %d archivos%s, %d%%",
+	"Checked: %d (already uploaded)\n":                 "Comprobados: %d (ya subidos)\n",
+	"Failed: %d (%s%s, left out of the totals)\n":      "Fallidos: %d (%s%s, fuera de los totales)\n",
+	"Elapsed time: %s":                                 "Tiempo transcurrido: %s",
+	"Transferring:":                                    "Transfiriendo:",
+	" (scanning…)":                                     " (explorando…)",
+	"%s: %d / %d files, %s%s / %s%s, %d%%":             "%s: %d / %d archivos, %s%s / %s%s, %d%%",
+
+	// phases
+	"listing %s":                          "listando %s",
+	"hashing %s":                          "calculando el hash de %s",
+	"looking up the upload session of %s": "buscando la sesión de subida de %s",
+	"finalizing %s":                       "finalizando %s",
+
+	// usage errors
+	"The -dest-name must be a file name, without folders": "El -dest-name debe ser un nombre de archivo, sin carpetas",
+	"Use either -http1 or -http2":                         "Usa -http1 o -http2, no ambos",
+	"Unknown archive format %q, use one of: %s\n":         "Formato de archivo comprimido %q desconocido, usa uno de: %s\n",
+	"Unknown lock %q, use dest or global\n":               "Bloqueo %q desconocido, usa dest o global\n",
+	"Unknown language %q, use auto, en or es\n":           "Idioma %q desconocido, usa auto, en o es\n",
+
+	// configuration and preflight checks
+	"ok":                                     "ok",
+	"warning":                                "aviso",
+	"error":                                  "error",
+	"%d problems found in the configuration": "%d problemas encontrados en la configuración",
+	"%d problems found before uploading, nothing was sent": "%d problemas encontrados antes de subir, no se envió nada",
+	"configuration can't be read: %v":                      "no se pudo leer la configuración: %v",
+	"server %s accepts the session token":                  "el servidor %s acepta el token de sesión",
+	"server %s can't be listed, check API_URL and SESSION_TOKEN, which expires with the Teldrive session: %v": "no se pudo listar el servidor %s, revisa API_URL y SESSION_TOKEN, que caduca con la sesión de Teldrive: %v",
+	"channels can't be listed to check them: %v":                                                              "no se pudieron listar los canales para comprobarlos: %v",
+	"%s %d is a channel of the user":                                                                          "%s %d es un canal del usuario",
+	"%s %d isn't a channel of the user, pick one of the channels shown in the Teldrive settings":              "%s %d no es un canal del usuario, elige uno de los canales de los ajustes de Teldrive",
+	"CHANNEL_ID is unset, the default channel set in the Teldrive settings is used":                           "CHANNEL_ID no está definido, se usa el canal por defecto de los ajustes de Teldrive",
+	"PART_SIZE %s is bigger than the 2000Mi Telegram accepts, lower it":                                       "PART_SIZE %s es mayor que los 2000Mi que acepta Telegram, redúcelo",
+	"PART_SIZE %s is small, files are split in many parts and upload slowly":                                  "PART_SIZE %s es pequeño, los archivos se dividen en muchas partes y suben despacio",
+	"WORKERS %d and TRANSFERS %d must be at least 1":                                                          "WORKERS %d y TRANSFERS %d deben ser al menos 1",
+	"WORKERS %d times TRANSFERS %d sends %d parts at once, Telegram may rate limit the uploads":               "WORKERS %d por TRANSFERS %d envía %d partes a la vez, Telegram puede limitar las subidas",
+	"SPINNER_TYPE must be 0..%d":                                                                              "SPINNER_TYPE debe estar entre 0 y %d",
+	"LIST_PAGE_SIZE %d and LIST_CONCURRENCY %d must be at least 1":                                            "LIST_PAGE_SIZE %d y LIST_CONCURRENCY %d deben ser al menos 1",
+	"%s %q is unknown, use %s":                                                                                "%s %q desconocido, usa %s",
+	"equal or small-first":                                                                                    "equal o small-first",
+	"suffix or prefix":                                                                                        "suffix o prefix",
+	"zstd or gzip":                                                                                            "zstd o gzip",
+	"warn or pack":                                                                                            "warn o pack",
+	"auto, v1.5, v1 or legacy":                                                                                "auto, v1.5, v1 o legacy",
+	"1.1 or 2":                                                                                                "1.1 o 2",
+	"retry or abort":                                                                                          "retry o abort",
+	"fail or split":                                                                                           "fail o split",
+	"md5, sha256, blake3 or xxh3":                                                                             "md5, sha256, blake3 o xxh3",
+	"auto, en or es":                                                                                          "auto, en o es",
+	"dest or global":                                                                                          "dest o global",
+	"%s %s can't be written, the folder %s doesn't exist":                                                     "%s %s no se puede escribir, la carpeta %s no existe",
+	"destination %s doesn't exist, create it or drop -no-create-dirs":                                         "el destino %s no existe, créalo o quita -no-create-dirs",
+	"destination %s can't be checked: %v":                                                                     "no se pudo comprobar el destino %s: %v",
+	"destination %s can't be created, %s is a file":                                                           "no se puede crear el destino %s, %s es un archivo",
+	"SPOOL_DIR %s can't be written: %v":                                                                       "no se puede escribir en SPOOL_DIR %s: %v",
+	"free space of SPOOL_DIR %s can't be checked: %v":                                                         "no se pudo comprobar el espacio libre de SPOOL_DIR %s: %v",
+	"SPOOL_DIR %s may need %s for the parts of %d workers of %d transfers, only %s is free":                         "SPOOL_DIR %s puede necesitar %s para las partes de %d workers de %d transferencias, solo hay %s libres",
+	"the temporary folder %s for the PARITY files can't be written, set TMPDIR (TMP on Windows) to another one: %v": "no se puede escribir en la carpeta temporal %s de los archivos de PARITY, define TMPDIR (TMP en Windows) con otra: %v",
+	"free space of the temporary folder %s can't be checked: %v":                                                    "no se pudo comprobar el espacio libre de la carpeta temporal %s: %v",
+	"PARITY %d%% of %s needs %s in the temporary folder %s, only %s is free":                                        "PARITY %d%% de %s necesita %s en la carpeta temporal %s, solo hay %s libres",
+
+	// errors ending the run
+	"Error:":                   "Error:",
+	"start cpu profile failed": "no se pudo iniciar el perfil de CPU",
+	"unknown api compatibility profile, use auto, v1.5, v1 or legacy": "perfil de compatibilidad de la API desconocido, usa auto, v1.5, v1 o legacy",
+	"unknown http version, use 1.1 or 2":                              "versión de HTTP desconocida, usa 1.1 o 2",
+	"invalid dump flags":                                              "opciones de DUMP no válidas",
+	"init tracing failed":                                             "no se pudo iniciar el trazado",
+	"invalid channel map":                                             "mapa de canales no válido",
+	"invalid part name template":                                      "plantilla de nombre de las partes no válida",
+	"load upload sessions failed":                                     "no se pudieron cargar las sesiones de subida",
+	"load hash index failed":                                          "no se pudo cargar el índice de hashes",
+	"unknown hash algorithm, use md5, sha256, blake3 or xxh3":         "algoritmo de hash desconocido, usa md5, sha256, blake3 o xxh3",
+	"unknown flatten policy, use suffix or prefix":                    "política de aplanado desconocida, usa suffix o prefix",
+	"load rewrite rules failed":                                       "no se pudieron cargar las reglas de reescritura",
+	"parity files need par2cmdline installed":                         "los archivos de paridad necesitan tener par2cmdline instalado",
+	"unknown oversize action, use fail or split":                      "acción para archivos demasiado grandes desconocida, usa fail o split",
+	"unknown compression, use zstd or gzip":                           "compresión desconocida, usa zstd o gzip",
+	"unknown sparse file handling, use warn or pack":                  "tratamiento de archivos dispersos desconocido, usa warn o pack",
+	"unknown stall action, use retry or abort":                        "acción ante bloqueos desconocida, usa retry o abort",
+	"unknown fair share policy, use equal or small-first":             "política de reparto desconocida, usa equal o small-first",
+	"invalid transfer window":                                         "ventana de transferencia no válida",
+	"take the run lock failed":                                        "no se pudo tomar el bloqueo de la ejecución",
+	"load queued files failed":                                        "no se pudieron cargar los archivos en cola",
+	"create remote dir failed":                                        "no se pudo crear la carpeta remota",
+	"check remote dir failed":                                         "no se pudo comprobar la carpeta remota",
+	"remote dir doesn't exist":                                        "la carpeta remota no existe",
+	"open source url failed":                                          "no se pudo abrir la URL de origen",
+	"upload failed":                                                   "la subida falló",
+	"upload s3 objects failed":                                        "no se pudieron subir los objetos de S3",
+	"-dest-name only applies to single files":                         "-dest-name solo se aplica a archivos sueltos",
+	"expand glob pattern failed":                                      "no se pudo expandir el patrón",
+	"upload matching files failed":                                    "no se pudieron subir los archivos coincidentes",
+	"upload archive failed":                                           "no se pudo subir el archivo comprimido",
+	"upload files in directory failed":                                "no se pudieron subir los archivos de la carpeta",
+	"open source failed":                                              "no se pudo abrir el origen",
+	"get sourcePath info failed":                                      "no se pudo leer la información del origen",
+
+	// desktop notifications
+	"Upload finished":                            "Subida terminada",
+	"Upload finished with errors":                "Subida terminada con errores",
+	"%d uploaded, %d already present, %d failed": "%d subidos, %d ya presentes, %d fallidos",
+	"Upload failed":                              "La subida falló",
+}
@@ -0,0 +1,77 @@
+// Package i18n translates the messages shown to the user, like the progress
+// summary and the errors ending a run, while the log keeps them in English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Languages of SetLanguage.
+const (
+	// Auto picks the language of the LC_ALL, LC_MESSAGES or LANG
+	// environment variables
+	Auto    = "auto"
+	English = "en"
+	Spanish = "es"
+)
+
+// catalogs map the English messages to their translations, by language.
+var catalogs = map[string]map[string]string{
+	Spanish: spanish,
+}
+
+// language is the language of the messages, set once at start.
+var language = English
+
+// Valid reports whether lang is auto or a known language.
+func Valid(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok || lang == Auto || lang == English
+}
+
+// SetLanguage shows the messages in lang, falling back to English for
+// unknown languages.
+func SetLanguage(lang string) {
+	if lang == Auto {
+		lang = fromEnv()
+	}
+	if !Valid(lang) || lang == Auto {
+		lang = English
+	}
+	language = lang
+}
+
+// Language returns the language of the messages.
+func Language() string {
+	return language
+}
+
+// fromEnv returns the language of the locale set in the environment, e.g. es
+// for es_ES.UTF-8, or English.
+func fromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		lang, _, _ := strings.Cut(locale, "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		return strings.ToLower(lang)
+	}
+	return English
+}
+
+// T returns the translation of msg, or msg itself when it has none.
+func T(msg string) string {
+	if translated, ok := catalogs[language][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// Sprintf formats the translation of format.
+func Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(T(format), args...)
+}
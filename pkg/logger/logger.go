@@ -11,6 +11,19 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// level is the level of the loggers, changed by SetDebug.
+var level = zap.NewAtomicLevel()
+
+// SetDebug switches the loggers to the debug level or back to info while
+// running.
+func SetDebug(debug bool) {
+	if debug {
+		level.SetLevel(zap.DebugLevel)
+	} else {
+		level.SetLevel(zap.InfoLevel)
+	}
+}
+
 type ProgressWriterAdapter struct {
 	Progress *pb.Progress
 }
@@ -25,19 +38,18 @@ func InitLogger(options ...LoggerOption) *zap.Logger {
 	customTimeEncoder := func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.Format("02/01/2006 03:04:00.000 PM"))
 	}
-	var (
-		consoleConfig zapcore.EncoderConfig
-		logLevel      zapcore.Level
-	)
+	var consoleConfig zapcore.EncoderConfig
 
 	if config.GetConfig().Debug {
 		consoleConfig = zap.NewDevelopmentEncoderConfig()
-		logLevel = zap.DebugLevel
 	} else {
 		consoleConfig = zap.NewProductionEncoderConfig()
-		logLevel = zap.InfoLevel
 	}
+	SetDebug(config.GetConfig().Debug)
 	consoleConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if pb.NoColor() {
+		consoleConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
 	consoleConfig.EncodeTime = customTimeEncoder
 	consoleEncoder := zapcore.NewConsoleEncoder(consoleConfig)
 
@@ -57,11 +69,11 @@ func InitLogger(options ...LoggerOption) *zap.Logger {
 
 	for _, o := range options {
 		w := o()
-		consoleZapCore := zapcore.NewCore(consoleEncoder, zapcore.AddSync(w), logLevel)
+		consoleZapCore := zapcore.NewCore(consoleEncoder, zapcore.AddSync(w), level)
 		writers = append(writers, consoleZapCore)
 	}
 
-	fileZapCore := zapcore.NewCore(fileEncoder, fileWriter, logLevel)
+	fileZapCore := zapcore.NewCore(fileEncoder, fileWriter, level)
 	writers = append(writers, fileZapCore)
 
 	core := zapcore.NewTee(
@@ -69,7 +81,7 @@ func InitLogger(options ...LoggerOption) *zap.Logger {
 	// zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), logLevel),
 	)
 
-	return zap.New(core, zap.AddStacktrace(zapcore.FatalLevel))
+	return zap.New(newRepeatCore(core), zap.AddStacktrace(zapcore.FatalLevel))
 }
 
 type LoggerOption func() io.Writer
@@ -0,0 +1,180 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// repeatWindow is how long identical warnings and errors are counted
+// instead of logged, after the first one.
+const repeatWindow = time.Minute
+
+// urlPattern matches the URLs in error messages, which name the file or
+// upload session and would keep the errors of an outage from matching.
+var urlPattern = regexp.MustCompile(`https?://[^\s"]+`)
+
+// repeat counts the entries matching one logged within repeatWindow.
+type repeat struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+	count  int
+}
+
+// repeats are the windows of the warnings and errors logged, shared by the
+// cores derived with With. timer logs the repeats of the oldest window
+// when it ends, while there are windows.
+type repeats struct {
+	mu      sync.Mutex
+	windows map[string]*repeat
+	timer   *time.Timer
+}
+
+// repeatCore logs the first of identical warnings and errors, same message,
+// error and fields, and then how many times it repeated once repeatWindow
+// passed, so outages answering every request with the same error don't
+// flood the terminal and the log file.
+type repeatCore struct {
+	zapcore.Core
+	repeats *repeats
+	// context are the fields added with With, part of the key of entries
+	context []zapcore.Field
+}
+
+func newRepeatCore(core zapcore.Core) zapcore.Core {
+	return &repeatCore{Core: core, repeats: &repeats{windows: map[string]*repeat{}}}
+}
+
+func (c *repeatCore) With(fields []zapcore.Field) zapcore.Core {
+	context := append(append([]zapcore.Field{}, c.context...), fields...)
+	return &repeatCore{Core: c.Core.With(fields), repeats: c.repeats, context: context}
+}
+
+func (c *repeatCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *repeatCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	// a fatal entry ends the run, the repeats wouldn't be logged later
+	c.flush(entry.Time, entry.Level > zapcore.ErrorLevel)
+	if entry.Level != zapcore.WarnLevel && entry.Level != zapcore.ErrorLevel {
+		return c.Core.Write(entry, fields)
+	}
+	key := entry.Level.String() + "\x00" + entry.Message + "\x00" + fieldsKey(c.context) + "\x00" + fieldsKey(fields)
+
+	c.repeats.mu.Lock()
+	r, ok := c.repeats.windows[key]
+	if ok {
+		r.count++
+	} else {
+		c.repeats.windows[key] = &repeat{core: c.Core, entry: entry, fields: fields}
+		if c.repeats.timer == nil {
+			c.repeats.timer = time.AfterFunc(repeatWindow, c.flushTimer)
+		}
+	}
+	c.repeats.mu.Unlock()
+	if ok {
+		return nil
+	}
+	return c.Core.Write(entry, fields)
+}
+
+// Sync logs the repeats counted so far before syncing.
+func (c *repeatCore) Sync() error {
+	c.flush(time.Now(), true)
+	return c.Core.Sync()
+}
+
+// flush logs the repeats of the windows ended at now, or of all of them.
+func (c *repeatCore) flush(now time.Time, all bool) {
+	c.repeats.mu.Lock()
+	ended := c.repeats.ended(now, all)
+	c.repeats.mu.Unlock()
+	writeRepeated(ended)
+}
+
+// flushTimer logs the repeats of the windows ended, and waits for the end
+// of the oldest one left.
+func (c *repeatCore) flushTimer() {
+	now := time.Now()
+	c.repeats.mu.Lock()
+	ended := c.repeats.ended(now, false)
+	c.repeats.timer = nil
+	var oldest time.Time
+	for _, window := range c.repeats.windows {
+		if oldest.IsZero() || window.entry.Time.Before(oldest) {
+			oldest = window.entry.Time
+		}
+	}
+	if !oldest.IsZero() {
+		c.repeats.timer = time.AfterFunc(max(oldest.Add(repeatWindow).Sub(now), 0), c.flushTimer)
+	}
+	c.repeats.mu.Unlock()
+	writeRepeated(ended)
+}
+
+// ended removes the windows ended at now, or all of them, returning the ones
+// with repeats to log.
+func (r *repeats) ended(now time.Time, all bool) []*repeat {
+	var ended []*repeat
+	for key, window := range r.windows {
+		if !all && now.Sub(window.entry.Time) < repeatWindow {
+			continue
+		}
+		delete(r.windows, key)
+		if window.count > 0 {
+			ended = append(ended, window)
+		}
+	}
+	return ended
+}
+
+// writeRepeated logs how many times the entries of ended repeated.
+func writeRepeated(ended []*repeat) {
+	for _, r := range ended {
+		entry := r.entry
+		entry.Time = time.Now()
+		entry.Message = fmt.Sprintf("%s repeated %d times in the last minute", r.entry.Message, r.count)
+		fields := append([]zapcore.Field{zap.Int("repeated", r.count)}, r.fields...)
+		r.core.Write(entry, fields)
+	}
+}
+
+// fieldsKey returns the fields of an entry as text identifying them, without
+// the durations and times, which differ between entries otherwise
+// identical, and without the URLs in error messages.
+func fieldsKey(fields []zapcore.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		switch field.Type {
+		case zapcore.DurationType, zapcore.TimeType, zapcore.TimeFullType:
+			continue
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok && err != nil {
+				enc.AddString(field.Key, urlPattern.ReplaceAllString(err.Error(), ""))
+			}
+			continue
+		}
+		field.AddTo(enc)
+	}
+	keys := make([]string, 0, len(enc.Fields))
+	for key := range enc.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "%s=%v\x00", key, enc.Fields[key])
+	}
+	return sb.String()
+}
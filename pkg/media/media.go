@@ -0,0 +1,61 @@
+// Package media reads the duration, resolution and codec of video files.
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"uploader/pkg/types"
+)
+
+// FFprobeCommand is the executable preferred to probe videos, the MP4
+// parser of this package is used when it isn't installed.
+const FFprobeCommand = "ffprobe"
+
+// ErrUnsupported is returned for videos that can't be probed.
+var ErrUnsupported = errors.New("media: unsupported video format")
+
+// Probe returns the metadata of the video at filePath.
+func Probe(ctx context.Context, filePath string) (*types.VideoMetadata, error) {
+	if _, err := exec.LookPath(FFprobeCommand); err == nil {
+		return ffprobe(ctx, filePath)
+	}
+	return probeMP4(filePath)
+}
+
+func ffprobe(ctx context.Context, filePath string) (*types.VideoMetadata, error) {
+	out, err := exec.CommandContext(ctx, FFprobeCommand, "-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,width,height:format=duration",
+		"-of", "json", filePath).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var probe struct {
+		Streams []struct {
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, err
+	}
+	if len(probe.Streams) == 0 {
+		return nil, ErrUnsupported
+	}
+
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	return &types.VideoMetadata{
+		Duration: duration,
+		Width:    probe.Streams[0].Width,
+		Height:   probe.Streams[0].Height,
+		Codec:    probe.Streams[0].CodecName,
+	}, nil
+}
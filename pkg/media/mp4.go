@@ -0,0 +1,186 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"uploader/pkg/types"
+)
+
+// mp4Codecs maps the sample entry types of MP4 video tracks to the codec
+// names used by ffprobe.
+var mp4Codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264",
+	"hvc1": "hevc", "hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+}
+
+// probeMP4 reads the metadata of MP4 and QuickTime files from their moov
+// box, without decoding anything.
+func probeMP4(filePath string) (*types.VideoMetadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	moov, err := findBox(io.NewSectionReader(f, 0, info.Size()), "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &types.VideoMetadata{}
+	err = eachBox(moov, func(boxType string, box *io.SectionReader) error {
+		switch boxType {
+		case "mvhd":
+			duration, err := readMvhd(box)
+			meta.Duration = duration
+			return err
+		case "trak":
+			if meta.Codec == "" {
+				return readTrak(box, meta)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if meta.Width == 0 && meta.Codec == "" {
+		return nil, ErrUnsupported
+	}
+	return meta, nil
+}
+
+// eachBox calls fn with every box directly inside r.
+func eachBox(r *io.SectionReader, fn func(boxType string, box *io.SectionReader) error) error {
+	var offset int64
+	header := make([]byte, 16)
+	for offset+8 <= r.Size() {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = r.Size() - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > r.Size() {
+			return ErrUnsupported
+		}
+		if err := fn(boxType, io.NewSectionReader(r, offset+headerSize, size-headerSize)); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+var errFound = errors.New("found")
+
+func findBox(r *io.SectionReader, boxType string) (*io.SectionReader, error) {
+	var found *io.SectionReader
+	err := eachBox(r, func(t string, box *io.SectionReader) error {
+		if t == boxType {
+			found = box
+			return errFound
+		}
+		return nil
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err == nil {
+		err = ErrUnsupported
+	}
+	return nil, err
+}
+
+// readMvhd returns the duration in seconds of the movie header box.
+func readMvhd(box *io.SectionReader) (float64, error) {
+	buf := make([]byte, 32)
+	if _, err := box.ReadAt(buf, 0); err != nil {
+		return 0, err
+	}
+	if buf[0] == 1 {
+		timescale := binary.BigEndian.Uint32(buf[20:24])
+		duration := binary.BigEndian.Uint64(buf[24:32])
+		if timescale == 0 {
+			return 0, nil
+		}
+		return float64(duration) / float64(timescale), nil
+	}
+	timescale := binary.BigEndian.Uint32(buf[12:16])
+	duration := binary.BigEndian.Uint32(buf[16:20])
+	if timescale == 0 {
+		return 0, nil
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// readTrak fills the resolution and codec if the track is a video track.
+func readTrak(trak *io.SectionReader, meta *types.VideoMetadata) error {
+	mdia, err := findBox(trak, "mdia")
+	if err != nil {
+		return nil
+	}
+	hdlr, err := findBox(mdia, "hdlr")
+	if err != nil {
+		return nil
+	}
+	handler := make([]byte, 4)
+	if _, err := hdlr.ReadAt(handler, 8); err != nil || string(handler) != "vide" {
+		return nil
+	}
+
+	if tkhd, err := findBox(trak, "tkhd"); err == nil {
+		// width and height are 16.16 fixed point numbers ending the box
+		size := make([]byte, 8)
+		if _, err := tkhd.ReadAt(size, tkhd.Size()-8); err == nil {
+			meta.Width = int(binary.BigEndian.Uint32(size[:4]) >> 16)
+			meta.Height = int(binary.BigEndian.Uint32(size[4:]) >> 16)
+		}
+	}
+
+	minf, err := findBox(mdia, "minf")
+	if err != nil {
+		return nil
+	}
+	stbl, err := findBox(minf, "stbl")
+	if err != nil {
+		return nil
+	}
+	stsd, err := findBox(stbl, "stsd")
+	if err != nil {
+		return nil
+	}
+	// version, flags and entry count precede the first sample entry
+	entry := make([]byte, 8)
+	if _, err := stsd.ReadAt(entry, 8); err != nil {
+		return nil
+	}
+	format := string(entry[4:8])
+	if codec, ok := mp4Codecs[format]; ok {
+		meta.Codec = codec
+	} else {
+		meta.Codec = strings.TrimSpace(format)
+	}
+	return nil
+}
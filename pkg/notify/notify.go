@@ -0,0 +1,10 @@
+// Package notify sends native desktop notifications.
+package notify
+
+// AppName is the application name shown by the notification center.
+const AppName = "uploader"
+
+// Send shows a desktop notification with the given title and message.
+func Send(title, message string) error {
+	return send(title, message)
+}
@@ -0,0 +1,15 @@
+//go:build darwin
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// send posts to the macOS notification center through AppleScript.
+func send(title, message string) error {
+	script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+	return exec.Command("osascript", "-e", script).Run()
+}
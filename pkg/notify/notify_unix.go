@@ -0,0 +1,10 @@
+//go:build !windows && !darwin
+
+package notify
+
+import "os/exec"
+
+// send uses libnotify's notify-send.
+func send(title, message string) error {
+	return exec.Command("notify-send", "--app-name="+AppName, title, message).Run()
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// powershellAppID is the AppUserModelID of PowerShell. Windows drops the
+// toasts of unregistered IDs without an error, and the uploader has none.
+const powershellAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode('%s')) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode('%s')) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('%s').Show($toast)
+`
+
+// send shows a toast notification through PowerShell.
+func send(title, message string) error {
+	quote := func(s string) string { return strings.ReplaceAll(s, "'", "''") }
+	script := fmt.Sprintf(toastScript, quote(title), quote(message), powershellAppID)
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Run()
+}
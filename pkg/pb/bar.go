@@ -13,6 +13,10 @@ type Bar struct {
 	state  barState
 	config barConfig
 	mu     sync.Mutex
+
+	// progress is the progress the bar is registered with, sent the
+	// events of the bar
+	progress *Progress
 }
 
 // String returns the current rendered version of the progress bar.
@@ -99,16 +103,8 @@ func (b *Bar) IncrInt64(num int64) error {
 
 	b.state.currentBytes += num
 
-	// reset the countdown timer every second to take rolling average
 	b.state.counterNumSinceLast += num
-	if time.Since(b.state.counterTime).Seconds() > 0.5 {
-		b.state.counterLastTenRates = append(b.state.counterLastTenRates, float64(b.state.counterNumSinceLast)/time.Since(b.state.counterTime).Seconds())
-		if len(b.state.counterLastTenRates) > 10 {
-			b.state.counterLastTenRates = b.state.counterLastTenRates[1:]
-		}
-		b.state.counterTime = time.Now()
-		b.state.counterNumSinceLast = 0
-	}
+	b.state.updateRate(b.config.rateWindow, time.Now())
 
 	percent := float64(b.state.currentNum) / float64(b.config.max)
 	b.state.currentSaucerSize = int(percent * float64(b.config.width))
@@ -266,17 +262,30 @@ func (b *Bar) ProxyReader(f io.Reader) *proxyReader {
 // Close close the bar forever
 func (b *Bar) Close() {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	completed := b.state.completed || b.state.exit
 	b.state.completed = true
+	progress := b.progress
+	b.mu.Unlock()
+	if !completed && progress != nil {
+		progress.emitBar(EventBarCompleted, b)
+	}
 }
 
+// Abort stops the bar of a failed transfer, which is counted as failed and
+// removed from its progress.
 func (b *Bar) Abort() {
 	b.mu.Lock()
+	aborted := b.state.exit
 	b.state.exit = true
+	progress := b.progress
 	b.mu.Unlock()
 	if b.config.onCompletion != nil {
 		b.config.onCompletion()
 	}
+	if !aborted && progress != nil {
+		progress.retireFailed(b)
+		progress.emitBar(EventBarFailed, b)
+	}
 }
 
 // Reader is the progressbar io.Reader struct
@@ -37,11 +37,18 @@ type barState struct {
 
 	counterTime         time.Time
 	counterNumSinceLast int64
-	counterLastTenRates []float64
-	averageRate         float64
+	// smoothedRate is the moving average of the rate, valid once
+	// rateSampled is set.
+	smoothedRate float64
+	rateSampled  bool
+	averageRate  float64
 
 	maxLineWidth int
 	currentBytes int64
+	// emittedBytes is currentBytes at the last progress event
+	emittedBytes int64
+	// parts are the states of the parts of the file, if set
+	parts []PartState
 
 	completed bool
 	finished  bool
@@ -85,6 +92,12 @@ type barConfig struct {
 	// minimum time to wait in between updates
 	throttleDuration time.Duration
 
+	// rateWindow is the time constant of the moving average of the rate
+	rateWindow time.Duration
+
+	// group is the group the bar is shown under, e.g. its folder
+	group string
+
 	// clear bar once finished
 	clearOnFinish bool
 
@@ -209,6 +222,17 @@ func OptionSetPredictTime(predictTime bool) BarOption {
 	}
 }
 
+// OptionSetRateWindow sets the time constant of the moving average of the
+// rate used for the speed and the ETA. A longer window reacts slower but
+// doesn't jump when the data arrives in bursts.
+func OptionSetRateWindow(window time.Duration) BarOption {
+	return func(p *Bar) {
+		if window > 0 {
+			p.config.rateWindow = window
+		}
+	}
+}
+
 // OptionShowCount will also print current count out of total
 func OptionShowCount() BarOption {
 	return func(p *Bar) {
@@ -301,6 +325,7 @@ func NewOptions64(max int64, options ...BarOption) *Bar {
 			width:            40,
 			max:              max,
 			throttleDuration: 0 * time.Nanosecond,
+			rateWindow:       DefaultRateWindow,
 			elapsedTime:      true,
 			predictTime:      true,
 			spinnerType:      9,
@@ -312,8 +337,8 @@ func NewOptions64(max int64, options ...BarOption) *Bar {
 		o(&b)
 	}
 
-	if b.config.spinnerType < 0 || b.config.spinnerType > 75 {
-		panic("invalid spinner type, must be between 0 and 75")
+	if b.config.spinnerType < 0 || b.config.spinnerType > MaxSpinnerType {
+		panic(fmt.Sprintf("invalid spinner type, must be between 0 and %d", MaxSpinnerType))
 	}
 
 	// ignoreLength if max bytes not known
@@ -469,11 +494,32 @@ func getStringWidth(c *barConfig, str string, colorize bool) int {
 	return runewidth.StringWidth(cleanString)
 }
 
-func getBarString(c *barConfig, s *barState) (int, string, error) {
-	var sb strings.Builder
+// rateSampleInterval is the shortest time over which the rate is sampled.
+const rateSampleInterval = 500 * time.Millisecond
 
-	s.averageRate = average(s.counterLastTenRates)
-	if len(s.counterLastTenRates) == 0 || s.finished {
+// updateRate folds the rate since the last sample into the moving average,
+// so it also decays while no data arrives.
+func (s *barState) updateRate(window time.Duration, now time.Time) {
+	elapsed := now.Sub(s.counterTime)
+	if elapsed < rateSampleInterval {
+		return
+	}
+	rate := float64(s.counterNumSinceLast) / elapsed.Seconds()
+	if !s.rateSampled {
+		s.smoothedRate = rate
+		s.rateSampled = true
+	} else {
+		s.smoothedRate = smoothRate(s.smoothedRate, rate, elapsed, window)
+	}
+	s.counterTime = now
+	s.counterNumSinceLast = 0
+}
+
+// refreshRate updates the average rate shown and reported for the bar.
+func (s *barState) refreshRate(c *barConfig) {
+	s.updateRate(c.rateWindow, time.Now())
+	s.averageRate = s.smoothedRate
+	if !s.rateSampled || s.finished {
 		// if no average samples, or if finished,
 		// then average rate should be the total rate
 		if t := time.Since(s.startTime).Seconds(); t > 0 {
@@ -482,6 +528,12 @@ func getBarString(c *barConfig, s *barState) (int, string, error) {
 			s.averageRate = 0
 		}
 	}
+}
+
+func getBarString(c *barConfig, s *barState) (int, string, error) {
+	var sb strings.Builder
+
+	s.refreshRate(c)
 
 	// show iteration count in "current/total" iterations format
 	if c.showIterationsCount {
@@ -0,0 +1,145 @@
+package pb
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EventBarAdded is sent when a bar is registered with AddBar.
+	EventBarAdded EventType = iota
+	// EventBarProgress is sent on a tick for every bar that moved since
+	// the previous one.
+	EventBarProgress
+	// EventBarCompleted is sent when a bar is closed.
+	EventBarCompleted
+	// EventBarFailed is sent when a bar is aborted.
+	EventBarFailed
+	// EventBarRemoved is sent when a bar is removed without completing.
+	EventBarRemoved
+	// EventLog is sent for every message written to the LogWriter.
+	EventLog
+	// EventTick is sent every throttle period, and when the terminal is
+	// resized, once the totals are updated.
+	EventTick
+	// EventDone is sent once when the progress stops.
+	EventDone
+	// EventPhaseStarted and EventPhaseEnded are sent when a phase given by
+	// StartPhase starts and ends, with its description as Message.
+	EventPhaseStarted
+	EventPhaseEnded
+)
+
+var eventNames = map[EventType]string{
+	EventBarAdded:     "added",
+	EventBarProgress:  "progress",
+	EventBarCompleted: "completed",
+	EventBarFailed:    "failed",
+	EventBarRemoved:   "removed",
+	EventLog:          "log",
+	EventTick:         "tick",
+	EventDone:         "done",
+	EventPhaseStarted: "phase-started",
+	EventPhaseEnded:   "phase-ended",
+}
+
+func (t EventType) String() string {
+	return eventNames[t]
+}
+
+// Event is a change of the progress, delivered to every Renderer.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Bar and File are the bar of the bar events and a snapshot of it
+	Bar  *Bar
+	File FileStatus
+	// Message is the message of EventLog
+	Message string
+	// Progress is the progress sending the event, to read its Status
+	Progress *Progress
+}
+
+// Renderer shows the progress from its events, e.g. on the terminal or in
+// the status file. Events are delivered one at a time, in order, so
+// Handle must return quickly and must not write to the LogWriter.
+type Renderer interface {
+	Handle(e Event)
+}
+
+// RendererFunc adapts a function to a Renderer.
+type RendererFunc func(e Event)
+
+func (f RendererFunc) Handle(e Event) { f(e) }
+
+// OptionAddRenderer adds a renderer receiving the events of the progress
+// along with the terminal.
+func OptionAddRenderer(r Renderer) ProgressOption {
+	return func(p *Progress) {
+		p.extraRenderers = append(p.extraRenderers, r)
+	}
+}
+
+// emit delivers e to the renderers. It must not be called with a lock of
+// the progress or of a bar held.
+func (p *Progress) emit(e Event) {
+	e.Time = time.Now()
+	e.Progress = p
+	p.emitMu.Lock()
+	defer p.emitMu.Unlock()
+	for _, r := range p.renderers {
+		r.Handle(e)
+	}
+}
+
+// emitBar delivers an event of bar to the renderers.
+func (p *Progress) emitBar(t EventType, bar *Bar) {
+	bar.mu.Lock()
+	file := bar.fileStatus()
+	bar.mu.Unlock()
+	p.emit(Event{Type: t, Bar: bar, File: file})
+}
+
+// jsonEvent is an Event written by the JSON renderer.
+type jsonEvent struct {
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	File    *FileStatus `json:"file,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Status  *Status     `json:"status,omitempty"`
+}
+
+// NewJSONRenderer returns a renderer writing the events as JSON lines to w,
+// with the status on the ticks every interval and when done.
+func NewJSONRenderer(w io.Writer, interval time.Duration) Renderer {
+	var (
+		mu       sync.Mutex
+		lastTick time.Time
+	)
+	enc := json.NewEncoder(w)
+	return RendererFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		out := jsonEvent{Type: e.Type.String(), Time: e.Time, Message: e.Message}
+		switch e.Type {
+		case EventTick:
+			if e.Time.Sub(lastTick) < interval {
+				return
+			}
+			lastTick = e.Time
+			fallthrough
+		case EventDone:
+			status := e.Progress.Status()
+			out.Status = &status
+		case EventLog, EventPhaseStarted, EventPhaseEnded:
+		default:
+			out.File = &e.File
+		}
+		enc.Encode(out)
+	})
+}
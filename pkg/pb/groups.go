@@ -0,0 +1,118 @@
+package pb
+
+import "uploader/pkg/i18n"
+
+// groupTotals are the files and bytes to upload into a group of bars.
+type groupTotals struct {
+	files int
+	size  int64
+}
+
+// OptionSetGroup sets the group of the bar, e.g. the folder of the file.
+func OptionSetGroup(group string) BarOption {
+	return func(p *Bar) {
+		p.config.group = group
+	}
+}
+
+// OptionGroupBars shows the active bars under their group, with a row
+// summing the progress of every file of the group.
+func OptionGroupBars(group bool) ProgressOption {
+	return func(p *Progress) {
+		p.config.groupBars = group
+	}
+}
+
+// AddGroup adds files of size bytes to the totals of group, like
+// AddTransfer. Negative values remove files of a known group.
+func (p *Progress) AddGroup(group string, files int, size int64) {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+	totals, ok := p.state.groups[group]
+	if !ok {
+		if files <= 0 {
+			return
+		}
+		if p.state.groups == nil {
+			p.state.groups = map[string]*groupTotals{}
+		}
+		totals = &groupTotals{}
+		p.state.groups[group] = totals
+	}
+	totals.files += files
+	totals.size += size
+}
+
+// removeFromGroup takes the file of bar out of the totals of its group.
+func (p *Progress) removeFromGroup(bar *Bar) {
+	if bar.config.group == "" {
+		return
+	}
+	size := bar.config.max
+	if bar.config.ignoreLength {
+		size = 0
+	}
+	p.AddGroup(bar.config.group, -1, -size)
+}
+
+// groupBars orders bars by group, in the order the groups first show up,
+// and returns the header rows to render before the first active bar of
+// every group.
+func (p *Progress) groupBars(bars []*Bar) ([]*Bar, map[*Bar]string) {
+	var order []string
+	byGroup := map[string][]*Bar{}
+	for _, bar := range bars {
+		group := bar.config.group
+		if _, ok := byGroup[group]; !ok {
+			order = append(order, group)
+		}
+		byGroup[group] = append(byGroup[group], bar)
+	}
+
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	ordered := make([]*Bar, 0, len(bars))
+	headers := map[*Bar]string{}
+	for _, group := range order {
+		var first *Bar
+		done, files := 0, 0
+		var bytes, size int64
+		for _, bar := range byGroup[group] {
+			bar.mu.Lock()
+			if bar.state.completed {
+				done++
+			} else if first == nil && !bar.state.exit {
+				first = bar
+			}
+			if !bar.state.exit {
+				files++
+				bytes += bar.state.currentBytes
+				if !bar.config.ignoreLength {
+					size += bar.config.max
+				}
+			}
+			bar.mu.Unlock()
+		}
+		ordered = append(ordered, byGroup[group]...)
+		if group == "" || first == nil {
+			continue
+		}
+		// the files not started yet are only in the totals
+		if totals, ok := p.state.groups[group]; ok {
+			files = max(files, totals.files)
+			size = max(size, totals.size)
+		}
+		headers[first] = formatGroup(group, done, files, bytes, size)
+	}
+	return ordered, headers
+}
+
+// formatGroup returns the header row of a group.
+func formatGroup(group string, done, files int, bytes, size int64) string {
+	bytesHumanize, bytesSuffix := humanizeBytes(float64(bytes), false)
+	sizeHumanize, sizeSuffix := humanizeBytes(float64(size), false)
+	return i18n.Sprintf("%s: %d / %d files, %s%s / %s%s, %d%%",
+		group, done, files, bytesHumanize, bytesSuffix, sizeHumanize, sizeSuffix,
+		calculatePercent(bytes, size))
+}
@@ -0,0 +1,108 @@
+package pb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PartState is the state of a part of a file, shown in the part strip of
+// its bar.
+type PartState int
+
+const (
+	PartPending PartState = iota
+	PartDone
+	PartUploading
+	PartRetrying
+	PartFailed
+)
+
+// partGlyphs are the characters of the part states in the strip.
+var partGlyphs = map[PartState]byte{
+	PartPending:   '.',
+	PartDone:      '=',
+	PartUploading: '>',
+	PartRetrying:  '!',
+	PartFailed:    'x',
+}
+
+// partRanks orders the states by how notable they are: a character
+// standing for several parts shows the most notable one.
+var partRanks = map[PartState]int{
+	PartDone:      0,
+	PartPending:   1,
+	PartUploading: 2,
+	PartRetrying:  3,
+	PartFailed:    4,
+}
+
+// maxPartStrip is the most parts shown one by one in the strip.
+const maxPartStrip = 60
+
+// OptionShowParts shows a strip with the state of every part under the bars
+// of the files uploaded in more than one part.
+func OptionShowParts(show bool) ProgressOption {
+	return func(p *Progress) {
+		p.config.showParts = show
+	}
+}
+
+// SetParts sets the number of parts of the file of the bar, all pending.
+func (b *Bar) SetParts(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state.parts = make([]PartState, n)
+}
+
+// SetPartState sets the state of the part partNo of the file of the bar,
+// counted from 1.
+func (b *Bar) SetPartState(partNo int, state PartState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if partNo >= 1 && partNo <= len(b.state.parts) {
+		b.state.parts[partNo-1] = state
+	}
+}
+
+// partStrip renders the states of the parts of the bar, or "" for a file
+// of a single part. The caller holds the lock of the bar.
+func (b *Bar) partStrip() string {
+	parts := b.state.parts
+	if len(parts) < 2 {
+		return ""
+	}
+
+	counts := map[PartState]int{}
+	for _, state := range parts {
+		counts[state]++
+	}
+
+	width := min(len(parts), maxPartStrip)
+	strip := make([]byte, width)
+	for i := range strip {
+		// the parts from..to are summed up by the character i
+		from, to := i*len(parts)/width, (i+1)*len(parts)/width
+		shown := parts[from]
+		for _, state := range parts[from:to] {
+			if partRanks[state] > partRanks[shown] {
+				shown = state
+			}
+		}
+		strip[i] = partGlyphs[shown]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("  parts [")
+	sb.Write(strip)
+	sb.WriteString(fmt.Sprintf("] %d/%d done", counts[PartDone], len(parts)))
+	if n := counts[PartUploading]; n > 0 {
+		sb.WriteString(fmt.Sprintf(", %d uploading", n))
+	}
+	if n := counts[PartRetrying]; n > 0 {
+		sb.WriteString(fmt.Sprintf(", %d retrying", n))
+	}
+	if n := counts[PartFailed]; n > 0 {
+		sb.WriteString(fmt.Sprintf(", %d failed", n))
+	}
+	return sb.String()
+}
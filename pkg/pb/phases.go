@@ -0,0 +1,78 @@
+package pb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"uploader/pkg/i18n"
+)
+
+// phaseDelay is how long a phase runs before it's shown, so the quick ones
+// don't flicker.
+const phaseDelay = 500 * time.Millisecond
+
+// phase is a step of unknown length, shown with a spinner while it runs.
+type phase struct {
+	// description is shown translated, the events keep it in English
+	description string
+	translated  string
+	start       time.Time
+}
+
+// StartPhase shows the description formatted from format and args with a
+// spinner until the returned function is called, for the steps whose
+// length isn't known, like listing a folder or finalizing a file, so long
+// pauses don't look like a hang.
+func (p *Progress) StartPhase(format string, args ...interface{}) func() {
+	description := fmt.Sprintf(format, args...)
+	ph := &phase{description: description, translated: i18n.Sprintf(format, args...), start: time.Now()}
+	p.mu.Lock()
+	p.phases = append(p.phases, ph)
+	p.mu.Unlock()
+	p.emit(Event{Type: EventPhaseStarted, Message: description})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			for i, running := range p.phases {
+				if running == ph {
+					p.phases = append(p.phases[:i:i], p.phases[i+1:]...)
+					break
+				}
+			}
+			p.mu.Unlock()
+			p.emit(Event{Type: EventPhaseEnded, Message: description})
+		})
+	}
+}
+
+// runningPhases returns the phases running for longer than phaseDelay.
+func (p *Progress) runningPhases() []*phase {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var running []*phase
+	for _, ph := range p.phases {
+		if time.Since(ph.start) >= phaseDelay {
+			running = append(running, ph)
+		}
+	}
+	return running
+}
+
+// phasesString renders a line with a spinner for every running phase.
+func (p *Progress) phasesString() string {
+	running := p.runningPhases()
+	if len(running) == 0 {
+		return ""
+	}
+	spinner := spinners[p.config.spinnerType]
+	var sb strings.Builder
+	for _, ph := range running {
+		elapsed := time.Since(ph.start)
+		frame := spinner[int(elapsed/(100*time.Millisecond))%len(spinner)]
+		sb.WriteString(fmt.Sprintf("%s %s (%s)\n", frame, ph.translated, elapsed.Round(time.Second)))
+	}
+	return sb.String()
+}
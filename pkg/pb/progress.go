@@ -8,32 +8,68 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"uploader/pkg/i18n"
 
 	"github.com/mattn/go-colorable"
 	"github.com/mattn/go-runewidth"
+	"go.uber.org/zap"
 	"golang.org/x/term"
 )
 
 type progressConfig struct {
 	writer           io.Writer
 	throttleDuration time.Duration
+
+	// style shared by every bar created through NewBar
+	barTheme    Theme
+	spinnerType int
+	colorCodes  bool
+
+	// statusFile is the path of the JSON status file, empty to disable it
+	statusFile     string
+	statusInterval time.Duration
+
+	// terminalTitle shows the aggregate progress in the terminal title
+	terminalTitle bool
+
+	// rateWindow is the time constant of the moving averages of the rates
+	rateWindow time.Duration
+
+	// showParts shows the states of the parts under the bars
+	showParts bool
+
+	// groupBars shows the bars under their group
+	groupBars  bool
+	isTerminal bool
 }
 
 type progressState struct {
-	mu                   sync.Mutex
-	progress             *Progress
-	uploaded             int
-	uploadedBytes        int64
-	existing             int
-	existingBytes        int64
-	error                int
-	errorBytes           int64
-	totalAverageRate     float64
-	totalTransfers       int
-	totalSize            int64
+	mu            sync.Mutex
+	progress      *Progress
+	uploaded      int
+	uploadedBytes int64
+	existing      int
+	existingBytes int64
+	// error and errorBytes count the failed files and their sizes, which
+	// are left out of the totals to transfer.
+	error            int
+	errorBytes       int64
+	totalAverageRate float64
+	totalTransfers   int
+	totalSize        int64
+	// scanning counts the sources still adding their files to the totals
+	scanning             int
 	maxDescriptionLength int
 	// error    int
 	startTime time.Time
+
+	// groups are the totals of the groups of bars
+	groups map[string]*groupTotals
+
+	// smoothedRate is an exponentially weighted moving average of the
+	// aggregate transfer rate, used for the overall ETA.
+	smoothedRate   float64
+	lastRateUpdate time.Time
 }
 
 type logWriter struct {
@@ -41,24 +77,47 @@ type logWriter struct {
 }
 
 func (lw *logWriter) Write(b []byte) (n int, err error) {
-	lw.progress.render(string(b))
+	lw.progress.emit(Event{Type: EventLog, Message: string(b)})
 	return len(b), nil
 }
 
 type Progress struct {
-	mu   sync.Mutex
-	Bars []*Bar
+	mu     sync.Mutex
+	Bars   []*Bar
+	phases []*phase
+
+	// renderMu serializes writes to the terminal, lastLineWidths holds the
+	// visible width of every line of the previous stats block so it can be
+	// erased correctly even after the terminal has been resized.
+	renderMu       sync.Mutex
+	lastLineWidths []int
+
+	// emitMu serializes the delivery of the events to the renderers, the
+	// terminal first
+	emitMu         sync.Mutex
+	renderers      []Renderer
+	extraRenderers []Renderer
 
 	LogWriter *logWriter
-	wg        *sync.WaitGroup
-	config    progressConfig
-	state     progressState
+	runID     string
+	// logger reports the failures of the progress itself, like writing
+	// the status file
+	logger *zap.Logger
+	wg     *sync.WaitGroup
+	config progressConfig
+	state  progressState
 }
 
 func NewProgress(wg *sync.WaitGroup, options ...ProgressOption) *Progress {
 	p := Progress{wg: wg, config: progressConfig{
 		writer:           configureOutputWriter(os.Stdout),
+		isTerminal:       isTerminal(os.Stdout),
 		throttleDuration: 65 * time.Millisecond,
+		barTheme:         Themes["default"],
+		spinnerType:      9,
+		colorCodes:       !NoColor(),
+		statusInterval:   time.Second,
+		rateWindow:       DefaultRateWindow,
 	}}
 	p.LogWriter = &logWriter{progress: &p}
 	p.state.progress = &p
@@ -66,6 +125,15 @@ func NewProgress(wg *sync.WaitGroup, options ...ProgressOption) *Progress {
 	for _, o := range options {
 		o(&p)
 	}
+
+	p.renderers = []Renderer{terminalRenderer{&p}}
+	if p.config.statusFile != "" {
+		p.renderers = append(p.renderers, &statusFileRenderer{progress: &p})
+	}
+	if p.config.terminalTitle && p.config.isTerminal {
+		p.renderers = append(p.renderers, &titleRenderer{progress: &p})
+	}
+	p.renderers = append(p.renderers, p.extraRenderers...)
 	return &p
 }
 
@@ -80,6 +148,9 @@ func (p *Progress) StartProgress() func() {
 	// 	p.render(text)
 	// }
 
+	resized := make(chan struct{}, 1)
+	stopResize := notifyResize(resized)
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -89,13 +160,15 @@ func (p *Progress) StartProgress() func() {
 		for {
 			select {
 			case <-ticker.C:
-				if err := p.render(""); err != nil {
-					return
-				}
+				p.tick()
+			case <-resized:
+				p.tick()
 			case <-stopProgress:
 				ticker.Stop()
+				stopResize()
+				p.update()
 				// fs.LogPrint = oldLogPrint
-				fmt.Println("")
+				p.emit(Event{Type: EventDone})
 				return
 			}
 		}
@@ -108,21 +181,92 @@ func (p *Progress) StartProgress() func() {
 	}
 }
 
+// NewBar creates a byte counting bar using the theme, spinner and color
+// settings of the progress. The bar still has to be registered with AddBar.
+func (p *Progress) NewBar(max int64, description string, options ...BarOption) *Bar {
+	theme := p.config.barTheme
+	if !p.config.colorCodes {
+		theme = theme.WithoutColors()
+	}
+	barOptions := []BarOption{
+		OptionShowCount(),
+		OptionEnableColorCodes(p.config.colorCodes),
+		OptionShowBytes(true),
+		OptionSetWidth(10),
+		OptionSetDescription(description),
+		OptionSetTheme(theme),
+		OptionSpinnerType(p.config.spinnerType),
+		OptionSetRateWindow(p.config.rateWindow),
+		OptionFullWidth(),
+		OptionSetRenderBlankState(true),
+	}
+	return NewOptions64(max, append(barOptions, options...)...)
+}
+
+// SetLogger sets the logger reporting the failures of the progress itself,
+// like writing the status file.
+func (p *Progress) SetLogger(logger *zap.Logger) {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+	p.logger = logger
+}
+
+// SetRunID sets the run identifier reported in the status file.
+func (p *Progress) SetRunID(runID string) {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+	p.runID = runID
+}
+
 func (p *Progress) AddBar(newBar *Bar) {
+	newBar.mu.Lock()
+	newBar.progress = p
+	newBar.mu.Unlock()
 	p.mu.Lock()
-	defer p.mu.Unlock()
 	p.Bars = append(p.Bars, newBar)
+	p.mu.Unlock()
+	p.emitBar(EventBarAdded, newBar)
+}
+
+// RemoveBar removes a bar that won't be used, e.g. for a file that was not started.
+func (p *Progress) RemoveBar(bar *Bar) {
+	if p.removeBar(bar) {
+		p.emitBar(EventBarRemoved, bar)
+	}
+}
+
+// removeBar unregisters bar, reporting whether it was registered.
+func (p *Progress) removeBar(bar *Bar) bool {
+	bar.mu.Lock()
+	bar.progress = nil
+	bar.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, b := range p.Bars {
+		if b == bar {
+			p.Bars = append(p.Bars[:i:i], p.Bars[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// bars returns a snapshot of the registered bars.
+func (p *Progress) bars() []*Bar {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Bar(nil), p.Bars...)
 }
 
 func (p *Progress) Wait() {
 	p.wg.Wait()
 }
 
-func (p *Progress) updateMaxDescriptionLength() {
+func (p *Progress) updateMaxDescriptionLength(bars []*Bar) {
 	p.state.mu.Lock()
 	defer p.state.mu.Unlock()
 	p.state.maxDescriptionLength = 0
-	for _, bar := range p.Bars {
+	for _, bar := range bars {
 		if !bar.IsCompleted() {
 			sw := getStringWidth(&bar.config, bar.state.originalDescription, false)
 			if sw > p.state.maxDescriptionLength {
@@ -138,37 +282,125 @@ func (p *Progress) AddTransfer(totalFiles int, totalSize int64) {
 	p.state.totalSize += totalSize
 	p.state.totalTransfers += totalFiles
 }
+
+// StartScan marks the totals as growing until the returned function is
+// called, for the sources adding their files with AddTransfer as they find
+// them, like a folder being walked. Several sources can scan at once; the
+// totals are final once all of them are done.
+func (p *Progress) StartScan() func() {
+	p.state.mu.Lock()
+	p.state.scanning++
+	p.state.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.state.mu.Lock()
+			p.state.scanning--
+			p.state.mu.Unlock()
+		})
+	}
+}
 func (p *Progress) AddExisting(size int64) {
 	p.state.mu.Lock()
 	defer p.state.mu.Unlock()
 	p.state.existingBytes += size
 	p.state.existing++
 }
-func (p *Progress) addError(size int64) {
+
+// AddFailed counts a file of size bytes refused before its transfer started,
+// so without a bar, as failed.
+func (p *Progress) AddFailed(size int64) {
 	p.state.mu.Lock()
 	defer p.state.mu.Unlock()
-	p.state.errorBytes += size
+	p.state.errorBytes += max(size, 0)
 	p.state.error++
 }
-func (p *Progress) addUploaded() {
+
+// retireFailed counts the file of an aborted bar as failed and removes the
+// bar, so it's counted once.
+func (p *Progress) retireFailed(bar *Bar) {
+	p.removeBar(bar)
+	p.removeFromGroup(bar)
 	p.state.mu.Lock()
 	defer p.state.mu.Unlock()
-	p.state.uploaded++
+	if bar.config.max > 0 && !bar.config.ignoreLength {
+		p.state.errorBytes += bar.config.max
+	}
+	p.state.error++
 }
-func (p *Progress) incrUploadedBytes(s int64) {
-	p.state.mu.Lock()
-	defer p.state.mu.Unlock()
-	p.state.uploadedBytes += s
+
+// totals returns the bytes and files done, counting the ones already
+// uploaded, and the totals to reach, without the failed ones. The caller
+// holds the state lock.
+func (ps *progressState) totals() (bytes, totalBytes int64, files, totalFiles int) {
+	return ps.uploadedBytes + ps.existingBytes, ps.totalSize - ps.errorBytes,
+		ps.uploaded + ps.existing, ps.totalTransfers - ps.error
 }
-func (p *Progress) incrTotalAverage(s float64) {
+
+// update recomputes the totals and rates from the bars and returns the bars
+// that moved since the previous update.
+func (p *Progress) update() []*Bar {
+	var (
+		uploaded int
+		bytes    int64
+		rate     float64
+		moved    []*Bar
+	)
+	for _, bar := range p.bars() {
+		bar.mu.Lock()
+		if !bar.state.exit {
+			bar.state.refreshRate(&bar.config)
+			bytes += bar.state.currentBytes
+			finished := bar.state.finished || (!bar.config.ignoreLength && bar.state.currentNum >= bar.config.max)
+			switch {
+			case bar.state.completed:
+				uploaded++
+			case !finished:
+				rate += bar.state.averageRate
+			}
+			if !bar.state.completed && bar.state.currentBytes != bar.state.emittedBytes {
+				bar.state.emittedBytes = bar.state.currentBytes
+				moved = append(moved, bar)
+			}
+		}
+		bar.mu.Unlock()
+	}
+
 	p.state.mu.Lock()
-	defer p.state.mu.Unlock()
-	p.state.totalAverageRate += s
+	p.state.uploaded = uploaded
+	p.state.uploadedBytes = bytes
+	p.state.totalAverageRate = rate
+	p.state.mu.Unlock()
+	p.state.updateSmoothedRate(rate)
+	return moved
 }
 
-var (
-	nlines = 0 // number of lines in the previous stats block
-)
+// tick updates the totals and sends the events of the moved bars and the
+// tick.
+func (p *Progress) tick() {
+	for _, bar := range p.update() {
+		p.emitBar(EventBarProgress, bar)
+	}
+	p.emit(Event{Type: EventTick})
+}
+
+// terminalRenderer draws the stats and the bars on the writer of the
+// progress.
+type terminalRenderer struct {
+	progress *Progress
+}
+
+func (r terminalRenderer) Handle(e Event) {
+	switch e.Type {
+	case EventTick:
+		r.progress.render("")
+	case EventLog:
+		r.progress.render(e.Message)
+	case EventDone:
+		fmt.Println("")
+	}
+}
 
 func (p *Progress) render(logMessage string) error {
 	strProgressBars, err := p.String()
@@ -176,8 +408,9 @@ func (p *Progress) render(logMessage string) error {
 		return err
 	}
 	strProgressStats := p.state.String()
+	strProgressBars = p.phasesString() + strProgressBars
 
-	clearAndWriteProgress(&p.config, strProgressStats, strProgressBars, logMessage)
+	p.clearAndWriteProgress(strProgressStats, strProgressBars, logMessage)
 
 	return nil
 }
@@ -189,6 +422,7 @@ type ProgressOption func(p *Progress)
 func OptionSetWriter(w io.Writer) ProgressOption {
 	return func(p *Progress) {
 		p.config.writer = configureOutputWriter(w)
+		p.config.isTerminal = isTerminal(w)
 	}
 }
 
@@ -200,6 +434,62 @@ func OptionSetThrottle(duration time.Duration) ProgressOption {
 	}
 }
 
+// OptionSetStatusFile periodically writes the aggregate progress as JSON to path
+func OptionSetStatusFile(path string, interval time.Duration) ProgressOption {
+	return func(p *Progress) {
+		p.config.statusFile = path
+		if interval > 0 {
+			p.config.statusInterval = interval
+		}
+	}
+}
+
+// OptionSetSpeedWindow sets the time constant of the moving averages of the
+// speeds and ETAs of the files and of the whole upload.
+func OptionSetSpeedWindow(window time.Duration) ProgressOption {
+	return func(p *Progress) {
+		if window > 0 {
+			p.config.rateWindow = window
+		}
+	}
+}
+
+// OptionShowInTerminalTitle shows the aggregate progress in the terminal title
+func OptionShowInTerminalTitle(show bool) ProgressOption {
+	return func(p *Progress) {
+		p.config.terminalTitle = show
+	}
+}
+
+// OptionSetBarTheme sets the theme used by bars created with NewBar
+func OptionSetBarTheme(t Theme) ProgressOption {
+	return func(p *Progress) {
+		p.config.barTheme = t
+	}
+}
+
+// OptionSetSpinnerType sets the spinner used by indeterminate bars created with NewBar
+func OptionSetSpinnerType(spinnerType int) ProgressOption {
+	return func(p *Progress) {
+		p.config.spinnerType = spinnerType
+	}
+}
+
+// OptionEnableColors enables or disables color codes in bars created with NewBar.
+// Colors are disabled by default when NO_COLOR is set.
+func OptionEnableColors(colorCodes bool) ProgressOption {
+	return func(p *Progress) {
+		p.config.colorCodes = colorCodes
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	if file, ok := w.(*os.File); ok {
+		return term.IsTerminal(int(file.Fd()))
+	}
+	return false
+}
+
 func configureOutputWriter(w io.Writer) io.Writer {
 	writer := w
 
@@ -215,6 +505,49 @@ func configureOutputWriter(w io.Writer) io.Writer {
 	return writer
 }
 
+// title returns the short progress summary shown in the terminal title,
+// e.g. "uploader 42% 18 MB/s (3/10)", or (3/10+) while the totals grow.
+func (p *Progress) title() string {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	bytes, totalBytes, files, totalFiles := p.state.totals()
+	speedHumanize, speedSuffix := humanizeBytes(p.state.smoothedRate, false)
+	more := ""
+	if p.state.scanning > 0 {
+		more = "+"
+	}
+	return fmt.Sprintf("uploader %d%% %s%s/s (%d/%d%s)",
+		calculatePercent(bytes, totalBytes),
+		speedHumanize, speedSuffix,
+		files, totalFiles, more)
+}
+
+// titleRenderer shows the progress in the terminal title every second.
+type titleRenderer struct {
+	progress *Progress
+	last     time.Time
+}
+
+func (r *titleRenderer) Handle(e Event) {
+	switch e.Type {
+	case EventTick:
+		if e.Time.Sub(r.last) >= time.Second {
+			r.last = e.Time
+			r.progress.setTitle(r.progress.title())
+		}
+	case EventDone:
+		r.progress.setTitle("uploader")
+	}
+}
+
+// setTitle changes the terminal title.
+func (p *Progress) setTitle(title string) {
+	p.renderMu.Lock()
+	defer p.renderMu.Unlock()
+	writeToProgress(p.config, []byte(ChangeTitle+title+BEL))
+}
+
 func truncateDescription(description string, length int) string {
 	const maxDescriptionLength = 59
 	if length > maxDescriptionLength {
@@ -240,95 +573,129 @@ func truncateDescription(description string, length int) string {
 	}
 }
 
-func (p *Progress) resetState() {
-	p.state.mu.Lock()
-	defer p.state.mu.Unlock()
-	p.state.uploaded = 0
-	p.state.totalAverageRate = 0
-	p.state.uploadedBytes = 0
-	p.state.error = 0
-}
-
 func (p *Progress) String() (string, error) {
 	var bars strings.Builder
 
-	p.resetState()
-	p.updateMaxDescriptionLength()
+	snapshot := p.bars()
+
+	p.updateMaxDescriptionLength(snapshot)
 
-	for i, bar := range p.Bars {
-		updateProgressState(p, bar, &bars, i)
+	var headers map[*Bar]string
+	if p.config.groupBars {
+		snapshot, headers = p.groupBars(snapshot)
+	}
+
+	for i, bar := range snapshot {
+		if header, ok := headers[bar]; ok {
+			bars.WriteString(header)
+			bars.WriteString("\n")
+		}
+		updateProgressState(p, bar, &bars, i, len(snapshot))
 	}
 
 	return bars.String(), nil
 }
 
-func updateProgressState(p *Progress, bar *Bar, bars *strings.Builder, index int) {
+func updateProgressState(p *Progress, bar *Bar, bars *strings.Builder, index int, total int) {
 	if !bar.IsCompleted() {
 		bar.Describe(truncateDescription(bar.state.originalDescription, p.state.maxDescriptionLength))
 	}
 
 	bar.mu.Lock()
 	strBar, err := bar.getBar()
+	if p.config.showParts && strBar != "" {
+		if strip := bar.partStrip(); strip != "" {
+			strBar += "\n" + strip
+		}
+	}
 	bar.mu.Unlock()
 	if err != nil {
 		// Manejar el error de manera apropiada...
 		return
 	}
 
-	if bar.IsError() {
-		p.addError(bar.config.max)
-		return
-	}
-
-	p.incrUploadedBytes(bar.state.currentBytes)
-
-	if bar.IsCompleted() {
-		p.addUploaded()
+	if bar.IsError() || bar.IsCompleted() {
 		return
 	}
 
 	bars.WriteString(strBar)
-	if index != len(p.Bars)-1 && !bar.IsCompleted() {
+	if index != total-1 {
 		bars.WriteString("\n")
 	}
+}
 
-	if !bar.IsFinished() {
-		p.incrTotalAverage(bar.state.averageRate)
+// updateSmoothedRate folds the current aggregate rate into the moving average
+// and returns the new value.
+func (ps *progressState) updateSmoothedRate(rate float64) float64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := time.Now()
+	if ps.lastRateUpdate.IsZero() {
+		ps.smoothedRate = rate
+	} else {
+		ps.smoothedRate = smoothRate(ps.smoothedRate, rate, now.Sub(ps.lastRateUpdate), ps.progress.config.rateWindow)
 	}
+	ps.lastRateUpdate = now
+	return ps.smoothedRate
 }
 
 func (ps *progressState) String() string {
 	var strProgressStats strings.Builder
-	p := ps.progress
+
+	ps.mu.Lock()
+	transferredBytes, totalSize, transferredFiles, totalFiles := ps.totals()
+	existing, failed, failedBytes := ps.existing, ps.error, ps.errorBytes
+	startTime := ps.startTime
+	rate := ps.smoothedRate
+	scanning := ""
+	if ps.scanning > 0 {
+		scanning = i18n.T(" (scanning…)")
+	}
+	ps.mu.Unlock()
 
 	formatTransferredInfo := func() string {
-		uploadedBytesHumanize, uploadedBytesSuffix := humanizeBytes(float64(p.state.uploadedBytes+p.state.existingBytes), false)
-		totalSizeHumanize, totalSizeSuffix := humanizeBytes(float64(p.state.totalSize), false)
-		speedHumanize, speedSuffix := humanizeBytes(p.state.totalAverageRate, false)
+		uploadedBytesHumanize, uploadedBytesSuffix := humanizeBytes(float64(transferredBytes), false)
+		totalSizeHumanize, totalSizeSuffix := humanizeBytes(float64(totalSize), false)
+		speedHumanize, speedSuffix := humanizeBytes(rate, false)
+
+		// the ETA to a total still growing would be too short
+		eta := "-"
+		if rate > 0 && scanning == "" {
+			eta = calculateETA(rate, float64(totalSize), float64(transferredBytes)).String()
+		}
 
-		return fmt.Sprintf("Transferred: %s, %s%s/s, ETA %s",
-			fmt.Sprintf("%s%s/%s%s, %d%%", uploadedBytesHumanize, uploadedBytesSuffix, totalSizeHumanize, totalSizeSuffix, calculatePercent(int(p.state.uploadedBytes+p.state.existingBytes), int(p.state.totalSize))),
+		return i18n.Sprintf("Transferred: %s%s / %s%s%s, %d%%, %s%s/s, ETA %s",
+			uploadedBytesHumanize, uploadedBytesSuffix,
+			totalSizeHumanize, totalSizeSuffix, scanning,
+			calculatePercent(transferredBytes, totalSize),
 			speedHumanize, speedSuffix,
-			calculateETA(p.state.totalAverageRate, float64(p.state.totalSize), float64(p.state.uploadedBytes+p.state.existingBytes)).String(),
+			eta,
 		)
 	}
 
 	formatProgressInfo := func() string {
-		if p.state.totalTransfers != 0 {
-			return fmt.Sprintf("Transferred: %d/%d, %d%%", p.state.uploaded+p.state.existing, p.state.totalTransfers, calculatePercent(p.state.uploaded+p.state.existing, p.state.totalTransfers))
+		return i18n.Sprintf("Transferred: %d / %d files%s, %d%%", transferredFiles, totalFiles, scanning,
+			calculatePercent(int64(transferredFiles), int64(totalFiles)))
+	}
+
+	formatChecksInfo := func() string {
+		if existing > 0 {
+			return i18n.Sprintf("Checked: %d (already uploaded)\n", existing)
 		}
-		return fmt.Sprintf("Transferred: %d/%d, %d%%", p.state.uploaded, p.state.totalTransfers, 0)
+		return ""
 	}
 
 	formatErrorInfo := func() string {
-		if p.state.error > 0 {
-			return fmt.Sprintf("Errors: %d\n", p.state.error)
+		if failed > 0 {
+			failedHumanize, failedSuffix := humanizeBytes(float64(failedBytes), false)
+			return i18n.Sprintf("Failed: %d (%s%s, left out of the totals)\n", failed, failedHumanize, failedSuffix)
 		}
 		return ""
 	}
 
 	formatElapsedTime := func() string {
-		return fmt.Sprintf("Elapsed time: %s", (time.Duration(time.Since(ps.startTime).Seconds()) * time.Second).String())
+		return i18n.Sprintf("Elapsed time: %s", time.Since(startTime).Round(100*time.Millisecond).String())
 	}
 
 	strProgressStats.WriteString(formatTransferredInfo())
@@ -337,17 +704,27 @@ func (ps *progressState) String() string {
 	strProgressStats.WriteString(formatProgressInfo())
 	strProgressStats.WriteString("\n")
 
+	strProgressStats.WriteString(formatChecksInfo())
+	strProgressStats.WriteString(formatErrorInfo())
+
 	strProgressStats.WriteString(formatElapsedTime())
 	strProgressStats.WriteString("\n")
 
-	strProgressStats.WriteString(formatErrorInfo())
-
-	strProgressStats.WriteString("Transferring:")
+	strProgressStats.WriteString(i18n.T("Transferring:"))
 
 	return strProgressStats.String()
 }
 
-func clearAndWriteProgress(config *progressConfig, strProgressStats string, strProgressBars string, logMessage string) {
+// clearAndWriteProgress erases the previous stats block and writes the new one.
+// The number of terminal rows to erase is derived from the widths of the
+// previously written lines and the current terminal width, so lines that the
+// terminal re-wrapped after a resize are cleared as well.
+func (p *Progress) clearAndWriteProgress(strProgressStats string, strProgressBars string, logMessage string) {
+	p.renderMu.Lock()
+	defer p.renderMu.Unlock()
+
+	w, _ := termSize()
+
 	var buf bytes.Buffer
 	out := func(s string) {
 		buf.WriteString(s)
@@ -356,7 +733,7 @@ func clearAndWriteProgress(config *progressConfig, strProgressStats string, strP
 		out("\n")
 		out(MoveUp)
 	}
-	for i := 0; i < nlines-1; i++ {
+	for i := 0; i < wrappedRows(p.lastLineWidths, w)-1; i++ {
 		out(EraseLine)
 		out(MoveUp)
 	}
@@ -369,19 +746,34 @@ func clearAndWriteProgress(config *progressConfig, strProgressStats string, strP
 
 	lines := fmt.Sprintf("%s\n%s", strProgressStats, strProgressBars)
 	fixedLines := strings.Split(lines, "\n")
-	nlines = len(fixedLines)
+	p.lastLineWidths = p.lastLineWidths[:0]
 
 	for i, line := range fixedLines {
-		w, _ := termSize()
 		lineWidth := getStringWidth(&barConfig{colorCodes: true}, line, true)
 		if lineWidth > w {
 			line = runewidth.Truncate(line, w, "...")
+			lineWidth = w
 		}
+		p.lastLineWidths = append(p.lastLineWidths, lineWidth)
 
 		out(line)
-		if i != nlines-1 {
+		if i != len(fixedLines)-1 {
 			out("\n")
 		}
 	}
-	writeToProgress(*config, buf.Bytes())
+	writeToProgress(p.config, buf.Bytes())
+}
+
+// wrappedRows returns how many terminal rows the given lines occupy when
+// displayed in a terminal of width w.
+func wrappedRows(lineWidths []int, w int) int {
+	rows := 0
+	for _, lw := range lineWidths {
+		if w <= 0 || lw <= w {
+			rows++
+			continue
+		}
+		rows += (lw + w - 1) / w
+	}
+	return rows
 }
@@ -0,0 +1,37 @@
+//go:build windows
+
+package pb
+
+import "time"
+
+// notifyResize sends on c whenever the console is resized. Windows has no
+// SIGWINCH, so the console size is polled instead.
+// The returned function stops the notifications.
+func notifyResize(c chan<- struct{}) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		lastW, lastH := termSize()
+		for {
+			select {
+			case <-ticker.C:
+				w, h := termSize()
+				if w == lastW && h == lastH {
+					continue
+				}
+				lastW, lastH = w, h
+				select {
+				case c <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
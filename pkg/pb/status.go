@@ -0,0 +1,172 @@
+package pb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Status is a snapshot of the aggregate progress, written to the status file
+// so external tools can poll the state of a run.
+type Status struct {
+	RunID            string    `json:"runId,omitempty"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+	StartedAt        time.Time `json:"startedAt"`
+	ElapsedSeconds   float64   `json:"elapsedSeconds"`
+	TransferredBytes int64     `json:"transferredBytes"`
+	TotalBytes       int64     `json:"totalBytes"`
+	FailedBytes      int64     `json:"failedBytes"`
+	Uploaded         int       `json:"uploaded"`
+	Existing         int       `json:"existing"`
+	Failed           int       `json:"failed"`
+	TotalFiles       int       `json:"totalFiles"`
+	Speed            float64   `json:"speed"`
+	ETASeconds       float64   `json:"etaSeconds"`
+	// Scanning is set while sources are still adding files to the totals
+	Scanning bool `json:"scanning,omitempty"`
+	// Phases are the steps of unknown length running, e.g. listings
+	Phases []string     `json:"phases,omitempty"`
+	Files  []FileStatus `json:"files"`
+}
+
+// FileStatus is the state of a single bar inside a Status.
+type FileStatus struct {
+	Name  string  `json:"name"`
+	Size  int64   `json:"size"`
+	Bytes int64   `json:"bytes"`
+	Speed float64 `json:"speed"`
+	// ETASeconds is the time left for the file at its current speed
+	ETASeconds float64 `json:"etaSeconds"`
+	State      string  `json:"state"`
+}
+
+// Status returns a snapshot of the current progress.
+func (p *Progress) Status() Status {
+	p.state.mu.Lock()
+	bytes, totalBytes, _, totalFiles := p.state.totals()
+	s := Status{
+		RunID:            p.runID,
+		UpdatedAt:        time.Now(),
+		StartedAt:        p.state.startTime,
+		ElapsedSeconds:   time.Since(p.state.startTime).Seconds(),
+		TransferredBytes: bytes,
+		TotalBytes:       totalBytes,
+		FailedBytes:      p.state.errorBytes,
+		Uploaded:         p.state.uploaded,
+		Existing:         p.state.existing,
+		Failed:           p.state.error,
+		TotalFiles:       totalFiles,
+		Speed:            p.state.smoothedRate,
+		Scanning:         p.state.scanning > 0,
+	}
+	p.state.mu.Unlock()
+
+	if s.Speed > 0 && !s.Scanning {
+		s.ETASeconds = calculateETA(s.Speed, float64(s.TotalBytes), float64(s.TransferredBytes)).Seconds()
+	}
+
+	p.mu.Lock()
+	for _, ph := range p.phases {
+		s.Phases = append(s.Phases, ph.description)
+	}
+	p.mu.Unlock()
+
+	bars := p.bars()
+
+	s.Files = make([]FileStatus, 0, len(bars))
+	for _, bar := range bars {
+		bar.mu.Lock()
+		s.Files = append(s.Files, bar.fileStatus())
+		bar.mu.Unlock()
+	}
+
+	return s
+}
+
+// fileStatus returns the state of the bar. The caller holds its lock.
+func (b *Bar) fileStatus() FileStatus {
+	fs := FileStatus{
+		Name:  b.state.originalDescription,
+		Size:  b.config.max,
+		Bytes: b.state.currentBytes,
+		Speed: b.state.averageRate,
+	}
+	if b.config.ignoreLength {
+		fs.Size = -1
+	} else if fs.Speed > 0 {
+		fs.ETASeconds = calculateETA(fs.Speed, float64(b.config.max), float64(b.state.currentNum)).Seconds()
+	}
+	switch {
+	case b.state.exit:
+		fs.State = "failed"
+	case b.state.completed:
+		fs.State = "completed"
+	case b.state.finished:
+		fs.State = "finishing"
+	default:
+		fs.State = "uploading"
+	}
+	return fs
+}
+
+// statusFileRenderer writes the status file every status interval and when
+// the progress stops. The first failure to write it is logged, the file
+// most likely can't be written at all.
+type statusFileRenderer struct {
+	progress *Progress
+	last     time.Time
+	warned   bool
+}
+
+func (r *statusFileRenderer) Handle(e Event) {
+	switch e.Type {
+	case EventTick:
+		if e.Time.Sub(r.last) < r.progress.config.statusInterval {
+			return
+		}
+		r.last = e.Time
+		r.write()
+	case EventDone:
+		r.write()
+	}
+}
+
+func (r *statusFileRenderer) write() {
+	err := r.progress.writeStatusFile()
+	if err == nil || r.warned {
+		return
+	}
+	r.warned = true
+	r.progress.state.mu.Lock()
+	logger := r.progress.logger
+	r.progress.state.mu.Unlock()
+	if logger != nil {
+		logger.Warn("write status file failed", zap.String("statusFile", r.progress.config.statusFile), zap.Error(err))
+	}
+}
+
+// writeStatusFile atomically replaces the status file with the current status.
+func (p *Progress) writeStatusFile() error {
+	data, err := json.MarshalIndent(p.Status(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.config.statusFile), ".status-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p.config.statusFile)
+}
@@ -0,0 +1,62 @@
+package pb
+
+import (
+	"os"
+
+	"github.com/mitchellh/colorstring"
+)
+
+// Themes holds the named bar themes that can be selected from the configuration.
+var Themes = map[string]Theme{
+	"default": {
+		Saucer:        "[green]=[reset]",
+		SaucerHead:    "[green]>[reset]",
+		SaucerPadding: " ",
+		BarStart:      "[",
+		BarEnd:        "]",
+	},
+	"blocks": {
+		Saucer:        "[cyan]█[reset]",
+		SaucerPadding: "░",
+		BarStart:      "|",
+		BarEnd:        "|",
+	},
+	"arrows": {
+		Saucer:        "[yellow]━[reset]",
+		SaucerHead:    "[yellow]➤[reset]",
+		SaucerPadding: "─",
+		BarStart:      "",
+		BarEnd:        "",
+	},
+	"ascii": {
+		Saucer:        "#",
+		SaucerPadding: "-",
+		BarStart:      "[",
+		BarEnd:        "]",
+	},
+}
+
+// ASCIISpinnerType is the spinner used when only ASCII output is allowed.
+const ASCIISpinnerType = 9
+
+// MaxSpinnerType is the highest spinner type, they're numbered from 0.
+const MaxSpinnerType = 75
+
+// NoColor reports whether colored output has been disabled through the
+// NO_COLOR environment variable (https://no-color.org).
+func NoColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// WithoutColors returns a copy of the theme with every color tag removed.
+func (t Theme) WithoutColors() Theme {
+	strip := colorstring.Colorize{Colors: colorstring.DefaultColors, Disable: true}
+	return Theme{
+		Saucer:        strip.Color(t.Saucer),
+		AltSaucerHead: strip.Color(t.AltSaucerHead),
+		SaucerHead:    strip.Color(t.SaucerHead),
+		SaucerPadding: strip.Color(t.SaucerPadding),
+		BarStart:      strip.Color(t.BarStart),
+		BarEnd:        strip.Color(t.BarEnd),
+	}
+}
@@ -22,20 +22,29 @@ func calculateETA(rate, max, current float64) time.Duration {
 
 }
 
-func calculatePercent(current int, max int) int {
+func calculatePercent(current int64, max int64) int {
+	if max <= 0 {
+		return 0
+	}
 	percent := int((float64(current) / float64(max)) * 100)
 	if percent < 0 {
 		percent = 0
 	}
+	if percent > 100 {
+		percent = 100
+	}
 	return percent
 }
 
-func average(xs []float64) float64 {
-	total := 0.0
-	for _, v := range xs {
-		total += v
-	}
-	return total / float64(len(xs))
+// DefaultRateWindow is the default time constant of the moving averages of
+// the transfer rates.
+const DefaultRateWindow = 10 * time.Second
+
+// smoothRate returns the moving average avg updated with rate, sampled over
+// elapsed, for the time constant window.
+func smoothRate(avg, rate float64, elapsed, window time.Duration) float64 {
+	alpha := 1 - math.Exp(-elapsed.Seconds()/window.Seconds())
+	return avg + alpha*(rate-avg)
 }
 
 func logn(n, b float64) float64 {
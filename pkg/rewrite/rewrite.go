@@ -0,0 +1,63 @@
+// Package rewrite maps local relative paths to remote ones with regular
+// expression rules.
+package rewrite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule replaces the matches of a regular expression, the replacement can
+// refer to the submatches as $1 or ${1}.
+type Rule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Rules are applied one after the other.
+type Rules []Rule
+
+// Parse reads one rule per line, in the `pattern => replacement` form.
+// Blank lines and lines starting with # are ignored.
+func Parse(r io.Reader) (Rules, error) {
+	var rules Rules
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, replacement, ok := strings.Cut(line, "=>")
+		if !ok {
+			return nil, fmt.Errorf("rewrite rule on line %d: missing =>", n)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("rewrite rule on line %d: %w", n, err)
+		}
+		rules = append(rules, Rule{Pattern: re, Replacement: strings.TrimSpace(replacement)})
+	}
+	return rules, scanner.Err()
+}
+
+// Load reads the rules of a file.
+func Load(file string) (Rules, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Apply returns the slash separated relative path p rewritten by the rules.
+func (rules Rules) Apply(p string) string {
+	for _, rule := range rules {
+		p = rule.Pattern.ReplaceAllString(p, rule.Replacement)
+	}
+	return p
+}
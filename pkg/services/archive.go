@@ -0,0 +1,25 @@
+package services
+
+import (
+	"io"
+	"path/filepath"
+	"uploader/pkg/archive"
+)
+
+// UploadArchive streams the directory sourceDir into a single archive of
+// the given format uploaded to destDir, without writing a temporary file.
+func (u *UploadService) UploadArchive(sourceDir string, format string, destDir string) error {
+	absDir, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archive.Write(pw, absDir, format))
+	}()
+
+	err = u.UploadStream(pr, absDir, filepath.Base(absDir)+"."+format, destDir)
+	pr.CloseWithError(err)
+	return err
+}
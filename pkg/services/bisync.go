@@ -0,0 +1,460 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"uploader/pkg/state"
+	"uploader/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoBaseline is returned by Bisync when the folders were never synced,
+// see BisyncOptions.Resync.
+var ErrNoBaseline = errors.New("no previous bisync of these folders, run it once with resync")
+
+// ErrTooManyDeletes is returned by Bisync when a run would delete more
+// files than allowed by BisyncOptions.MaxDelete.
+var ErrTooManyDeletes = errors.New("too many deletions")
+
+// errBisyncChanged is returned by bisyncApply for a path changed on either
+// side after the plan was made.
+var errBisyncChanged = errors.New("changed since the plan was made")
+
+// BisyncOptions configures Bisync.
+type BisyncOptions struct {
+	// Server identifies the remote server in the stored baseline, e.g. its
+	// API URL.
+	Server string
+	// Resync builds the baseline from scratch: files only on one side are
+	// copied to the other and files on both sides with the same size are
+	// taken as equal.
+	Resync bool
+	// DryRun only reports what would be done.
+	DryRun bool
+	// Transfers is the number of files copied at once.
+	Transfers int
+	// MaxDelete is the highest percentage of the files of a side one run
+	// may delete, 0 for no limit.
+	MaxDelete int
+	// Confirm, if set, is given the planned changes before making any, and
+	// stops the run with its error. Every change is made only if its path
+	// still has the size and modification time seen when planning.
+	Confirm func(plan *BisyncResult) error
+}
+
+// BisyncResult reports what Bisync did.
+type BisyncResult struct {
+	Uploaded      []string
+	Downloaded    []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	// Conflicts are files changed on both sides, left as they are until
+	// one of them is changed back or deleted.
+	Conflicts []string
+	// Changed are files changed after the plan was made, left for the next
+	// run.
+	Changed []string
+	Failed  int
+}
+
+func (r *BisyncResult) add(action bisyncAction, rel string) {
+	switch action {
+	case bisyncUpload:
+		r.Uploaded = append(r.Uploaded, rel)
+	case bisyncDownload:
+		r.Downloaded = append(r.Downloaded, rel)
+	case bisyncDeleteLocal:
+		r.DeletedLocal = append(r.DeletedLocal, rel)
+	case bisyncDeleteRemote:
+		r.DeletedRemote = append(r.DeletedRemote, rel)
+	}
+}
+
+type bisyncLocal struct {
+	size    int64
+	modTime int64
+}
+
+// bisyncAction is what to do with a path.
+type bisyncAction int
+
+const (
+	bisyncNone bisyncAction = iota
+	bisyncUpload
+	bisyncDownload
+	bisyncDeleteLocal
+	bisyncDeleteRemote
+	bisyncConflict
+)
+
+// Bisync synchronises localDir and remoteDir in both directions: files
+// created or changed on one side since the last bisync are copied to the
+// other and deleted files are deleted on the other side, comparing both
+// trees with the baseline stored after the previous run.
+func (u *UploadService) Bisync(localDir, remoteDir string, opts BisyncOptions) (*BisyncResult, error) {
+	absDir, err := filepath.Abs(localDir)
+	if err != nil {
+		return nil, err
+	}
+	remoteDir = path.Clean("/" + remoteDir)
+
+	baseline, err := state.LoadBisync(opts.Server, absDir, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	if baseline == nil && !opts.Resync {
+		return nil, ErrNoBaseline
+	}
+	if opts.Resync {
+		baseline = map[string]state.BisyncEntry{}
+	}
+
+	local, err := bisyncLocalTree(absDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.CreateRemoteDir(remoteDir); err != nil {
+		return nil, err
+	}
+	tree, err := u.ListTree(remoteDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	remote := map[string]types.FileInfo{}
+	for rel := range tree {
+		if file, _ := tree.File(rel); file.Type != "folder" && !isSidecarPath(rel) {
+			remote[rel] = *file
+		}
+	}
+
+	paths := map[string]bool{}
+	for rel := range local {
+		paths[rel] = true
+	}
+	for rel := range remote {
+		paths[rel] = true
+	}
+	for rel := range baseline {
+		paths[rel] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for rel := range paths {
+		sorted = append(sorted, rel)
+	}
+	sort.Strings(sorted)
+
+	result := &BisyncResult{}
+	next := map[string]state.BisyncEntry{}
+	var changes []bisyncChange
+	for _, rel := range sorted {
+		l, inLocal := local[rel]
+		r, inRemote := remote[rel]
+		base, inBase := baseline[rel]
+		action := bisyncDecide(l, inLocal, r, inRemote, base, inBase, opts.Resync)
+		if inBase {
+			// kept until the change is made
+			next[rel] = base
+		}
+		switch action {
+		case bisyncNone:
+			if inLocal && inRemote {
+				next[rel] = state.BisyncEntry{Size: l.size, LocalModTime: time.Unix(l.modTime, 0), RemoteID: r.Id}
+			}
+		case bisyncConflict:
+			result.Conflicts = append(result.Conflicts, rel)
+			u.logger.Warn("bisync conflict, changed on both sides", zap.String("path", rel))
+		default:
+			changes = append(changes, bisyncChange{rel: rel, action: action, local: l, inLocal: inLocal, remote: r, inRemote: inRemote})
+		}
+	}
+
+	if err := bisyncCheckDeletes(changes, len(local), len(remote), opts.MaxDelete); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun || opts.Confirm != nil {
+		plan := &BisyncResult{Conflicts: result.Conflicts}
+		for _, change := range changes {
+			plan.add(change.action, change.rel)
+		}
+		if opts.DryRun {
+			return plan, nil
+		}
+		if err := opts.Confirm(plan); err != nil {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	transfers := make(chan struct{}, max(opts.Transfers, 1))
+	for _, change := range changes {
+		change := change
+		transfers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-transfers }()
+			entry, keep, err := u.bisyncApply(change, absDir, remoteDir)
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, errBisyncChanged) {
+				result.Changed = append(result.Changed, change.rel)
+				u.logger.Warn("bisync skipped, changed since the plan was made", zap.String("path", change.rel))
+				return
+			}
+			if err != nil {
+				result.Failed++
+				u.logger.Error("bisync failed", zap.String("path", change.rel), zap.Error(err))
+				return
+			}
+			if keep {
+				next[change.rel] = entry
+			} else {
+				delete(next, change.rel)
+			}
+			result.add(change.action, change.rel)
+		}()
+	}
+	wg.Wait()
+
+	if err := state.SaveBisync(opts.Server, absDir, remoteDir, next); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// bisyncDecide returns what to do with a path given its state on both sides
+// and in the baseline.
+func bisyncDecide(l bisyncLocal, inLocal bool, r types.FileInfo, inRemote bool, base state.BisyncEntry, inBase bool, resync bool) bisyncAction {
+	if resync {
+		switch {
+		case inLocal && !inRemote:
+			return bisyncUpload
+		case inRemote && !inLocal:
+			return bisyncDownload
+		case l.size != r.Size:
+			return bisyncConflict
+		}
+		return bisyncNone
+	}
+
+	localChanged := inLocal && (!inBase || l.size != base.Size || l.modTime != base.LocalModTime.Unix())
+	remoteChanged := inRemote && (!inBase || r.Id != base.RemoteID)
+	localDeleted := !inLocal && inBase
+	remoteDeleted := !inRemote && inBase
+
+	switch {
+	case localChanged && remoteChanged:
+		if l.size == r.Size && !inBase {
+			// created on both sides, most likely the same file
+			return bisyncNone
+		}
+		return bisyncConflict
+	case localChanged:
+		return bisyncUpload
+	case remoteChanged:
+		return bisyncDownload
+	case localDeleted && inRemote:
+		return bisyncDeleteRemote
+	case remoteDeleted && inLocal:
+		return bisyncDeleteLocal
+	}
+	return bisyncNone
+}
+
+// bisyncCheckDeletes returns ErrTooManyDeletes when changes delete more
+// than maxDelete percent of the local or the remote files.
+func bisyncCheckDeletes(changes []bisyncChange, localFiles, remoteFiles, maxDelete int) error {
+	if maxDelete <= 0 {
+		return nil
+	}
+	var deleteLocal, deleteRemote int
+	for _, change := range changes {
+		switch change.action {
+		case bisyncDeleteLocal:
+			deleteLocal++
+		case bisyncDeleteRemote:
+			deleteRemote++
+		}
+	}
+	if deleteLocal*100 > localFiles*maxDelete {
+		return fmt.Errorf("%w: %d of %d local files, over %d%%", ErrTooManyDeletes, deleteLocal, localFiles, maxDelete)
+	}
+	if deleteRemote*100 > remoteFiles*maxDelete {
+		return fmt.Errorf("%w: %d of %d remote files, over %d%%", ErrTooManyDeletes, deleteRemote, remoteFiles, maxDelete)
+	}
+	return nil
+}
+
+// bisyncChange is a change to propagate to the other side, with both sides
+// as seen when planning it.
+type bisyncChange struct {
+	rel      string
+	action   bisyncAction
+	local    bisyncLocal
+	inLocal  bool
+	remote   types.FileInfo
+	inRemote bool
+}
+
+// bisyncCheck returns errBisyncChanged if the path of change no longer has
+// the size and modification time it had on either side when planning it.
+func (u *UploadService) bisyncCheck(change bisyncChange, localPath, destDir string) error {
+	info, err := os.Stat(localPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if change.inLocal {
+			return errBisyncChanged
+		}
+	case err != nil:
+		return err
+	case !change.inLocal || info.Size() != change.local.size || info.ModTime().Unix() != change.local.modTime:
+		return errBisyncChanged
+	}
+
+	file, err := u.findFile(u.ctx, path.Base(change.rel), destDir)
+	if err != nil {
+		return err
+	}
+	if change.inRemote != (file != nil) {
+		return errBisyncChanged
+	}
+	if file != nil && (file.Id != change.remote.Id || file.Size != change.remote.Size || file.ModTime != change.remote.ModTime) {
+		return errBisyncChanged
+	}
+	return nil
+}
+
+// bisyncApply propagates a change, returning the new baseline entry of its
+// path and whether to keep one.
+func (u *UploadService) bisyncApply(change bisyncChange, localDir, remoteDir string) (state.BisyncEntry, bool, error) {
+	action, rel, r, inRemote := change.action, change.rel, change.remote, change.inRemote
+	localPath := filepath.Join(localDir, filepath.FromSlash(rel))
+	destDir := path.Join(remoteDir, path.Dir(rel))
+	if err := u.bisyncCheck(change, localPath, destDir); err != nil {
+		return state.BisyncEntry{}, false, err
+	}
+
+	switch action {
+	case bisyncUpload:
+		if err := u.CreateRemoteDir(destDir); err != nil {
+			return state.BisyncEntry{}, false, err
+		}
+		src, err := newLocalSource(localPath)
+		if err != nil {
+			return state.BisyncEntry{}, false, err
+		}
+		// the remote file is replaced once the new one is finalized, the
+		// upload would skip it otherwise when of the same size
+		var replace *types.FileInfo
+		if inRemote {
+			replace = &r
+		}
+		u.Progress.AddTransfer(1, src.Size())
+		if err := u.uploadSource(src, destDir, replace); err != nil {
+			return state.BisyncEntry{}, false, err
+		}
+		uploaded, err := u.findFile(u.ctx, src.Name(), destDir)
+		if err != nil {
+			return state.BisyncEntry{}, false, err
+		}
+		if uploaded == nil {
+			return state.BisyncEntry{}, false, fmt.Errorf("%s: not found after uploading it", path.Join(destDir, src.Name()))
+		}
+		return state.BisyncEntry{Size: src.Size(), LocalModTime: time.Unix(src.ModTime().Unix(), 0), RemoteID: uploaded.Id}, true, nil
+
+	case bisyncDownload:
+		if err := u.download(&remoteSource{from: u, dir: destDir, file: r}, localPath); err != nil {
+			return state.BisyncEntry{}, false, err
+		}
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return state.BisyncEntry{}, false, err
+		}
+		return state.BisyncEntry{Size: info.Size(), LocalModTime: time.Unix(info.ModTime().Unix(), 0), RemoteID: r.Id}, true, nil
+
+	case bisyncDeleteLocal:
+		err := os.Remove(localPath)
+		return state.BisyncEntry{}, false, err
+
+	case bisyncDeleteRemote:
+		err := u.DeleteFile(r.Id)
+		return state.BisyncEntry{}, false, err
+	}
+	return state.BisyncEntry{}, false, nil
+}
+
+// download writes the remote file src to localPath through a temporary file
+// next to it, so an interrupted download never leaves a partial file.
+func (u *UploadService) download(src *remoteSource, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*.partial")
+	if err != nil {
+		return err
+	}
+	err = u.catFile(src, tmp, 0, -1)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), localPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	u.logger.Info("file downloaded", zap.String("filePath", localPath), zap.Int64("fileSize", src.file.Size))
+	return nil
+}
+
+// bisyncLocalTree returns the files below dir by slash separated relative
+// path.
+func bisyncLocalTree(dir string) (map[string]bisyncLocal, error) {
+	files := map[string]bisyncLocal{}
+	err := filepath.WalkDir(dir, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() {
+			return err
+		}
+		if strings.HasSuffix(d.Name(), ".partial") && strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fullPath)
+		if err != nil {
+			return err
+		}
+		if isSidecarPath(filepath.ToSlash(rel)) {
+			// never listed on the remote side, they would look deleted
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = bisyncLocal{size: info.Size(), modTime: info.ModTime().Unix()}
+		return nil
+	})
+	return files, err
+}
+
+// isSidecarPath reports whether rel is inside a folder of files uploaded
+// alongside others, like thumbnails.
+func isSidecarPath(rel string) bool {
+	for _, dir := range strings.Split(path.Dir(rel), "/") {
+		if dir == ThumbnailDir || dir == MetadataDir {
+			return true
+		}
+	}
+	return false
+}
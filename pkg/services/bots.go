@@ -0,0 +1,129 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// botParameter is the query parameter of part uploads naming the bot the
+// server should upload the part with. Servers without bot selection ignore
+// it.
+const botParameter = "bot"
+
+const (
+	// botMaxFailures is how many parts in a row a bot may fail before it
+	// is left out.
+	botMaxFailures = 3
+	// botBlacklist is how long a failing bot is left out, unless the
+	// server said how long to wait.
+	botBlacklist = 5 * time.Minute
+)
+
+// WithBots spreads the part uploads over a pool of bots, e.g. their
+// usernames or IDs, asking the server to upload every part with the next
+// bot in turn. Bots failing repeatedly or rate limited are left out for a
+// while.
+func WithBots(bots []string) UploadOption {
+	return func(u *UploadService) {
+		if len(bots) > 0 {
+			u.bots = newBotPool(bots, u.logger)
+		}
+	}
+}
+
+// ParseBots parses a comma separated list of bots.
+func ParseBots(text string) []string {
+	var bots []string
+	for _, bot := range strings.Split(text, ",") {
+		if bot = strings.TrimSpace(bot); bot != "" {
+			bots = append(bots, bot)
+		}
+	}
+	return bots
+}
+
+type botState struct {
+	name     string
+	failures int
+	until    time.Time
+}
+
+type botPool struct {
+	mu     sync.Mutex
+	bots   []*botState
+	next   int
+	logger *zap.Logger
+}
+
+func newBotPool(names []string, logger *zap.Logger) *botPool {
+	p := &botPool{logger: logger}
+	for _, name := range names {
+		p.bots = append(p.bots, &botState{name: name})
+	}
+	return p
+}
+
+// pick returns the next bot that isn't left out, or the one back the soonest
+// if they all are.
+func (p *botPool) pick() string {
+	if p == nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	soonest := p.bots[0]
+	for i := range p.bots {
+		bot := p.bots[(p.next+i)%len(p.bots)]
+		if !bot.until.After(now) {
+			p.next = (p.next + i + 1) % len(p.bots)
+			return bot.name
+		}
+		if bot.until.Before(soonest.until) {
+			soonest = bot
+		}
+	}
+	return soonest.name
+}
+
+// report records the outcome of a part uploaded with bot.
+func (p *botPool) report(bot string, resp *http.Response, err error) {
+	if p == nil || bot == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var state *botState
+	for _, b := range p.bots {
+		if b.name == bot {
+			state = b
+		}
+	}
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	if err == nil && status < 500 && status != http.StatusTooManyRequests {
+		state.failures = 0
+		return
+	}
+	state.failures++
+	if status != http.StatusTooManyRequests && state.failures < botMaxFailures {
+		return
+	}
+	wait := botBlacklist
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+	}
+	state.until = time.Now().Add(wait)
+	state.failures = 0
+	p.logger.Warn("bot left out of the part uploads", zap.String("bot", bot), zap.Int("status", status), zap.Duration("for", wait), zap.Error(err))
+}
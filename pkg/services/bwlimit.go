@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// bwLimitBurst is the most bytes read at once through a limit, so the data
+// flows evenly instead of in bursts of a whole buffer.
+const bwLimitBurst = 32 * 1024
+
+// WithFileBwLimit caps the upload speed of every file to limit bytes per
+// second, shared by its parts sent at once, so a huge file doesn't starve
+// the smaller ones sent along with it. A limit of 0 or less disables it.
+func WithFileBwLimit(limit int64) UploadOption {
+	return func(u *UploadService) {
+		u.fileBwLimit = limit
+	}
+}
+
+// fileLimiter returns the limiter shared by the parts of a file, or nil
+// without a limit.
+func (u *UploadService) fileLimiter() *rate.Limiter {
+	if u.fileBwLimit <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(u.fileBwLimit), bwLimitBurst)
+}
+
+// limitedPartTimeout returns the time the parts of size bytes of a file
+// limited by WithFileBwLimit take at least, when all the workers send parts
+// of the file at once, or 0 without a limit.
+func (u *UploadService) limitedPartTimeout(size int64) time.Duration {
+	if u.fileBwLimit <= 0 {
+		return 0
+	}
+	return time.Duration(size*int64(u.numWorkers)/u.fileBwLimit)*time.Second + u.timeoutSlack
+}
+
+// limitedReader reads from Reader within the rate of limiter.
+type limitedReader struct {
+	io.Reader
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+// limitReader returns r read within the rate of limiter, or r with a nil
+// limiter.
+func limitReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &limitedReader{Reader: r, ctx: ctx, limiter: limiter}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > bwLimitBurst {
+		p = p[:bwLimitBurst]
+	}
+	n, err := l.Reader.Read(p)
+	if n > 0 {
+		if werr := l.limiter.WaitN(l.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/rclone/rclone/fs"
+	"go.uber.org/zap"
+)
+
+// catRetries is how many times a read of Cat is resumed after the
+// connection broke.
+const catRetries = 3
+
+// Cat writes count bytes of the remote file at filePath, from offset, to w.
+// A negative count writes up to the end. The file is read one part size at a
+// time, in order, and a read that fails halfway is resumed where it stopped.
+func (u *UploadService) Cat(filePath string, w io.Writer, offset, count int64) error {
+	file, err := u.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if file.Type == "folder" {
+		return fmt.Errorf("%s: %w", filePath, fs.ErrorIsDir)
+	}
+	return u.catFile(&remoteSource{from: u, dir: path.Dir(path.Clean("/" + filePath)), file: *file}, w, offset, count)
+}
+
+// catFile writes count bytes of the remote file src from offset to w, like
+// Cat.
+func (u *UploadService) catFile(src *remoteSource, w io.Writer, offset, count int64) error {
+	file := src.file
+	filePath := path.Join(src.dir, file.Name)
+
+	end := file.Size
+	if count >= 0 && offset+count < end {
+		end = offset + count
+	}
+	chunk := u.partSize
+	if chunk <= 0 {
+		chunk = file.Size
+	}
+	for offset < end {
+		length := min(chunk, end-offset)
+		for attempt := 0; ; attempt++ {
+			n, err := u.catRange(src, w, offset, length)
+			offset += n
+			length -= n
+			if err == nil {
+				break
+			}
+			if _, ok := err.(writeError); ok || attempt == catRetries {
+				return err
+			}
+			u.logger.Warn("read failed, resuming", zap.String("filePath", filePath), zap.Int64("offset", offset), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// writeError is a failed write to the output of Cat, which is not retried.
+type writeError struct{ error }
+
+func (e writeError) Unwrap() error { return e.error }
+
+// catRange copies length bytes of src from offset to w and returns how many
+// were written.
+func (u *UploadService) catRange(src *remoteSource, w io.Writer, offset, length int64) (int64, error) {
+	rc, err := src.Open(u.ctx, offset, length)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	var written int64
+	buf := make([]byte, 32*1024)
+	for written < length {
+		n, err := rc.Read(buf[:min(int64(len(buf)), length-written)])
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return written, writeError{werr}
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			if written < length {
+				return written, io.ErrUnexpectedEOF
+			}
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// ChannelRule stores the files uploaded below a remote path prefix in a
+// channel of their own.
+type ChannelRule struct {
+	Prefix    string
+	ChannelID int64
+}
+
+// ParseChannelMap parses comma separated prefix=channel rules, e.g.
+// /movies=123,/backups=456.
+func ParseChannelMap(text string) ([]ChannelRule, error) {
+	var rules []ChannelRule
+	for _, rule := range strings.Split(text, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		prefix, channel, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("channel rule %q: must be /path=channel", rule)
+		}
+		channelID, err := strconv.ParseInt(strings.TrimSpace(channel), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("channel rule %q: %w", rule, err)
+		}
+		rules = append(rules, ChannelRule{Prefix: path.Clean("/" + strings.TrimSpace(prefix)), ChannelID: channelID})
+	}
+	return rules, nil
+}
+
+// WithChannelMap uploads the files below the prefix of a rule into its
+// channel instead of the default one. The longest matching prefix wins.
+func WithChannelMap(rules []ChannelRule) UploadOption {
+	return func(u *UploadService) {
+		u.channelRules = rules
+	}
+}
+
+// channelFor returns the channel of the files uploaded into destDir.
+func (u *UploadService) channelFor(destDir string) int64 {
+	if settings := u.settingsFor(destDir); settings != nil && settings.channelID != 0 {
+		return settings.channelID
+	}
+	destDir = path.Clean("/" + strings.ReplaceAll(destDir, "\\", "/"))
+	channelID, longest := u.channelID, -1
+	for _, rule := range u.channelRules {
+		if len(rule.Prefix) <= longest {
+			continue
+		}
+		if rule.Prefix == "/" || destDir == rule.Prefix || strings.HasPrefix(destDir, rule.Prefix+"/") {
+			channelID, longest = rule.ChannelID, len(rule.Prefix)
+		}
+	}
+	return channelID
+}
+
+// Channels returns the channels of the user the files can be uploaded to.
+func (u *UploadService) Channels() ([]types.Channel, error) {
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/api/users/channels",
+	}
+	var channels []types.Channel
+	err := u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(u.ctx, &opts, nil, &channels)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	return channels, err
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"io"
+	"path"
+	"uploader/pkg/state"
+	"uploader/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// WithChecksum compares local files with the remote ones by the hash of
+// their content, SHA-256 unless set by WithHashAlgorithm, recorded in index
+// when uploading them: a file with a known hash is skipped even if renamed,
+// and a file whose content changed is uploaded again, replacing the remote
+// one. Files uploaded before, without a recorded hash, are compared by name
+// and size.
+func WithChecksum(index *state.HashIndex) UploadOption {
+	return func(u *UploadService) {
+		u.hashes = index
+	}
+}
+
+// contentHash returns the content hash of a local source, or "" if
+// checksums are disabled or the source isn't local, as remote sources would
+// be read twice.
+func (u *UploadService) contentHash(ctx context.Context, src Source) (string, error) {
+	if _, ok := asLocal(src); !ok || u.hashes == nil {
+		return "", nil
+	}
+	defer u.Progress.StartPhase("hashing %s", src.Name())()
+	r, err := src.Open(ctx, 0, src.Size())
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := u.newContentHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return u.formatContentHash(h.Sum(nil)), nil
+}
+
+// compareChecksum decides about a file with the given content hash by the
+// recorded hashes. It returns whether the file is already uploaded, the
+// remote file to compare by size when nothing is recorded about it, and the
+// remote file whose content changed, replaced once the new content is
+// uploaded.
+func (u *UploadService) compareChecksum(ctx context.Context, hash string, existing *types.FileInfo, fileName string, destDir string) (bool, *types.FileInfo, *types.FileInfo, error) {
+	if existing != nil {
+		stored := u.storedHash(path.Join(destDir, existing.Name))
+		switch {
+		case stored == "":
+			return false, existing, nil, nil
+		case stored == hash:
+			return true, existing, nil, nil
+		}
+		u.logger.Info("replacing remote file with changed content", zap.String("fileName", fileName), zap.String("destDir", destDir))
+		return false, nil, existing, nil
+	}
+
+	renamed, err := u.findRenamed(ctx, hash, fileName, destDir)
+	return renamed, nil, nil, err
+}
+
+// findRenamed reports whether a file with the given hash was uploaded into
+// destDir under another name that still exists.
+func (u *UploadService) findRenamed(ctx context.Context, hash string, fileName string, destDir string) (bool, error) {
+	for _, remotePath := range u.hashes.Find(hash, destDir) {
+		file, err := u.findFile(ctx, path.Base(remotePath), destDir)
+		if err != nil {
+			return false, err
+		}
+		if file != nil {
+			u.logger.Info("file already uploaded under another name", zap.String("fileName", fileName), zap.String("remotePath", remotePath))
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hashFirst reports whether the content hash of src must be computed before
+// uploading it. With a single pass, it is computed while uploading unless
+// the existing remote file has to be compared with it.
+func (u *UploadService) hashFirst(src Source, existing *types.FileInfo, destDir string) bool {
+	if !u.singlePass {
+		return true
+	}
+	return existing != nil && u.hashes != nil && u.storedHash(path.Join(destDir, existing.Name)) != ""
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// NewClient returns a client for the Teldrive API at apiURL, authenticated
+// with the user session token. Its requests are adapted to the API of the
+// server by the profile named compat, or the one matching the version of
+// the server for CompatAuto.
+func NewClient(apiURL, sessionToken string, compat string, transport http.RoundTripper) *rest.Client {
+	authCookie := &http.Cookie{
+		Name:  sessionCookie,
+		Value: sessionToken,
+	}
+	return rest.NewClient(&http.Client{Transport: newCompatTransport(apiURL, compat, transport)}).SetRoot(apiURL).SetCookie(authCookie)
+}
+
+// NewPacer returns the pacer used to retry and rate limit the API calls.
+func NewPacer(ctx context.Context) *fs.Pacer {
+	return fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(400*time.Millisecond),
+		pacer.MaxSleep(5*time.Second), pacer.DecayConstant(2), pacer.AttackConstant(0)))
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"uploader/pkg/types"
+)
+
+// CompatAuto picks the API profile matching the version the server
+// reports.
+const CompatAuto = "auto"
+
+// sessionCookie is the cookie the client authenticates with, renamed by
+// the profiles of servers expecting another one.
+const sessionCookie = "user-session"
+
+// APIProfile describes how a range of Teldrive releases expects the
+// requests the uploader sends, which are written for the v1 API.
+type APIProfile struct {
+	Name string
+	// Since is the oldest release of the profile.
+	Since string
+	// AuthCookie is the cookie holding the session token.
+	AuthCookie string
+	// Bearer also sends the session token in the Authorization header.
+	Bearer bool
+	// Paths maps the prefixes of the v1 endpoints to the ones of the
+	// profile.
+	Paths map[string]string
+	// Fields maps the JSON field names of the v1 payloads to the ones of
+	// the profile, and back for the responses.
+	Fields map[string]string
+}
+
+// apiProfiles are the known API profiles, newest first. The legacy one is
+// only used when set explicitly, since servers not reporting their
+// version are not necessarily old.
+var apiProfiles = []APIProfile{
+	{
+		Name:       "v1.5",
+		Since:      "1.5.0",
+		AuthCookie: "access_token",
+		Bearer:     true,
+	},
+	{
+		Name:       "v1",
+		Since:      MinServerVersion,
+		AuthCookie: sessionCookie,
+	},
+	{
+		Name:       "legacy",
+		AuthCookie: sessionCookie,
+		Paths:      map[string]string{"/api/uploads/": "/api/upload/"},
+		Fields: map[string]string{
+			"channelId": "channel_id",
+			"mimeType":  "mime_type",
+			"partId":    "part_id",
+			"partNo":    "part_no",
+			"parentId":  "parent_id",
+		},
+	},
+}
+
+// ValidCompat reports whether mode is auto or the name of an API profile.
+func ValidCompat(mode string) bool {
+	if mode == CompatAuto {
+		return true
+	}
+	_, ok := apiProfileNamed(mode)
+	return ok
+}
+
+func apiProfileNamed(name string) (APIProfile, bool) {
+	for _, profile := range apiProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return APIProfile{}, false
+}
+
+// APIProfileFor returns the API profile of a server reporting version, or
+// the v1 one for a nil version of servers not reporting it.
+func APIProfileFor(version *types.ServerVersion) APIProfile {
+	if version != nil {
+		for _, profile := range apiProfiles {
+			if profile.Since != "" && compareVersions(version.Version, profile.Since) >= 0 {
+				return profile
+			}
+		}
+	}
+	profile, _ := apiProfileNamed("v1")
+	return profile
+}
+
+// compatTransport adapts the requests of the client to the API profile of
+// the server, detected with the first request unless set by mode.
+type compatTransport struct {
+	base    http.RoundTripper
+	apiURL  string
+	mode    string
+	once    sync.Once
+	profile APIProfile
+}
+
+func newCompatTransport(apiURL string, mode string, base http.RoundTripper) *compatTransport {
+	return &compatTransport{base: base, apiURL: strings.TrimSuffix(apiURL, "/"), mode: mode}
+}
+
+func (t *compatTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.once.Do(func() {
+		t.profile = t.detect(req.Context())
+	})
+	p := t.profile
+	if p.AuthCookie == sessionCookie && !p.Bearer && len(p.Paths) == 0 && len(p.Fields) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name == sessionCookie {
+			cookie.Name = p.AuthCookie
+			if p.Bearer {
+				req.Header.Set("Authorization", "Bearer "+cookie.Value)
+			}
+		}
+		req.AddCookie(cookie)
+	}
+	for from, to := range p.Paths {
+		if strings.HasPrefix(req.URL.Path, from) {
+			req.URL.Path = to + strings.TrimPrefix(req.URL.Path, from)
+			req.URL.RawPath = ""
+			break
+		}
+	}
+	if len(p.Fields) > 0 && req.Body != nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		body, err := renameJSON(req.Body, p.Fields)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || len(p.Fields) == 0 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return resp, err
+	}
+	fields := make(map[string]string, len(p.Fields))
+	for from, to := range p.Fields {
+		fields[to] = from
+	}
+	body, err := renameJSON(resp.Body, fields)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// detect returns the API profile set by mode, or the one of the version
+// the server reports. The v1 profile is kept when it can't be asked or
+// doesn't report it.
+func (t *compatTransport) detect(ctx context.Context) APIProfile {
+	if profile, ok := apiProfileNamed(t.mode); ok {
+		return profile
+	}
+	fallback, _ := apiProfileNamed("v1")
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", t.apiURL+"/api/version", nil)
+	if err != nil {
+		return fallback
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return fallback
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fallback
+	}
+	var version types.ServerVersion
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return fallback
+	}
+	return APIProfileFor(&version)
+}
+
+// renameJSON reads a JSON document from r and renames the fields of its
+// objects, at any depth, as given by fields.
+func renameJSON(r io.ReadCloser, fields map[string]string) ([]byte, error) {
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return data, nil
+	}
+	// numbers are kept as written, IDs and sizes may not fit a float64
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("rename json fields: %w", err)
+	}
+	return json.Marshal(renameFields(doc, fields))
+}
+
+func renameFields(v interface{}, fields map[string]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if to, ok := fields[key]; ok {
+				key = to
+			}
+			renamed[key] = renameFields(value, fields)
+		}
+		return renamed
+	case []interface{}:
+		for i, value := range v {
+			v[i] = renameFields(value, fields)
+		}
+	}
+	return v
+}
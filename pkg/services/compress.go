@@ -0,0 +1,115 @@
+package services
+
+import (
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+// compressionExtensions maps the supported compression algorithms to the
+// extension appended to the name of the compressed files, so other tools
+// know how to decompress them.
+var compressionExtensions = map[string]string{
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// incompressibleExtensions are formats that are already compressed.
+var incompressibleExtensions = map[string]bool{
+	".7z": true, ".avi": true, ".br": true, ".bz2": true, ".flac": true, ".gif": true,
+	".gz": true, ".heic": true, ".jpeg": true, ".jpg": true, ".m4a": true, ".mkv": true,
+	".mov": true, ".mp3": true, ".mp4": true, ".ogg": true, ".opus": true, ".png": true,
+	".rar": true, ".tgz": true, ".webm": true, ".webp": true, ".xz": true, ".zip": true,
+	".zst": true,
+}
+
+// ValidCompression reports whether algorithm is supported by WithCompression.
+func ValidCompression(algorithm string) bool {
+	_, ok := compressionExtensions[algorithm]
+	return ok
+}
+
+// WithCompression compresses every file worth compressing with the
+// algorithm, zstd or gzip, before uploading it. Media and archives are
+// uploaded as they are.
+func WithCompression(algorithm string) UploadOption {
+	return func(u *UploadService) {
+		u.compression = algorithm
+	}
+}
+
+func (u *UploadService) shouldCompress(src Source, mimeType string) bool {
+	if u.compression == "" || src.Size() == 0 {
+		return false
+	}
+	// volumes must stay plain byte ranges to be joined back
+	if _, ok := src.(*volumeSource); ok {
+		return false
+	}
+	if incompressibleExtensions[strings.ToLower(path.Ext(src.Name()))] {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"),
+		strings.HasPrefix(mimeType, "image/") && mimeType != "image/bmp" && mimeType != "image/svg+xml",
+		mimeType == "application/zip",
+		mimeType == "application/x-gzip",
+		mimeType == "application/x-rar-compressed":
+		return false
+	}
+	return true
+}
+
+func newCompressor(w io.Writer, algorithm string) (io.WriteCloser, error) {
+	if algorithm == "gzip" {
+		return gzip.NewWriter(w), nil
+	}
+	return zstd.NewWriter(w)
+}
+
+// uploadCompressed streams src through the compressor into destDir, the
+// compressed size is only known once the whole file was read.
+func (u *UploadService) uploadCompressed(src Source, historyPath string, destDir string) (err error) {
+	fileName := src.Name() + compressionExtensions[u.compression]
+
+	exists, err := u.checkFileExists(u.ctx, fileName, destDir)
+	if err != nil {
+		return err
+	}
+	if exists {
+		u.Progress.AddExisting(src.Size())
+		u.recordTransfer(historyPath, destDir, src.Size(), time.Now(), true, nil)
+		u.logger.Info("file exists", zap.String("fileName", fileName))
+		return nil
+	}
+
+	rc, err := src.Open(u.ctx, 0, src.Size())
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		zw, err := newCompressor(pw, u.compression)
+		if err == nil {
+			_, err = io.Copy(zw, rc)
+			if closeErr := zw.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// the stream counts the compressed bytes instead
+	u.Progress.AddTransfer(-1, -src.Size())
+	err = u.UploadStream(pr, historyPath, fileName, destDir)
+	pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"uploader/pkg/types"
+
+	"github.com/gofrs/uuid"
+	"github.com/rclone/rclone/lib/rest"
+	"go.uber.org/zap"
+)
+
+// ErrConflict is returned when another file with the same name was created
+// in the destination while uploading, and it isn't the same file.
+var ErrConflict = errors.New("a different file with the same name already exists")
+
+// ErrSizeMismatch is returned for files existing on the remote with another
+// size, likely truncated by an earlier failed run, unless WithSizeOnly
+// replaces them.
+var ErrSizeMismatch = errors.New("remote file has a different size")
+
+// errAlreadyUploaded is returned by finalize when the destination already
+// holds the file, e.g. uploaded by another run at the same time.
+var errAlreadyUploaded = errors.New("file already uploaded")
+
+// resolveConflict handles a finalize rejected because the name is taken.
+// The parts just sent aren't referenced by any file, so they are removed
+// from the channel either way; the upload counts as done if the remote
+// file has the same size.
+func (u *UploadService) resolveConflict(ctx context.Context, uploadURL string, filePayload *types.FilePayload) error {
+	remote, err := u.findFile(ctx, filePayload.Name, filePayload.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := u.discardParts(ctx, uploadURL, filePayload); err != nil {
+		u.logger.Error("remove duplicate parts failed", zap.String("fileName", filePayload.Name), zap.Error(err))
+	}
+
+	if remote != nil && remote.Type == "file" && remote.Size == filePayload.Size {
+		return errAlreadyUploaded
+	}
+	if remote == nil {
+		return fmt.Errorf("%w: %s in %s", ErrConflict, filePayload.Name, filePayload.Path)
+	}
+	return fmt.Errorf("%w: %s in %s has %d bytes, expected %d", ErrConflict, filePayload.Name, filePayload.Path, remote.Size, filePayload.Size)
+}
+
+// discardParts removes uploaded parts from the channel. The API only
+// deletes the messages of files, so the parts are finalized under a unique
+// name first and that file is deleted right away.
+func (u *UploadService) discardParts(ctx context.Context, uploadURL string, filePayload *types.FilePayload) error {
+	discard := *filePayload
+	discard.Name = tempName(filePayload.Name, "discard")
+
+	var created types.FileInfo
+	err := u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(ctx, &rest.Opts{Method: "POST", Path: "/api/files"}, &discard, &created)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err != nil {
+		return err
+	}
+	if err := u.deleteFile(ctx, created.Id); err != nil {
+		return err
+	}
+
+	return u.deleteSession(ctx, uploadURL)
+}
+
+// replaceFile finalizes the parts of filePayload as the new version of old.
+// The file is created under a unique name first, then old is deleted and the
+// new file takes its name, so a failed upload leaves old in place.
+func (u *UploadService) replaceFile(ctx context.Context, uploadURL string, filePayload *types.FilePayload, old *types.FileInfo) (string, error) {
+	temp := *filePayload
+	temp.Name = tempName(filePayload.Name, "replace")
+	id, err := u.finalize(ctx, uploadURL, &temp, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := u.deleteFile(ctx, old.Id); err != nil {
+		if err := u.deleteFile(ctx, id); err != nil {
+			u.logger.Error("remove replacing file failed", zap.String("fileName", temp.Name), zap.Error(err))
+		}
+		return "", err
+	}
+	if err := u.renameFile(ctx, id, filePayload.Name); err != nil {
+		return "", fmt.Errorf("rename %s to %s: %w", temp.Name, filePayload.Name, err)
+	}
+	return id, nil
+}
+
+// tempName returns a unique hidden name for a file standing in for name
+// while kind, e.g. discard, is done with it.
+func tempName(name, kind string) string {
+	id, _ := uuid.NewV4()
+	return fmt.Sprintf(".%s.%s.%s", name, hex.EncodeToString(id.Bytes()), kind)
+}
+
+// WithSizeOnly compares existing files by size: a remote file with the same
+// name but another size is replaced by the file once uploaded, instead of
+// failing with ErrSizeMismatch.
+func WithSizeOnly() UploadOption {
+	return func(u *UploadService) {
+		u.sizeOnly = true
+	}
+}
+
+// resolveSizeMismatch handles a remote file named like the file being
+// uploaded but of another size. It returns nil when the remote file is to be
+// replaced by the upload once finalized, so the upload can go ahead.
+func (u *UploadService) resolveSizeMismatch(existing *types.FileInfo, size int64, destDir string) error {
+	if existing.Type != "file" || !u.sizeOnly {
+		u.logger.Warn("remote file has a different size", zap.String("fileName", existing.Name), zap.String("destDir", destDir), zap.Int64("remoteSize", existing.Size), zap.Int64("fileSize", size))
+		return fmt.Errorf("%w: %s in %s has %d bytes, expected %d", ErrSizeMismatch, existing.Name, destDir, existing.Size, size)
+	}
+	u.logger.Info("replacing remote file of a different size", zap.String("fileName", existing.Name), zap.Int64("remoteSize", existing.Size), zap.Int64("fileSize", size))
+	return nil
+}
+
+// deleteFile deletes a remote file along with its parts in the channel.
+func (u *UploadService) deleteFile(ctx context.Context, id string) error {
+	err := u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(ctx, &rest.Opts{Method: "POST", Path: "/api/files/delete"}, map[string][]string{"files": {id}}, nil)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err == nil {
+		u.deletedFile(id)
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+	"uploader/pkg/chunker"
+	"uploader/pkg/state"
+
+	"go.uber.org/zap"
+)
+
+// Snapshot is the manifest of a deduplicated backup, stored as
+// snapshots/<time>.json in the repository. Every file is the concatenation
+// of its chunks, which are stored as chunks/<xx>/<sha256> where xx are the
+// first two characters of the hash.
+type Snapshot struct {
+	Time   time.Time      `json:"time"`
+	Source string         `json:"source"`
+	Files  []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a file of a snapshot.
+type SnapshotFile struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Chunks  []string    `json:"chunks"`
+}
+
+// bytesSource is a chunk held in memory.
+type bytesSource struct {
+	name string
+	data []byte
+}
+
+func (s *bytesSource) Name() string       { return s.name }
+func (s *bytesSource) Size() int64        { return int64(len(s.data)) }
+func (s *bytesSource) ModTime() time.Time { return time.Time{} }
+func (s *bytesSource) String() string     { return s.name }
+
+func (s *bytesSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.data[offset : offset+length])), nil
+}
+
+// DedupBackup backs up sourceDir into the repository at repoDir: the files
+// are split in content-defined chunks, only the chunks missing from the
+// index are uploaded, and a snapshot listing the chunks of every file is
+// stored last, so a snapshot only exists once all its chunks do.
+func (u *UploadService) DedupBackup(sourceDir string, repoDir string, index *state.ChunkIndex) (*Snapshot, error) {
+	absDir, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Time: time.Now().UTC(), Source: absDir}
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		uploadErr  error
+		pending    = map[string]bool{}
+		createdDir = map[string]bool{}
+		newChunks  int
+		newBytes   int64
+	)
+	concurrentChunks := make(chan struct{}, cap(u.concurrentFiles))
+
+	uploadChunk := func(hash string, data []byte) {
+		defer wg.Done()
+		defer func() {
+			<-concurrentChunks
+		}()
+
+		dir := path.Join(repoDir, "chunks", hash[:2])
+		mu.Lock()
+		var err error
+		if !createdDir[dir] {
+			if err = u.CreateRemoteDir(dir); err == nil {
+				createdDir[dir] = true
+			}
+		}
+		mu.Unlock()
+
+		if err == nil {
+			u.Progress.AddTransfer(1, int64(len(data)))
+			err = u.UploadSource(&bytesSource{name: hash, data: data}, dir)
+		}
+		if err == nil {
+			err = index.Add(hash)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		delete(pending, hash)
+		if err != nil && uploadErr == nil {
+			uploadErr = err
+		}
+	}
+
+	err = filepath.WalkDir(absDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(absDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		file := SnapshotFile{Path: filepath.ToSlash(rel), Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+		chunks := chunker.New(f)
+		for {
+			chunk, err := chunks.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(chunk)
+			hash := hex.EncodeToString(sum[:])
+			file.Chunks = append(file.Chunks, hash)
+
+			mu.Lock()
+			failed := uploadErr
+			known := pending[hash] || index.Has(hash)
+			if !known {
+				pending[hash] = true
+				newChunks++
+				newBytes += int64(len(chunk))
+			}
+			mu.Unlock()
+			if failed != nil {
+				return failed
+			}
+			if known {
+				continue
+			}
+
+			wg.Add(1)
+			concurrentChunks <- struct{}{}
+			go uploadChunk(hash, append([]byte(nil), chunk...))
+		}
+		snapshot.Files = append(snapshot.Files, file)
+		return nil
+	})
+	wg.Wait()
+	if err == nil {
+		err = uploadErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	snapshotDir := path.Join(repoDir, "snapshots")
+	if err := u.CreateRemoteDir(snapshotDir); err != nil {
+		return nil, err
+	}
+	name := snapshot.Time.Format("2006-01-02T15-04-05Z") + ".json"
+	if err := u.UploadStream(bytes.NewReader(data), absDir, name, snapshotDir); err != nil {
+		return nil, err
+	}
+
+	u.logger.Info("snapshot saved", zap.String("snapshot", path.Join(snapshotDir, name)), zap.Int("files", len(snapshot.Files)), zap.Int("newChunks", newChunks), zap.Int64("newBytes", newBytes))
+	return snapshot, nil
+}
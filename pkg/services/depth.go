@@ -0,0 +1,31 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// WithMaxDepth only uploads the files of a folder down to depth levels
+// below it: 1 uploads only the files directly in the folder. 0 uploads
+// everything.
+func WithMaxDepth(depth int) UploadOption {
+	return func(u *UploadService) {
+		u.maxDepth = depth
+	}
+}
+
+// descend reports whether the files of the folders found at level, 1 for
+// the uploaded folder itself, are uploaded.
+func (u *UploadService) descend(level int) bool {
+	return u.maxDepth <= 0 || level < u.maxDepth
+}
+
+// skipDir reports whether dir, found while walking root, is too deep.
+func (u *UploadService) skipDir(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+	level := strings.Count(filepath.ToSlash(rel), "/") + 1
+	return !u.descend(level)
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// remoteDirs memoizes the remote folders created by this run, so they
+// aren't created again.
+type remoteDirs struct {
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+// exists reports whether dir was created by this run.
+func (d *remoteDirs) exists(dir string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.created[path.Clean(dir)]
+}
+
+// add records that dir was created.
+func (d *remoteDirs) add(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.created == nil {
+		d.created = map[string]bool{}
+	}
+	d.created[path.Clean(dir)] = true
+}
+
+// remoteDirCreated records that dir was created, along with the missing
+// folders above it, from the top down so the new ones are known to be empty.
+func (u *UploadService) remoteDirCreated(dir string) {
+	dir = path.Clean(dir)
+	var above []string
+	for d := path.Dir(dir); d != "/" && d != "."; d = path.Dir(d) {
+		above = append(above, d)
+	}
+	for i := len(above) - 1; i >= 0; i-- {
+		u.createdDir(above[i])
+		u.dirs.add(above[i])
+	}
+	u.createdDir(dir)
+	u.dirs.add(dir)
+}
+
+// EnsureRemoteDirs creates the folders of dirs not created by this run yet
+// with the fewest requests: the server creates the missing folders above a
+// folder along with it, so only the deepest ones are created.
+func (u *UploadService) EnsureRemoteDirs(dirs ...string) error {
+	wanted := map[string]bool{}
+	for _, dir := range dirs {
+		dir = path.Clean("/" + strings.ReplaceAll(dir, "\\", "/"))
+		if dir != "/" && !u.dirs.exists(dir) {
+			wanted[dir] = true
+		}
+	}
+	covered := map[string]bool{}
+	for dir := range wanted {
+		for d := path.Dir(dir); d != "/"; d = path.Dir(d) {
+			covered[d] = true
+		}
+	}
+
+	deepest := make([]string, 0, len(wanted))
+	for dir := range wanted {
+		if !covered[dir] {
+			deepest = append(deepest, dir)
+		}
+	}
+	sort.Strings(deepest)
+	for _, dir := range deepest {
+		if err := u.CreateRemoteDir(dir); err != nil {
+			return fmt.Errorf("create %s: %w", dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"path"
+	"sort"
+	"sync"
+	"uploader/pkg/types"
+)
+
+// DirUsage is the disk usage of a remote directory, including its
+// subdirectories.
+type DirUsage struct {
+	Path  string
+	Size  int64
+	Files int
+	Dirs  []*DirUsage
+}
+
+// DiskUsage returns the usage of dir and every directory below it, listing
+// up to concurrency directories at once. Subdirectories are sorted by size,
+// biggest first.
+func (u *UploadService) DiskUsage(dir string, concurrency int) (*DirUsage, error) {
+	root := &DirUsage{Path: path.Clean("/" + dir)}
+	dirs := map[string]*DirUsage{root.Path: root}
+	err := u.walkRemote(root.Path, -1, concurrency, func(dir string, files []types.FileInfo) {
+		d := dirs[dir]
+		for _, file := range files {
+			if file.Type == "folder" {
+				sub := &DirUsage{Path: path.Join(dir, file.Name)}
+				d.Dirs = append(d.Dirs, sub)
+				dirs[sub.Path] = sub
+				continue
+			}
+			d.Size += file.Size
+			d.Files++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	root.total()
+	return root, nil
+}
+
+// total adds the usage of the subdirectories to d and sorts them.
+func (d *DirUsage) total() {
+	for _, sub := range d.Dirs {
+		sub.total()
+		d.Size += sub.Size
+		d.Files += sub.Files
+	}
+	sort.SliceStable(d.Dirs, func(i, j int) bool {
+		return d.Dirs[i].Size > d.Dirs[j].Size
+	})
+}
+
+// walkRemote lists dir and the directories below it, down to maxDepth levels
+// or all of them if negative, up to concurrency at once or the number set
+// by WithListing if zero, and calls fn with the contents of each. The calls to fn are never concurrent.
+func (u *UploadService) walkRemote(dir string, maxDepth, concurrency int, fn func(dir string, files []types.FileInfo)) error {
+	if concurrency < 1 {
+		concurrency = u.listConcurrency
+	}
+	w := &remoteWalker{u: u, fn: fn, maxDepth: maxDepth, sem: make(chan struct{}, concurrency)}
+	w.walk(path.Clean("/"+dir), 0)
+	w.wg.Wait()
+	return w.err
+}
+
+type remoteWalker struct {
+	u        *UploadService
+	fn       func(dir string, files []types.FileInfo)
+	maxDepth int
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	err      error
+}
+
+// walk lists dir in the background and walks its subdirectories.
+func (w *remoteWalker) walk(dir string, depth int) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.sem <- struct{}{}
+		files, err := w.u.list(dir)
+		<-w.sem
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			return
+		}
+		if w.err != nil {
+			return
+		}
+		w.fn(dir, files)
+		if w.maxDepth >= 0 && depth >= w.maxDepth {
+			return
+		}
+		for _, file := range files {
+			if file.Type == "folder" {
+				w.walk(path.Join(dir, file.Name), depth+1)
+			}
+		}
+	}()
+}
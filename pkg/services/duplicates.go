@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"uploader/pkg/state"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// DuplicateGroup is a set of files of a remote directory holding the same
+// content, oldest first.
+type DuplicateGroup struct {
+	Dir   string
+	Files []types.FileInfo
+}
+
+// FindDuplicates returns the groups of files with the same name and size in
+// every directory below dir. With hashes, files are grouped by the content
+// hash recorded when uploading them instead, whatever their names; files
+// without a recorded hash are never duplicates then.
+func (u *UploadService) FindDuplicates(dir string, hashes *state.HashIndex) ([]DuplicateGroup, error) {
+	dir = path.Clean("/" + dir)
+	tree, err := u.ListTree(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*DuplicateGroup{}
+	for rel, entries := range tree {
+		fileDir := path.Join(dir, path.Dir(rel))
+		for _, file := range entries {
+			if file.Type == "folder" {
+				continue
+			}
+			key := fmt.Sprintf("%s\x00%s\x00%d", fileDir, u.nameKey(file.Name), file.Size)
+			if hashes != nil {
+				hash := hashes.Get(path.Join(fileDir, file.Name))
+				if hash == "" {
+					continue
+				}
+				key = fileDir + "\x00" + hash
+			}
+			if groups[key] == nil {
+				groups[key] = &DuplicateGroup{Dir: fileDir}
+			}
+			groups[key].Files = append(groups[key].Files, file)
+		}
+	}
+
+	var duplicates []DuplicateGroup
+	for _, group := range groups {
+		if len(group.Files) > 1 {
+			sort.SliceStable(group.Files, func(i, j int) bool {
+				return group.Files[i].ModTime < group.Files[j].ModTime
+			})
+			duplicates = append(duplicates, *group)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Dir != duplicates[j].Dir {
+			return duplicates[i].Dir < duplicates[j].Dir
+		}
+		return duplicates[i].Files[0].Name < duplicates[j].Files[0].Name
+	})
+	return duplicates, nil
+}
+
+// DeleteFile deletes a remote file by ID along with its parts.
+func (u *UploadService) DeleteFile(id string) error {
+	return u.deleteFile(u.ctx, id)
+}
+
+// RenameFile renames a remote file by ID.
+func (u *UploadService) RenameFile(id string, name string) error {
+	return u.renameFile(u.ctx, id, name)
+}
+
+func (u *UploadService) renameFile(ctx context.Context, id string, name string) error {
+	opts := rest.Opts{
+		Method: "PATCH",
+		Path:   "/api/files/" + id,
+	}
+	err := u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(ctx, &opts, map[string]string{"name": name}, nil)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err == nil {
+		u.renamedFile(id, name)
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns what identifies a local file whatever the path it's
+// reached through: its device and inode.
+func fileID(filePath string) string {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return absPath(filePath)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+	}
+	return absPath(filePath)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package services
+
+import "strings"
+
+// fileID returns what identifies a local file: its absolute path, as paths
+// are case-insensitive on Windows.
+func fileID(filePath string) string {
+	return strings.ToLower(absPath(filePath))
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// Stat returns the remote file or folder at filePath.
+func (u *UploadService) Stat(filePath string) (*types.FileInfo, error) {
+	filePath = path.Clean("/" + filePath)
+	dir, name := path.Split(filePath)
+	file, err := u.findFile(u.ctx, name, path.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s: %w", filePath, fs.ErrorObjectNotFound)
+	}
+	return file, nil
+}
+
+// Metadata returns the full metadata of the file or folder with the given ID.
+func (u *UploadService) Metadata(id string) (*types.FileMetadata, error) {
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/api/files/" + id,
+	}
+	var info types.FileMetadata
+	err := u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(u.ctx, &opts, nil, &info)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// List returns the files and folders of the remote directory dir.
+func (u *UploadService) List(dir string) ([]types.FileInfo, error) {
+	return u.list(path.Clean("/" + dir))
+}
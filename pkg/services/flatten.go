@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Flatten collision policies.
+const (
+	// FlattenSuffix numbers the names taken by another file: "file (1).txt".
+	FlattenSuffix = "suffix"
+	// FlattenPrefix prefixes the names taken by another file with their
+	// folders: "folder_sub_file.txt".
+	FlattenPrefix = "prefix"
+)
+
+// WithFlatten uploads all the files of a folder tree into the destination
+// itself, renaming files whose name is already taken according to policy,
+// FlattenSuffix or FlattenPrefix.
+func WithFlatten(policy string) UploadOption {
+	return func(u *UploadService) {
+		u.flatten = policy
+	}
+}
+
+// ValidFlattenPolicy reports whether policy is a flatten collision policy.
+func ValidFlattenPolicy(policy string) bool {
+	return policy == FlattenSuffix || policy == FlattenPrefix
+}
+
+// flattener returns the mapping of relative paths to unique names, or nil
+// if flattening is disabled. Files are walked in lexical order, so the
+// same tree is always flattened the same way.
+func (u *UploadService) flattener() func(rel string) string {
+	if u.flatten == "" {
+		return nil
+	}
+	taken := map[string]bool{}
+	return func(rel string) string {
+		name := path.Base(rel)
+		if taken[u.nameKey(name)] && u.flatten == FlattenPrefix {
+			name = strings.ReplaceAll(rel, "/", "_")
+		}
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 1; taken[u.nameKey(name)]; i++ {
+			name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+		taken[u.nameKey(name)] = true
+		return name
+	}
+}
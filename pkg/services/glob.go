@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// IsGlob reports whether pattern holds glob metacharacters.
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// GlobMatches are the local files matching a glob pattern.
+type GlobMatches struct {
+	// Base is the folder the pattern is relative to, the leading elements
+	// of the pattern without metacharacters.
+	Base  string
+	Files []string
+	Size  int64
+}
+
+// ExpandGlob returns the files matching pattern, as shells do on Linux but
+// cmd and PowerShell don't on Windows. Elements are matched as with
+// filepath.Match, and a ** element matches any number of folders. Folders
+// themselves are never matched, and names are matched without case on
+// Windows.
+func ExpandGlob(pattern string) (*GlobMatches, error) {
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	first := 0
+	for first < len(elems) && !IsGlob(elems[first]) {
+		first++
+	}
+	if first == len(elems) {
+		return nil, fmt.Errorf("%s isn't a glob pattern", pattern)
+	}
+
+	base := strings.Join(elems[:first], "/")
+	switch {
+	case first > 0 && base == "":
+		base = "/"
+	case base == "":
+		base = "."
+	case filepath.VolumeName(base) == base:
+		base += "/"
+	}
+	matches := &GlobMatches{Base: filepath.FromSlash(base)}
+
+	glob := elems[first:]
+	recursive := false
+	for i, elem := range glob {
+		if elem == "**" {
+			recursive = true
+			continue
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %s: %w", pattern, err)
+		}
+		if runtime.GOOS == "windows" {
+			glob[i] = strings.ToLower(elem)
+		}
+	}
+
+	err := filepath.WalkDir(matches.Base, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if fullPath == matches.Base {
+			return nil
+		}
+		rel, err := filepath.Rel(matches.Base, fullPath)
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" {
+			rel = strings.ToLower(rel)
+		}
+		names := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			// without ** only the folders at the level of the
+			// pattern elements can hold matches
+			if !recursive && (len(names) >= len(glob) || !matchGlob(glob[:len(names)], names)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !matchGlob(glob, names) {
+			return nil
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return err
+		}
+		matches.Files = append(matches.Files, fullPath)
+		matches.Size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// matchGlob reports whether the path elements names match the pattern
+// elements glob.
+func matchGlob(glob []string, names []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchGlob(glob[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], names[0]); !ok {
+			return false
+		}
+		glob, names = glob[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// UploadGlob uploads the files matching a glob pattern into destDir,
+// keeping their folders relative to the base of the pattern.
+func (u *UploadService) UploadGlob(matches *GlobMatches, destDir string) error {
+	mapPath := u.pathMapper()
+	if mapPath == nil {
+		mapPath = func(rel string) string { return rel }
+	}
+	enqueue := u.mappedEnqueuer(destDir, mapPath)
+	for _, fullPath := range matches.Files {
+		rel, err := filepath.Rel(matches.Base, fullPath)
+		if err != nil {
+			return err
+		}
+		if err := enqueue(fullPath, filepath.ToSlash(rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
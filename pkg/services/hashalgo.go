@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// Content hash algorithms of WithHashAlgorithm.
+const (
+	HashMD5    = "md5"
+	HashSHA256 = "sha256"
+	// HashBLAKE3 is a cryptographic hash several times faster than SHA-256
+	HashBLAKE3 = "blake3"
+	// HashXXH3 is the fastest, but isn't cryptographic: a file can be
+	// crafted to match the hash of another
+	HashXXH3 = "xxh3"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	HashMD5:    md5.New,
+	HashSHA256: sha256.New,
+	HashBLAKE3: func() hash.Hash { return blake3.New() },
+	HashXXH3:   func() hash.Hash { return xxh3.New() },
+}
+
+// ValidHashAlgorithm reports whether name is a known content hash
+// algorithm.
+func ValidHashAlgorithm(name string) bool {
+	_, ok := hashAlgorithms[name]
+	return ok
+}
+
+// WithHashAlgorithm hashes the content of files with the given algorithm
+// for WithChecksum, instead of SHA-256, as hashing becomes the bottleneck of
+// fast links. The hashes recorded with another algorithm are ignored, so the
+// files are compared by name and size until uploaded again.
+func WithHashAlgorithm(name string) UploadOption {
+	return func(u *UploadService) {
+		if ValidHashAlgorithm(name) {
+			u.hashAlgorithm = name
+		}
+	}
+}
+
+// newContentHash returns a hash of the algorithm of the content hashes.
+func (u *UploadService) newContentHash() hash.Hash {
+	return hashAlgorithms[u.hashAlgorithm]()
+}
+
+// formatContentHash returns the sum of a content hash as recorded: in hex,
+// prefixed by the algorithm and a colon unless SHA-256, the algorithm of
+// the hashes recorded before others could be picked.
+func (u *UploadService) formatContentHash(sum []byte) string {
+	if u.hashAlgorithm == HashSHA256 {
+		return hex.EncodeToString(sum)
+	}
+	return u.hashAlgorithm + ":" + hex.EncodeToString(sum)
+}
+
+// storedHash returns the hash recorded for the file at remotePath, or "" if
+// unknown or recorded with another algorithm.
+func (u *UploadService) storedHash(remotePath string) string {
+	stored := u.hashes.Get(remotePath)
+	algorithm, _, ok := strings.Cut(stored, ":")
+	if !ok {
+		algorithm = HashSHA256
+	}
+	if algorithm != u.hashAlgorithm {
+		return ""
+	}
+	return stored
+}
@@ -0,0 +1,28 @@
+package services
+
+import "strings"
+
+// WithIgnoreCase treats names differing only in case, like Movie.mkv and
+// movie.mkv, as the same file when checking whether a file already exists
+// on the remote, as Windows and macOS file systems do.
+func WithIgnoreCase() UploadOption {
+	return func(u *UploadService) {
+		u.ignoreCase = true
+	}
+}
+
+// sameName reports whether two file names refer to the same remote entry.
+func (u *UploadService) sameName(a, b string) bool {
+	if u.ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// nameKey returns the key of a file name in maps of taken names.
+func (u *UploadService) nameKey(name string) string {
+	if u.ignoreCase {
+		return strings.ToLower(name)
+	}
+	return name
+}
@@ -0,0 +1,39 @@
+package services
+
+import "go.uber.org/zap"
+
+// sourceID returns what identifies the source at sourcePath, the same for
+// every path of a local file.
+func sourceID(sourcePath string) string {
+	if IsURL(sourcePath) || IsS3(sourcePath) {
+		return sourcePath
+	}
+	return fileID(sourcePath)
+}
+
+// claim marks the upload of the source identified by id as fileName into
+// destDir as queued, and reports false if it already is, e.g. because the
+// file was given twice. Two uploads of the same file would race for the
+// same upload session and name.
+func (u *UploadService) claim(id, fileName, destDir string) bool {
+	key := destDir + "\x00" + u.nameKey(fileName) + "\x00" + id
+	u.inFlightMu.Lock()
+	defer u.inFlightMu.Unlock()
+	if u.inFlight == nil {
+		u.inFlight = map[string]bool{}
+	}
+	if u.inFlight[key] {
+		u.logger.Info("file already queued", zap.String("fileName", fileName), zap.String("destDir", destDir))
+		return false
+	}
+	u.inFlight[key] = true
+	return true
+}
+
+// unclaim marks an upload claimed by claim as done.
+func (u *UploadService) unclaim(id, fileName, destDir string) {
+	key := destDir + "\x00" + u.nameKey(fileName) + "\x00" + id
+	u.inFlightMu.Lock()
+	defer u.inFlightMu.Unlock()
+	delete(u.inFlight, key)
+}
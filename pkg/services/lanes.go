@@ -0,0 +1,35 @@
+package services
+
+// maxQueuedFiles is how many files may wait for a transfer slot when the
+// small file lane is enabled, so the files walked after a big one can still
+// reach the small file lane.
+const maxQueuedFiles = 1000
+
+// WithSmallFileLane uploads the files of up to threshold bytes in a lane of
+// their own with transfers concurrent files, and with their own part
+// workers even with WithFairShare, so small files keep completing while big
+// ones take all the other workers.
+func WithSmallFileLane(threshold int64, transfers int) UploadOption {
+	if transfers < 1 {
+		transfers = 1
+	}
+	return func(u *UploadService) {
+		u.smallFileSize = threshold
+		u.smallFiles = make(chan struct{}, transfers)
+		u.queuedFiles = make(chan struct{}, maxQueuedFiles)
+	}
+}
+
+// inSmallFileLane reports whether a file of size bytes, -1 if unknown, goes
+// through the small file lane.
+func (u *UploadService) inSmallFileLane(size int64) bool {
+	return u.smallFiles != nil && size >= 0 && size <= u.smallFileSize
+}
+
+// fileLane returns the transfer slots of a file of size bytes.
+func (u *UploadService) fileLane(size int64) chan struct{} {
+	if u.inSmallFileLane(size) {
+		return u.smallFiles
+	}
+	return u.concurrentFiles
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/fs"
+	"go.uber.org/zap"
+)
+
+// listPageRetries is how many times a page of a listing is requested again
+// after the pacer gave up on it.
+const listPageRetries = 3
+
+// PartialListError is returned with the entries listed before a page of a
+// directory couldn't be read.
+type PartialListError struct {
+	Dir    string
+	Listed int
+	Err    error
+}
+
+func (e *PartialListError) Error() string {
+	return fmt.Sprintf("listing %s stopped after %d entries: %v", e.Dir, e.Listed, e.Err)
+}
+
+func (e *PartialListError) Unwrap() error { return e.Err }
+
+// WithListing sets the number of entries requested per page when listing
+// remote directories and how many directories the recursive commands list
+// at once. Zero keeps the defaults, 500 and 8.
+func WithListing(pageSize, concurrency int) UploadOption {
+	return func(u *UploadService) {
+		if pageSize > 0 {
+			u.listPageSize = pageSize
+		}
+		if concurrency > 0 {
+			u.listConcurrency = concurrency
+		}
+	}
+}
+
+// readPage reads a page of a listing, trying again a few times, with a
+// growing delay, if it fails.
+func (u *UploadService) readPage(ctx context.Context, path string, opts *types.MetadataRequestOptions) (*types.ReadMetadataResponse, error) {
+	for attempt := 1; ; attempt++ {
+		info, err := u.readMetaDataForPath(ctx, path, opts)
+		if err == nil || errors.Is(err, fs.ErrorDirNotFound) || ctx.Err() != nil || attempt > listPageRetries {
+			return info, err
+		}
+		u.logger.Warn("list page failed, retrying", zap.String("path", path), zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// destListings caches the complete listings of the destination directories
+// of directory uploads, so their files are checked against them instead of
+// with one find request each. The files created, deleted or renamed by the
+// run are updated in them.
+type destListings struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]types.FileInfo
+	// ids maps the IDs of the cached files to their directory
+	ids map[string]string
+}
+
+// listDest returns the listing of the destination directory dir, from the
+// cache if it was listed already. Complete listings are cached.
+func (u *UploadService) listDest(dir string) ([]types.FileInfo, error) {
+	dir = path.Clean(dir)
+	u.listings.mu.Lock()
+	if cached, ok := u.listings.dirs[dir]; ok {
+		files := make([]types.FileInfo, 0, len(cached))
+		for _, file := range cached {
+			files = append(files, file)
+		}
+		u.listings.mu.Unlock()
+		return files, nil
+	}
+	u.listings.mu.Unlock()
+
+	done := u.Progress.StartPhase("listing %s", dir)
+	files, err := u.list(dir)
+	done()
+	if err == nil {
+		u.cacheListing(dir, files)
+	}
+	return files, err
+}
+
+// cacheListing records the complete listing of dir.
+func (u *UploadService) cacheListing(dir string, files []types.FileInfo) {
+	byName := make(map[string]types.FileInfo, len(files))
+	for _, file := range files {
+		byName[u.nameKey(file.Name)] = file
+	}
+	u.listings.mu.Lock()
+	defer u.listings.mu.Unlock()
+	if u.listings.dirs == nil {
+		u.listings.dirs = map[string]map[string]types.FileInfo{}
+		u.listings.ids = map[string]string{}
+	}
+	dir = path.Clean(dir)
+	u.listings.dirs[dir] = byName
+	for _, file := range files {
+		u.listings.ids[file.Id] = dir
+	}
+}
+
+// addedFile records file, just created in dir, in the cached listing of dir.
+func (u *UploadService) addedFile(dir string, file types.FileInfo) {
+	dir = path.Clean(dir)
+	u.listings.mu.Lock()
+	defer u.listings.mu.Unlock()
+	cached, ok := u.listings.dirs[dir]
+	if !ok {
+		return
+	}
+	cached[u.nameKey(file.Name)] = file
+	u.listings.ids[file.Id] = dir
+}
+
+// deletedFile drops the file with the given ID from the cached listings.
+func (u *UploadService) deletedFile(id string) {
+	u.listings.mu.Lock()
+	defer u.listings.mu.Unlock()
+	dir, ok := u.listings.ids[id]
+	if !ok {
+		return
+	}
+	delete(u.listings.ids, id)
+	for key, file := range u.listings.dirs[dir] {
+		if file.Id == id {
+			delete(u.listings.dirs[dir], key)
+			return
+		}
+	}
+}
+
+// renamedFile renames the file with the given ID in the cached listings.
+func (u *UploadService) renamedFile(id string, name string) {
+	u.listings.mu.Lock()
+	defer u.listings.mu.Unlock()
+	dir, ok := u.listings.ids[id]
+	if !ok {
+		return
+	}
+	cached := u.listings.dirs[dir]
+	for key, file := range cached {
+		if file.Id == id {
+			delete(cached, key)
+			file.Name = name
+			cached[u.nameKey(name)] = file
+			return
+		}
+	}
+}
+
+// createdDir records that dir was created by CreateRemoteDir. If the cached
+// listing of its parent didn't contain it, dir was created by this run and
+// is empty: it's cached with an empty listing, so it isn't listed and its
+// files aren't looked up, and added to the listing of its parent, so the
+// folders created in it are known to be new too.
+func (u *UploadService) createdDir(dir string) {
+	dir = path.Clean(dir)
+	parent := path.Dir(dir)
+	if parent == dir {
+		return
+	}
+	u.listings.mu.Lock()
+	defer u.listings.mu.Unlock()
+	siblings, ok := u.listings.dirs[parent]
+	if !ok {
+		return
+	}
+	key := u.nameKey(path.Base(dir))
+	if _, found := siblings[key]; found {
+		return
+	}
+	siblings[key] = types.FileInfo{Name: path.Base(dir), Type: "folder"}
+	u.listings.dirs[dir] = map[string]types.FileInfo{}
+}
+
+// lookupFile returns the remote file fileName in dir, from the cached
+// listing of dir if there is one, or nil if it doesn't exist.
+func (u *UploadService) lookupFile(ctx context.Context, fileName string, dir string) (*types.FileInfo, error) {
+	u.listings.mu.Lock()
+	cached, ok := u.listings.dirs[path.Clean(dir)]
+	if ok {
+		file, found := cached[u.nameKey(fileName)]
+		u.listings.mu.Unlock()
+		if !found {
+			return nil, nil
+		}
+		return &file, nil
+	}
+	u.listings.mu.Unlock()
+	return u.findFile(ctx, fileName, dir)
+}
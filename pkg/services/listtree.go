@@ -0,0 +1,58 @@
+package services
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"uploader/pkg/types"
+)
+
+// RemoteTree maps the slash separated paths of the files and folders below a
+// remote directory, relative to it, to their metadata. Teldrive allows
+// several files with the same name in a directory, so a path can hold more
+// than one entry, oldest first.
+type RemoteTree map[string][]types.FileInfo
+
+// File returns the entry at rel, the newest one if there are several.
+func (t RemoteTree) File(rel string) (*types.FileInfo, bool) {
+	entries := t[rel]
+	if len(entries) == 0 {
+		return nil, false
+	}
+	return &entries[len(entries)-1], true
+}
+
+// Paths returns the paths of the tree, sorted.
+func (t RemoteTree) Paths() []string {
+	paths := make([]string, 0, len(t))
+	for rel := range t {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ListTree lists dir and every directory below it, up to concurrency at once
+// or the number set by WithListing if zero, and returns all their entries.
+func (u *UploadService) ListTree(dir string, concurrency int) (RemoteTree, error) {
+	root := path.Clean("/" + dir)
+	tree := RemoteTree{}
+	err := u.walkRemote(root, -1, concurrency, func(dir string, files []types.FileInfo) {
+		prefix := strings.TrimPrefix(strings.TrimPrefix(dir, root), "/")
+		for _, file := range files {
+			rel := path.Join(prefix, file.Name)
+			tree[rel] = append(tree[rel], file)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, entries := range tree {
+		if len(entries) > 1 {
+			sort.SliceStable(entries, func(i, j int) bool {
+				return entries[i].ModTime < entries[j].ModTime
+			})
+		}
+	}
+	return tree, nil
+}
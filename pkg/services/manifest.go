@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// manifestTimeout bounds the POST of the manifest to a URL.
+const manifestTimeout = 30 * time.Second
+
+// ManifestEntry is a file uploaded by the run.
+type ManifestEntry struct {
+	ID     string `json:"id"`
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	Size   int64  `json:"size"`
+	// Hash is the content hash, known with WithChecksum, prefixed by its
+	// algorithm unless SHA-256
+	Hash string    `json:"hash,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// RunManifest lists the files uploaded by a run, for the systems ingesting
+// them, e.g. media managers, along with the summary of the run.
+type RunManifest struct {
+	RunID      string          `json:"runId,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	Uploaded   int             `json:"uploaded"`
+	Existing   int             `json:"existing"`
+	Failed     int             `json:"failed"`
+	Files      []ManifestEntry `json:"files"`
+}
+
+// manifest collects the files uploaded by the run.
+type manifest struct {
+	mu    sync.Mutex
+	files []ManifestEntry
+}
+
+// WithRunManifest records every file uploaded, to be returned by RunManifest.
+func WithRunManifest() UploadOption {
+	return func(u *UploadService) {
+		u.manifest = &manifest{}
+	}
+}
+
+// recordManifest adds the file fileName uploaded from source into destDir
+// to the manifest, if enabled.
+func (u *UploadService) recordManifest(id, source, destDir, fileName string, size int64, hash string) {
+	if u.manifest == nil {
+		return
+	}
+	u.manifest.mu.Lock()
+	defer u.manifest.mu.Unlock()
+	u.manifest.files = append(u.manifest.files, ManifestEntry{
+		ID:     id,
+		Path:   path.Join(destDir, fileName),
+		Source: source,
+		Size:   size,
+		Hash:   hash,
+		Time:   time.Now(),
+	})
+}
+
+// RunManifest returns the files uploaded so far with the summary of the run.
+// It needs WithRunManifest.
+func (u *UploadService) RunManifest() RunManifest {
+	status := u.Progress.Status()
+	m := RunManifest{
+		RunID:      status.RunID,
+		StartedAt:  status.StartedAt,
+		FinishedAt: time.Now(),
+		Uploaded:   status.Uploaded,
+		Existing:   status.Existing,
+		Failed:     status.Failed,
+		Files:      []ManifestEntry{},
+	}
+	if u.manifest != nil {
+		u.manifest.mu.Lock()
+		m.Files = append(m.Files, u.manifest.files...)
+		u.manifest.mu.Unlock()
+	}
+	return m
+}
+
+// SendRunManifest writes m as JSON to target, a file, or POSTs it when target
+// is an http(s) URL.
+func SendRunManifest(m RunManifest, target string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if !IsURL(target) {
+		return os.WriteFile(target, append(data, '\n'), 0o644)
+	}
+
+	client := &http.Client{Timeout: manifestTimeout}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post manifest: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// renamedSource is a source uploaded under another name.
+type renamedSource struct {
+	Source
+	name string
+}
+
+func (s *renamedSource) Name() string { return s.name }
+
+// Rename returns src to be uploaded under another name.
+func Rename(src Source, name string) Source {
+	return &renamedSource{Source: src, name: name}
+}
+
+// asLocal returns the local file behind src, even if renamed.
+func asLocal(src Source) (*localSource, bool) {
+	if renamed, ok := src.(*renamedSource); ok {
+		src = renamed.Source
+	}
+	local, ok := src.(*localSource)
+	return local, ok
+}
+
+// pathMapper returns the function mapping the slash separated path of a
+// file, relative to the uploaded folder, to its remote path relative to the
+// destination, or nil if the local layout is kept as it is.
+func (u *UploadService) pathMapper() func(rel string) string {
+	if len(u.rewriteRules) == 0 && u.flatten == "" {
+		return nil
+	}
+	flatten := u.flattener()
+	return func(rel string) string {
+		if len(u.rewriteRules) > 0 {
+			rewritten := strings.TrimPrefix(path.Clean("/"+u.rewriteRules.Apply(rel)), "/")
+			if rewritten != rel {
+				u.logger.Debug("path rewritten", zap.String("from", rel), zap.String("to", rewritten))
+			}
+			rel = rewritten
+		}
+		if flatten != nil {
+			rel = flatten(rel)
+		}
+		return rel
+	}
+}
+
+// uploadMapped uploads every file below sourcePath into destDir at the
+// remote path given by mapPath.
+func (u *UploadService) uploadMapped(sourcePath string, destDir string, mapPath func(rel string) string) error {
+	enqueue := u.mappedEnqueuer(destDir, mapPath)
+	return filepath.WalkDir(sourcePath, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if u.skipDir(sourcePath, fullPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == OverrideFile {
+			return nil
+		}
+		rel, err := filepath.Rel(sourcePath, fullPath)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		u.Progress.AddTransfer(1, info.Size())
+		return enqueue(fullPath, filepath.ToSlash(rel))
+	})
+}
+
+// mappedEnqueuer returns the function enqueueing a local file, at the slash
+// separated path rel relative to the uploaded folder, into destDir at the
+// remote path given by mapPath. The remote folders are created and listed
+// once.
+func (u *UploadService) mappedEnqueuer(destDir string, mapPath func(rel string) string) func(fullPath string, rel string) error {
+	created := map[string]bool{destDir: true}
+	listed := map[string]bool{}
+	return func(fullPath string, rel string) error {
+		remotePath := mapPath(rel)
+
+		dir := path.Join(destDir, path.Dir(remotePath))
+		if !created[dir] {
+			if err := u.CreateRemoteDir(dir); err != nil {
+				u.logger.Error("create remote dir failed", zap.String("subDir", dir), zap.Error(err))
+				return err
+			}
+			created[dir] = true
+		}
+		if !listed[dir] {
+			// the files are checked against the listing, or one by one
+			// if it fails
+			if _, err := u.listDest(dir); err != nil {
+				u.logger.Warn("list remote files failed", zap.String("destDir", dir), zap.Error(err))
+			}
+			listed[dir] = true
+		}
+
+		src, err := newLocalSource(fullPath)
+		if err != nil {
+			return err
+		}
+		name := path.Base(remotePath)
+		if name == src.Name() {
+			u.EnqueueSource(src, dir)
+		} else {
+			u.EnqueueSource(Rename(src, name), dir)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"go.uber.org/zap"
+)
+
+// ErrTooBig is returned for the files bigger than the maximum file size set
+// by WithMaxFileSize.
+var ErrTooBig = errors.New("file bigger than the maximum file size")
+
+// Actions for the files bigger than the maximum file size.
+const (
+	// OversizeFail refuses them before uploading anything.
+	OversizeFail = "fail"
+	// OversizeSplit uploads them as volumes of the maximum file size, like
+	// WithSplitSize.
+	OversizeSplit = "split"
+)
+
+// WithMaxFileSize sets the biggest file the server takes, and what to do
+// with the bigger ones: OversizeFail refuses them when they're queued,
+// instead of failing after uploading most of them, and OversizeSplit
+// uploads them as volumes. A size of 0 or less disables it.
+func WithMaxFileSize(size int64, action string) UploadOption {
+	return func(u *UploadService) {
+		u.maxFileSize = size
+		u.oversizeSplit = action == OversizeSplit
+	}
+}
+
+// ValidOversizeAction reports whether action is a known action for the
+// files bigger than the maximum file size.
+func ValidOversizeAction(action string) bool {
+	return action == OversizeFail || action == OversizeSplit
+}
+
+// volumeSize returns the size of the volumes a file of size bytes is split
+// in, or 0 if it's uploaded whole.
+func (u *UploadService) volumeSize(size int64) int64 {
+	volume := u.splitSize
+	if u.oversizeSplit && u.maxFileSize > 0 && (volume <= 0 || volume > u.maxFileSize) {
+		volume = u.maxFileSize
+	}
+	if volume > 0 && size > volume {
+		return volume
+	}
+	return 0
+}
+
+// checkFileSize returns ErrTooBig for a file of size bytes refused by
+// OversizeFail.
+func (u *UploadService) checkFileSize(fileName string, size int64) error {
+	if u.maxFileSize <= 0 || u.oversizeSplit {
+		return nil
+	}
+	if volume := u.volumeSize(size); volume > 0 {
+		if volume <= u.maxFileSize {
+			return nil
+		}
+		return fmt.Errorf("%w: %s is split in volumes of %s, the server takes at most %s", ErrTooBig, fileName, fs.SizeSuffix(volume), fs.SizeSuffix(u.maxFileSize))
+	}
+	if size <= u.maxFileSize {
+		return nil
+	}
+	return fmt.Errorf("%w: %s has %s, the server takes at most %s", ErrTooBig, fileName, fs.SizeSuffix(size), fs.SizeSuffix(u.maxFileSize))
+}
+
+// refuseTooBig counts a queued file refused by checkFileSize as failed and
+// reports whether it was refused.
+func (u *UploadService) refuseTooBig(fullPath, fileName, destDir string, size int64) bool {
+	err := u.checkFileSize(fileName, size)
+	if err == nil {
+		return false
+	}
+	u.logger.Error("file too big", zap.String("filePath", fullPath), zap.Int64("fileSize", size), zap.Int64("maxFileSize", u.maxFileSize))
+	u.Progress.AddFailed(size)
+	u.recordTransfer(fullPath, destDir, size, time.Now(), false, err)
+	return true
+}
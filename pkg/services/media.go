@@ -0,0 +1,32 @@
+package services
+
+import (
+	"strings"
+	"uploader/pkg/media"
+	"uploader/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// WithVideoMetadata sends the duration, resolution and codec of local
+// videos in the metadata of the created file.
+func WithVideoMetadata() UploadOption {
+	return func(u *UploadService) {
+		u.videoMetadata = true
+	}
+}
+
+// probeVideo returns the metadata of a local video, or nil if it isn't one
+// or can't be read.
+func (u *UploadService) probeVideo(src Source, mimeType string) *types.VideoMetadata {
+	local, ok := asLocal(src)
+	if !ok || !u.videoMetadata || !strings.HasPrefix(mimeType, "video/") {
+		return nil
+	}
+	meta, err := media.Probe(u.ctx, local.path)
+	if err != nil {
+		u.logger.Debug("probe video failed", zap.String("filePath", local.path), zap.Error(err))
+		return nil
+	}
+	return meta
+}
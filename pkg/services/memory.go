@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// WithMaxMemory caps the memory of the buffers holding file data, like the
+// parts of streams and the read-ahead buffers of WithBufferSize: readers
+// wait for buffers to be released once limit bytes are in use. A buffer
+// bigger than limit is still handed out when no other one is in use.
+func WithMaxMemory(limit int64) UploadOption {
+	return func(u *UploadService) {
+		u.memory.limit = limit
+	}
+}
+
+// WithBufferSize reads every part being sent ahead through a buffer of size
+// bytes, so slow disks and remote sources don't stall the connection.
+func WithBufferSize(size int64) UploadOption {
+	return func(u *UploadService) {
+		u.bufferSize = size
+	}
+}
+
+// memoryPool hands out buffers while keeping the memory they use, including
+// the released buffers kept for reuse, below a limit.
+type memoryPool struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	free  [][]byte
+	freed chan struct{}
+}
+
+func newMemoryPool() *memoryPool {
+	return &memoryPool{freed: make(chan struct{})}
+}
+
+// get returns a buffer of size bytes, waiting until the limit allows it.
+func (p *memoryPool) get(ctx context.Context, size int64) ([]byte, error) {
+	for {
+		p.mu.Lock()
+		for i, buf := range p.free {
+			if int64(cap(buf)) == size {
+				p.free = append(p.free[:i], p.free[i+1:]...)
+				p.used += size
+				p.mu.Unlock()
+				return buf[:size], nil
+			}
+		}
+		if p.limit > 0 && p.used+p.freeBytes()+size > p.limit {
+			// buffers of other sizes are dropped before waiting for memory
+			p.free = nil
+		}
+		if p.limit <= 0 || p.used == 0 || p.used+size <= p.limit {
+			p.used += size
+			p.mu.Unlock()
+			return make([]byte, size), nil
+		}
+		freed := p.freed
+		p.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// put releases a buffer returned by get.
+func (p *memoryPool) put(buf []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.used -= int64(cap(buf))
+	p.free = append(p.free, buf[:cap(buf)])
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// grow returns buf extended to size bytes, keeping its content. The memory
+// of buf is released before waiting for the bigger buffer, so a reader
+// growing its only buffer never waits for itself.
+func (p *memoryPool) grow(ctx context.Context, buf []byte, size int64) ([]byte, error) {
+	p.mu.Lock()
+	p.used -= int64(cap(buf))
+	close(p.freed)
+	p.freed = make(chan struct{})
+	p.mu.Unlock()
+
+	grown, err := p.get(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	copy(grown, buf)
+	return grown, nil
+}
+
+func (p *memoryPool) freeBytes() int64 {
+	var n int64
+	for _, buf := range p.free {
+		n += int64(cap(buf))
+	}
+	return n
+}
+
+// readAhead returns a reader of rc filled in the background through buffers
+// of the pool, or rc itself if read-ahead is disabled.
+func (u *UploadService) readAhead(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if u.bufferSize <= 0 {
+		return rc
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &readAheadReader{rc: rc, pool: u.memory, filled: make(chan []byte, 1), cancel: cancel, done: make(chan struct{})}
+	go r.fill(ctx, u.bufferSize)
+	return r
+}
+
+type readAheadReader struct {
+	rc     io.ReadCloser
+	pool   *memoryPool
+	filled chan []byte
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	buf  []byte
+	data []byte
+}
+
+func (r *readAheadReader) fill(ctx context.Context, size int64) {
+	defer close(r.done)
+	defer close(r.filled)
+	for {
+		buf, err := r.pool.get(ctx, size)
+		if err != nil {
+			r.err = err
+			return
+		}
+		n, err := io.ReadFull(r.rc, buf)
+		if n > 0 {
+			select {
+			case r.filled <- buf[:n]:
+			case <-ctx.Done():
+				r.pool.put(buf)
+				r.err = ctx.Err()
+				return
+			}
+		} else {
+			r.pool.put(buf)
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return
+		}
+	}
+}
+
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		if r.buf != nil {
+			r.pool.put(r.buf)
+			r.buf = nil
+		}
+		buf, ok := <-r.filled
+		if !ok {
+			return 0, r.err
+		}
+		r.buf, r.data = buf, buf
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *readAheadReader) Close() error {
+	r.cancel()
+	err := r.rc.Close()
+	for buf := range r.filled {
+		r.pool.put(buf)
+	}
+	<-r.done
+	if r.buf != nil {
+		r.pool.put(r.buf)
+		r.buf = nil
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OverrideFile is the name of the files overriding the upload settings of
+// the folder holding them and of its subfolders, like:
+//
+//	dest: /archive/photos
+//	channel: 123
+//	encrypt: true
+//	exclude: ["*.tmp", "cache"]
+//
+// A relative dest is below the remote folder the folder would be uploaded
+// to. The exclusions match the names of files and folders and add to the
+// ones of the parent folders.
+const OverrideFile = ".teldrive.yaml"
+
+// dirOverride is the content of an OverrideFile.
+type dirOverride struct {
+	Dest    string   `yaml:"dest"`
+	Channel int64    `yaml:"channel"`
+	Encrypt *bool    `yaml:"encrypt"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// dirSettings are the upload settings of a local folder given by the
+// override files of the folder and of its parents.
+type dirSettings struct {
+	channelID int64
+	encrypt   *bool
+	exclude   []string
+}
+
+// applyOverride returns the settings of the local folder sourcePath, those
+// of parent changed by its override file if any, and the remote folder it
+// goes to instead of destDir.
+func applyOverride(sourcePath string, destDir string, parent *dirSettings) (*dirSettings, string, error) {
+	data, err := os.ReadFile(filepath.Join(sourcePath, OverrideFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return parent, destDir, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var override dirOverride
+	if err := yaml.Unmarshal(data, &override); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", filepath.Join(sourcePath, OverrideFile), err)
+	}
+	for _, pattern := range override.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, "", fmt.Errorf("%s: exclude %q: %w", filepath.Join(sourcePath, OverrideFile), pattern, err)
+		}
+	}
+
+	settings := &dirSettings{}
+	if parent != nil {
+		*settings = *parent
+		settings.exclude = append([]string(nil), parent.exclude...)
+	}
+	if override.Channel != 0 {
+		settings.channelID = override.Channel
+	}
+	if override.Encrypt != nil {
+		settings.encrypt = override.Encrypt
+	}
+	settings.exclude = append(settings.exclude, override.Exclude...)
+	if override.Dest != "" {
+		if strings.HasPrefix(override.Dest, "/") {
+			destDir = path.Clean(override.Dest)
+		} else {
+			destDir = path.Join(destDir, override.Dest)
+		}
+	}
+	return settings, destDir, nil
+}
+
+// excluded reports whether the file or folder name is left out of the
+// upload, override files always are.
+func (s *dirSettings) excluded(name string) bool {
+	if name == OverrideFile {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	for _, pattern := range s.exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setDirSettings makes the files uploaded into destDir use settings.
+func (u *UploadService) setDirSettings(destDir string, settings *dirSettings) {
+	if settings == nil || (settings.channelID == 0 && settings.encrypt == nil) {
+		return
+	}
+	u.dirSettingsMu.Lock()
+	defer u.dirSettingsMu.Unlock()
+	if u.dirSettings == nil {
+		u.dirSettings = map[string]*dirSettings{}
+	}
+	u.dirSettings[path.Clean("/"+destDir)] = settings
+}
+
+func (u *UploadService) settingsFor(destDir string) *dirSettings {
+	u.dirSettingsMu.Lock()
+	defer u.dirSettingsMu.Unlock()
+	return u.dirSettings[path.Clean("/"+strings.ReplaceAll(destDir, "\\", "/"))]
+}
+
+// encryptFor reports whether the files uploaded into destDir are encrypted.
+func (u *UploadService) encryptFor(destDir string) bool {
+	if settings := u.settingsFor(destDir); settings != nil && settings.encrypt != nil {
+		return *settings.encrypt
+	}
+	return u.encryptFiles
+}
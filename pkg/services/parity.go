@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Par2Command is the par2cmdline executable used to create parity files.
+const Par2Command = "par2"
+
+// WithParity creates PAR2 recovery files with the given redundancy, in
+// percent, for every uploaded local file and stores them next to it, so
+// damaged or lost parts can be repaired after downloading with
+// `par2 repair file.par2`.
+func WithParity(redundancy int) UploadOption {
+	return func(u *UploadService) {
+		u.parity = redundancy
+	}
+}
+
+func isParityFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".par2")
+}
+
+// uploadParity creates the recovery files of a local source in a temporary
+// directory and uploads them into destDir. Renamed files are skipped, as
+// the recovery files refer to the files by name.
+func (u *UploadService) uploadParity(src Source, destDir string) error {
+	local, ok := src.(*localSource)
+	if !ok || u.parity <= 0 || isParityFile(local.Name()) {
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "uploader-par2-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filePath, err := filepath.Abs(local.path)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(u.ctx, Par2Command, "create", "-q", "-q",
+		fmt.Sprintf("-r%d", u.parity), "-n1",
+		"-B"+filepath.Dir(filePath),
+		filepath.Join(tmpDir, local.Name()+".par2"), filePath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("par2 create: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		parity, err := newLocalSource(filepath.Join(tmpDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		u.Progress.AddTransfer(1, parity.Size())
+		if err := u.UploadSource(parity, destDir); err != nil {
+			return err
+		}
+	}
+	u.logger.Info("parity files sent", zap.String("fileName", local.Name()), zap.Int("files", len(entries)))
+	return nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"encoding/hex"
+	"strings"
+	"text/template"
+
+	"github.com/gofrs/uuid"
+)
+
+// DefaultPartNameTemplate names the parts of files that aren't randomised.
+const DefaultPartNameTemplate = `{{.Name}}.part.{{printf "%03d" .PartNo}}`
+
+// PartName is the data available to part name templates.
+type PartName struct {
+	// Name is the name of the file
+	Name string
+	// PartNo is the number of the part, starting at 1
+	PartNo int64
+	// Total is the number of parts of the file, 0 if unknown when uploading
+	// a stream
+	Total int64
+}
+
+// ParsePartNameTemplate parses a text/template for the names of the parts,
+// e.g. {{.Name}}.{{.PartNo}}of{{.Total}}.
+func ParsePartNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("partName").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(&strings.Builder{}, PartName{Name: "file", PartNo: 1, Total: 2}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// WithPartNameTemplate names the parts of files that aren't randomised with
+// tmpl instead of DefaultPartNameTemplate.
+func WithPartNameTemplate(tmpl *template.Template) UploadOption {
+	return func(u *UploadService) {
+		u.partNameTemplate = tmpl
+	}
+}
+
+var defaultPartNameTemplate = template.Must(ParsePartNameTemplate(DefaultPartNameTemplate))
+
+// partName returns the name of a part: random when randomising parts, the
+// file name for files of a single part, or the part name template.
+func (u *UploadService) partName(fileName string, partNo, total int64) string {
+	if u.randomisePart {
+		id, _ := uuid.NewV4()
+		return hex.EncodeToString(id.Bytes())
+	}
+	if total == 1 {
+		return fileName
+	}
+
+	tmpl := u.partNameTemplate
+	if tmpl == nil {
+		tmpl = defaultPartNameTemplate
+	}
+	var name strings.Builder
+	if err := tmpl.Execute(&name, PartName{Name: fileName, PartNo: partNo, Total: total}); err != nil || name.Len() == 0 {
+		return fileName
+	}
+	return name.String()
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"go.uber.org/zap"
+)
+
+// partMetrics are the counters of the part uploads, served with the pprof
+// data at /debug/vars: parts, attempts, retries, failed, slow, bytes and
+// seconds spent sending.
+var partMetrics = expvar.NewMap("parts")
+
+// botMetrics are the counters of the part attempts of every bot, or of
+// "default" for the parts uploaded without one: attempts, failed, slow,
+// bytes and seconds, to spot the bot or proxy slowing the uploads.
+var botMetrics = expvar.NewMap("part_bots")
+
+// botMetricsMu serializes adding the counters of a bot.
+var botMetricsMu sync.Mutex
+
+// WithSlowPart logs a warning for every part sent slower than speed bytes
+// per second. Parts smaller than speed aren't judged, as their time is mostly
+// latency. A speed of 0 or less disables the warnings.
+func WithSlowPart(speed int64) UploadOption {
+	return func(u *UploadService) {
+		u.slowPart = speed
+	}
+}
+
+// recordAttempt records an attempt to send a part of size bytes with bot,
+// which took elapsed.
+func (u *UploadService) recordAttempt(fileName string, partNo int64, bot string, size int64, elapsed time.Duration, err error) {
+	if bot == "" {
+		bot = "default"
+	}
+	botMetricsMu.Lock()
+	stats, ok := botMetrics.Get(bot).(*expvar.Map)
+	if !ok {
+		stats = new(expvar.Map)
+		botMetrics.Set(bot, stats)
+	}
+	botMetricsMu.Unlock()
+	stats.Add("attempts", 1)
+	stats.AddFloat("seconds", elapsed.Seconds())
+	if err != nil {
+		stats.Add("failed", 1)
+		return
+	}
+	stats.Add("bytes", size)
+
+	if u.slowPart <= 0 || size < u.slowPart {
+		return
+	}
+	speed := float64(size) / elapsed.Seconds()
+	if speed < float64(u.slowPart) {
+		stats.Add("slow", 1)
+		partMetrics.Add("slow", 1)
+		u.logger.Warn("slow part", zap.String("fileName", fileName), zap.Int64("partNumber", partNo), zap.String("bot", bot),
+			zap.Duration("duration", elapsed), zap.String("speed", fs.SizeSuffix(speed).String()+"/s"))
+	}
+}
+
+// recordPart records a part of size bytes sent in attempts, which took
+// elapsed in all.
+func (u *UploadService) recordPart(fileName string, partNo int64, size int64, attempts int, elapsed time.Duration, err error) {
+	partMetrics.Add("parts", 1)
+	partMetrics.Add("attempts", int64(attempts))
+	partMetrics.Add("retries", int64(attempts-1))
+	partMetrics.AddFloat("seconds", elapsed.Seconds())
+	if err != nil {
+		partMetrics.Add("failed", 1)
+		return
+	}
+	partMetrics.Add("bytes", size)
+	u.logger.Debug("part sent", zap.String("fileName", fileName), zap.Int64("partNumber", partNo), zap.Int("attempts", attempts),
+		zap.Duration("duration", elapsed), zap.String("speed", fs.SizeSuffix(float64(size)/elapsed.Seconds()).String()+"/s"))
+}
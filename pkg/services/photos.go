@@ -0,0 +1,50 @@
+package services
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"uploader/pkg/exif"
+
+	"go.uber.org/zap"
+)
+
+// UploadPhotos uploads every file below sourcePath into destDir/YYYY/MM,
+// sorted by the EXIF capture date of photos or the modification time of
+// other files and photos without one, e.g. to back up camera dumps. The
+// files are added to the totals of the progress as they're found.
+func (u *UploadService) UploadPhotos(sourcePath string, destDir string) error {
+	defer u.Progress.StartScan()()
+	return filepath.WalkDir(sourcePath, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if u.skipDir(sourcePath, fullPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == OverrideFile {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		taken, err := exif.DateTaken(fullPath)
+		if err != nil {
+			taken = info.ModTime()
+		}
+
+		dir := path.Join(destDir, taken.Format("2006"), taken.Format("01"))
+		if err := u.CreateRemoteDir(dir); err != nil {
+			u.logger.Error("create remote dir failed", zap.String("subDir", dir), zap.Error(err))
+			return err
+		}
+		u.Progress.AddTransfer(1, info.Size())
+		u.EnqueueFile(fullPath, dir)
+		return nil
+	})
+}
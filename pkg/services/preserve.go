@@ -0,0 +1,67 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"uploader/pkg/filemeta"
+
+	"go.uber.org/zap"
+)
+
+// MetadataDir is the folder, next to the uploaded files, holding their
+// metadata sidecars.
+const MetadataDir = ".meta"
+
+// WithPreserveMetadata uploads the permissions, owner, modification time
+// and extended attributes of every local file as a JSON sidecar, named like
+// the file with a .json extension, into the .meta folder next to it.
+func WithPreserveMetadata() UploadOption {
+	return func(u *UploadService) {
+		u.preserveMetadata = true
+	}
+}
+
+func (u *UploadService) uploadMetadata(src Source, destDir string) error {
+	local, ok := asLocal(src)
+	if !ok || !u.preserveMetadata {
+		return nil
+	}
+
+	meta, err := filemeta.Capture(local.path)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	metaDir := path.Join(destDir, MetadataDir)
+	if err := u.CreateRemoteDir(metaDir); err != nil {
+		return err
+	}
+	u.Progress.AddTransfer(1, int64(len(data)))
+	if err := u.UploadSource(&bytesSource{name: src.Name() + ".json", data: data}, metaDir); err != nil {
+		return err
+	}
+	u.logger.Debug("metadata sent", zap.String("fileName", src.Name()))
+	return nil
+}
+
+// RestoreMetadata applies the metadata sidecar uploaded with the remote file
+// at filePath to the local file at localPath.
+func (u *UploadService) RestoreMetadata(filePath string, localPath string) error {
+	filePath = path.Clean("/" + filePath)
+	sidecar := path.Join(path.Dir(filePath), MetadataDir, path.Base(filePath)+".json")
+	var buf bytes.Buffer
+	if err := u.Cat(sidecar, &buf, 0, -1); err != nil {
+		return fmt.Errorf("read metadata of %s: %w", filePath, err)
+	}
+	var meta filemeta.Metadata
+	if err := json.Unmarshal(buf.Bytes(), &meta); err != nil {
+		return fmt.Errorf("read metadata of %s: %w", filePath, err)
+	}
+	return filemeta.Apply(localPath, &meta)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"uploader/pkg/state"
+
+	"go.uber.org/zap"
+)
+
+// ErrQuotaExceeded is returned for files that were not started because the
+// transfer limit of the run or the daily budget has been reached.
+var ErrQuotaExceeded = errors.New("transfer quota exceeded")
+
+// ErrBiggerThanQuota is returned for files bigger than the transfer limit
+// of a run or the daily budget, which no run could upload.
+var ErrBiggerThanQuota = errors.New("file bigger than the transfer quota")
+
+type quota struct {
+	mu         sync.Mutex
+	maxRun     int64 // bytes allowed in this run, 0 for unlimited
+	maxDaily   int64 // bytes allowed per day, 0 for unlimited
+	dailyUsed  int64 // bytes uploaded today before this run
+	reserved   int64 // bytes of files started in this run
+	exceeded   bool
+	remaining  []state.QueuedFile
+	failed     []state.QueuedFile
+	dailyTrack bool
+}
+
+// WithQuota stops starting new files once maxRun bytes have been uploaded in
+// this run or maxDaily bytes today; 0 disables a limit.
+func WithQuota(maxRun int64, maxDaily int64) UploadOption {
+	return func(u *UploadService) {
+		u.quota.maxRun = maxRun
+		u.quota.maxDaily = maxDaily
+		u.quota.dailyTrack = maxDaily > 0
+		if maxDaily > 0 {
+			used, err := state.DailyUsage()
+			if err != nil {
+				u.logger.Warn("read daily usage failed", zap.Error(err))
+			}
+			u.quota.dailyUsed = used
+		}
+	}
+}
+
+// reserve accounts size bytes for a file about to be uploaded. It fails with
+// ErrQuotaExceeded, and queues the file, when a limit would be crossed, or
+// with ErrBiggerThanQuota when the file alone crosses it.
+func (q *quota) reserve(filePath, destDir string, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxRun > 0 && size > q.maxRun {
+		return fmt.Errorf("%w: %d bytes, MAX_TRANSFER is %d", ErrBiggerThanQuota, size, q.maxRun)
+	}
+	if q.maxDaily > 0 && size > q.maxDaily {
+		return fmt.Errorf("%w: %d bytes, DAILY_BUDGET is %d", ErrBiggerThanQuota, size, q.maxDaily)
+	}
+
+	if !q.exceeded {
+		overRun := q.maxRun > 0 && q.reserved+size > q.maxRun
+		overDaily := q.maxDaily > 0 && q.dailyUsed+q.reserved+size > q.maxDaily
+		q.exceeded = overRun || overDaily
+	}
+	if q.exceeded {
+		q.remaining = append(q.remaining, state.QueuedFile{Path: filePath, Dest: destDir, Error: ErrQuotaExceeded.Error()})
+		return ErrQuotaExceeded
+	}
+	q.reserved += size
+	return nil
+}
+
+// queueIfExceeded queues the file and fails with ErrQuotaExceeded when a
+// limit was already reached, so the files left aren't looked up or read
+// first. The files bigger than a limit are left to reserve.
+func (q *quota) queueIfExceeded(filePath, destDir string, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.exceeded || (q.maxRun > 0 && size > q.maxRun) || (q.maxDaily > 0 && size > q.maxDaily) {
+		return nil
+	}
+	q.remaining = append(q.remaining, state.QueuedFile{Path: filePath, Dest: destDir, Error: ErrQuotaExceeded.Error()})
+	return ErrQuotaExceeded
+}
+
+// release gives back the reservation of a file that failed to upload.
+func (q *quota) release(size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reserved -= size
+}
+
+// QuotaExceeded reports whether files were left out because of the quota.
+func (u *UploadService) QuotaExceeded() bool {
+	u.quota.mu.Lock()
+	defer u.quota.mu.Unlock()
+	return u.quota.exceeded
+}
+
+// RemainingFiles returns the files that were not started because of the quota.
+func (u *UploadService) RemainingFiles() []state.QueuedFile {
+	u.quota.mu.Lock()
+	defer u.quota.mu.Unlock()
+	return append([]state.QueuedFile(nil), u.quota.remaining...)
+}
+
+// fail keeps a file whose upload failed for a reason other than the quota,
+// to be queued again by a resumed run.
+func (q *quota) fail(filePath, destDir string, err error) {
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrBiggerThanQuota) {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.failed = append(q.failed, state.QueuedFile{Path: filePath, Dest: destDir, Error: err.Error()})
+}
+
+// FailedFiles returns the files that failed to upload for a reason other
+// than the quota, with their error.
+func (u *UploadService) FailedFiles() []state.QueuedFile {
+	u.quota.mu.Lock()
+	defer u.quota.mu.Unlock()
+	return append([]state.QueuedFile(nil), u.quota.failed...)
+}
+
+// addUsage adds the bytes of a finished upload to the daily usage.
+func (u *UploadService) addUsage(size int64) {
+	if !u.quota.dailyTrack {
+		return
+	}
+	if err := state.AddDailyUsage(size); err != nil {
+		u.logger.Warn("update daily usage failed", zap.Error(err))
+	}
+}
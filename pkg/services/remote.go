@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// remoteSource streams a file stored on another Teldrive server through its
+// download API, so files can be copied between servers without touching the
+// local disk.
+type remoteSource struct {
+	from   *UploadService
+	remote string
+	dir    string
+	file   types.FileInfo
+}
+
+func (s *remoteSource) Name() string { return s.file.Name }
+func (s *remoteSource) Size() int64  { return s.file.Size }
+func (s *remoteSource) String() string {
+	return s.remote + ":" + path.Join(s.dir, s.file.Name)
+}
+func (s *remoteSource) MimeType() string { return s.file.MimeType }
+
+func (s *remoteSource) ModTime() time.Time {
+	modTime, _ := time.Parse(time.RFC3339, s.file.ModTime)
+	return modTime
+}
+
+func (s *remoteSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/api/files/" + s.file.Id + "/" + url.PathEscape(s.file.Name),
+	}
+	if offset != 0 || length != s.file.Size {
+		opts.Options = []fs.OpenOption{&fs.RangeOption{Start: offset, End: offset + length - 1}}
+	}
+
+	var resp *http.Response
+	var err error
+	err = s.from.pacer.Call(func() (bool, error) {
+		resp, err = s.from.http.Call(ctx, &opts)
+		return shouldRetry(ctx, resp, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// CopyFrom copies a file or a whole directory from another Teldrive server
+// into destDir, streaming every part from the download API of from into the
+// upload API of u. remote is the name of the source server used in logs and
+// the history. The files are added to the totals of the progress as the
+// source is listed.
+func (u *UploadService) CopyFrom(from *UploadService, remote, srcPath, destDir string) error {
+	defer u.Progress.StartScan()()
+	srcPath = path.Clean("/" + srcPath)
+	if srcPath == "/" {
+		return u.copyDir(from, remote, srcPath, destDir)
+	}
+
+	dir, name := path.Split(srcPath)
+	files, err := from.list(path.Clean(dir))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Name != name {
+			continue
+		}
+		if file.Type == "folder" {
+			return u.copyDir(from, remote, srcPath, destDir)
+		}
+		u.Progress.AddTransfer(1, file.Size)
+		u.EnqueueSource(&remoteSource{from: from, remote: remote, dir: path.Clean(dir), file: file}, destDir)
+		return nil
+	}
+	return fmt.Errorf("%s:%s: %w", remote, srcPath, fs.ErrorObjectNotFound)
+}
+
+func (u *UploadService) copyDir(from *UploadService, remote, srcDir, destDir string) error {
+	files, err := from.list(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Type == "folder" {
+			subDir := path.Join(destDir, file.Name)
+			if err := u.CreateRemoteDir(subDir); err != nil {
+				return err
+			}
+			if err := u.copyDir(from, remote, path.Join(srcDir, file.Name), subDir); err != nil {
+				return err
+			}
+			continue
+		}
+		u.Progress.AddTransfer(1, file.Size)
+		u.EnqueueSource(&remoteSource{from: from, remote: remote, dir: srcDir, file: file}, destDir)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package services
+
+import "uploader/pkg/rewrite"
+
+// WithRewriteRules rewrites the path of every file, relative to the
+// uploaded folder, before computing its remote destination, e.g. to turn
+// "Season 1/" into "S1/" without renaming anything locally.
+func WithRewriteRules(rules rewrite.Rules) UploadOption {
+	return func(u *UploadService) {
+		u.rewriteRules = rules
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const defaultS3Endpoint = "https://s3.amazonaws.com"
+
+// s3Store holds the settings of the S3 compatible storage used by s3://
+// sources, the client is only created once it is needed.
+type s3Store struct {
+	endpoint string
+	region   string
+
+	once   sync.Once
+	client *minio.Client
+	err    error
+}
+
+// WithS3 sets the endpoint, e.g. http://localhost:9000 for MinIO, and region
+// of the storage s3:// sources are read from. Credentials are taken from the
+// standard AWS environment variables, the shared credentials file or the
+// instance role.
+func WithS3(endpoint, region string) UploadOption {
+	return func(u *UploadService) {
+		u.s3 = &s3Store{endpoint: endpoint, region: region}
+	}
+}
+
+func (s *s3Store) getClient() (*minio.Client, error) {
+	s.once.Do(func() {
+		endpoint := s.endpoint
+		if endpoint == "" {
+			endpoint = defaultS3Endpoint
+		}
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			s.err = fmt.Errorf("invalid s3 endpoint %q: %w", s.endpoint, err)
+			return
+		}
+		creds := credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		})
+		s.client, s.err = minio.New(u.Host, &minio.Options{
+			Creds:  creds,
+			Secure: u.Scheme == "https",
+			Region: s.region,
+		})
+	})
+	return s.client, s.err
+}
+
+// IsS3 reports whether the source path is an s3://bucket/key URL.
+func IsS3(sourcePath string) bool {
+	return strings.HasPrefix(strings.ToLower(sourcePath), "s3://")
+}
+
+func parseS3Path(sourcePath string) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(sourcePath[len("s3://"):], "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid s3 path %q, must be s3://bucket/key", sourcePath)
+	}
+	return bucket, key, nil
+}
+
+func (u *UploadService) s3Client() (*minio.Client, error) {
+	return u.s3.getClient()
+}
+
+// s3Source streams an object of an S3 compatible storage, every part is
+// fetched with its own range request.
+type s3Source struct {
+	client *minio.Client
+	bucket string
+	info   minio.ObjectInfo
+}
+
+func (u *UploadService) newS3Source(sourcePath string) (*s3Source, error) {
+	bucket, key, err := parseS3Path(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("%s is a directory", sourcePath)
+	}
+	client, err := u.s3Client()
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.StatObject(u.ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Source{client: client, bucket: bucket, info: info}, nil
+}
+
+func (s *s3Source) Name() string       { return path.Base(s.info.Key) }
+func (s *s3Source) Size() int64        { return s.info.Size }
+func (s *s3Source) ModTime() time.Time { return s.info.LastModified }
+func (s *s3Source) String() string     { return "s3://" + s.bucket + "/" + s.info.Key }
+
+// MimeType returns the content type stored with the object, generic types
+// are ignored so the content gets sniffed instead.
+func (s *s3Source) MimeType() string {
+	switch s.info.ContentType {
+	case "application/octet-stream", "binary/octet-stream":
+		return ""
+	}
+	return s.info.ContentType
+}
+
+func (s *s3Source) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	var opts minio.GetObjectOptions
+	if offset != 0 || length != s.info.Size {
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	}
+	return s.client.GetObject(ctx, s.bucket, s.info.Key, opts)
+}
+
+// UploadS3 uploads a single object, or every object below a prefix keeping
+// the folder structure, from an s3://bucket/prefix path. The objects are
+// added to the totals of the progress as they're listed.
+func (u *UploadService) UploadS3(sourcePath string, destDir string) error {
+	defer u.Progress.StartScan()()
+	bucket, prefix, err := parseS3Path(sourcePath)
+	if err != nil {
+		return err
+	}
+	client, err := u.s3Client()
+	if err != nil {
+		return err
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		info, err := client.StatObject(u.ctx, bucket, prefix, minio.StatObjectOptions{})
+		if err == nil {
+			u.Progress.AddTransfer(1, info.Size)
+			u.EnqueueSource(&s3Source{client: client, bucket: bucket, info: info}, destDir)
+			return nil
+		}
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return err
+		}
+		prefix += "/"
+	}
+
+	ctx, cancel := context.WithCancel(u.ctx)
+	defer cancel()
+
+	found := false
+	for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		// skip the empty objects some tools create as folder markers
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		found = true
+
+		dir := path.Join(destDir, path.Dir(strings.TrimPrefix(object.Key, prefix)))
+		if err := u.CreateRemoteDir(dir); err != nil {
+			return err
+		}
+
+		u.Progress.AddTransfer(1, object.Size)
+		u.EnqueueSource(&s3Source{client: client, bucket: bucket, info: object}, dir)
+	}
+	if !found {
+		return errors.New("no objects found at " + sourcePath)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// Fair share policies of WithFairShare.
+const (
+	// FairShareEqual gives a free worker to the file with the fewest parts
+	// being sent
+	FairShareEqual = "equal"
+	// FairShareSmallFirst gives a free worker to the smallest waiting file
+	FairShareSmallFirst = "small-first"
+)
+
+// ValidFairShare reports whether policy is a known fair share policy.
+func ValidFairShare(policy string) bool {
+	return policy == FairShareEqual || policy == FairShareSmallFirst
+}
+
+// WithFairShare shares workers × transfers part workers between all the
+// files being uploaded instead of giving every file its own workers, so a
+// file can use the workers other files don't need, and hands out the free
+// workers according to policy. Without it, a single huge file never uses
+// more than WORKERS connections, and many small files can't use its idle
+// ones.
+func WithFairShare(policy string) UploadOption {
+	return func(u *UploadService) {
+		u.scheduler = newPartScheduler(u.numWorkers*cap(u.concurrentFiles), policy)
+	}
+}
+
+// fileShare is a file whose parts wait for workers of the scheduler.
+type fileShare struct {
+	size   int64
+	active int
+}
+
+type partWaiter struct {
+	file  *fileShare
+	ready chan struct{}
+}
+
+// partScheduler hands out a fixed number of part workers between files.
+type partScheduler struct {
+	mu      sync.Mutex
+	policy  string
+	free    int
+	waiters []*partWaiter
+}
+
+func newPartScheduler(workers int, policy string) *partScheduler {
+	return &partScheduler{policy: policy, free: workers}
+}
+
+// acquire waits for a worker for a part of file.
+func (s *partScheduler) acquire(ctx context.Context, file *fileShare) error {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiters) == 0 {
+		s.free--
+		file.active++
+		s.mu.Unlock()
+		return nil
+	}
+	w := &partWaiter{file: file, ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, waiting := range s.waiters {
+			if waiting == w {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// granted meanwhile
+		s.releaseLocked(file)
+		return ctx.Err()
+	}
+}
+
+// release returns the worker of a part of file.
+func (s *partScheduler) release(file *fileShare) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked(file)
+}
+
+func (s *partScheduler) releaseLocked(file *fileShare) {
+	file.active--
+	if len(s.waiters) == 0 {
+		s.free++
+		return
+	}
+	next := 0
+	for i, w := range s.waiters {
+		if s.before(w, s.waiters[next]) {
+			next = i
+		}
+	}
+	w := s.waiters[next]
+	s.waiters = append(s.waiters[:next], s.waiters[next+1:]...)
+	w.file.active++
+	close(w.ready)
+}
+
+// before reports whether a waiter goes before b, which waits for longer.
+func (s *partScheduler) before(a, b *partWaiter) bool {
+	if s.policy == FairShareSmallFirst {
+		return a.file.size < b.file.size
+	}
+	return a.file.active < b.file.active
+}
+
+// partWorkers returns how the parts of a file of size bytes wait for a
+// worker: from the shared scheduler, or from workers of the file itself,
+// like the files of the small file lane.
+func (u *UploadService) partWorkers(size int64) (acquire func(ctx context.Context) error, release func()) {
+	if u.scheduler != nil && !u.inSmallFileLane(size) {
+		file := &fileShare{size: size}
+		return func(ctx context.Context) error {
+				return u.scheduler.acquire(ctx, file)
+			}, func() {
+				u.scheduler.release(file)
+			}
+	}
+	workers := make(chan struct{}, u.numWorkers)
+	return func(ctx context.Context) error {
+			select {
+			case workers <- struct{}{}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, func() {
+			<-workers
+		}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// SearchOptions selects the files returned by Search.
+type SearchOptions struct {
+	// Name matches the exact name, or ignoring case with -ignore-case.
+	Name string
+	// Pattern matches part of the name.
+	Pattern *regexp.Regexp
+	// Recursive searches the directories below too.
+	Recursive bool
+	// Concurrency is the number of directories listed at once, zero for
+	// the number set by WithListing.
+	Concurrency int
+}
+
+// Match is a file found by Search.
+type Match struct {
+	Path string `json:"path"`
+	types.FileInfo
+}
+
+// Search returns the files and folders of dir matching opts. A search by
+// name only in a single directory uses the find operation of the API, any
+// other is filtered from the listings.
+func (u *UploadService) Search(dir string, opts SearchOptions) ([]Match, error) {
+	dir = path.Clean("/" + dir)
+	if opts.Name != "" && opts.Pattern == nil && !opts.Recursive && !u.ignoreCase {
+		files, err := u.find(u.ctx, dir, opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		return matches(dir, files), nil
+	}
+
+	var found []Match
+	collect := func(dir string, files []types.FileInfo) {
+		for _, file := range files {
+			if opts.Name != "" && !u.sameName(file.Name, opts.Name) {
+				continue
+			}
+			if opts.Pattern != nil && !opts.Pattern.MatchString(file.Name) {
+				continue
+			}
+			found = append(found, Match{Path: path.Join(dir, file.Name), FileInfo: file})
+		}
+	}
+	if !opts.Recursive {
+		files, err := u.list(dir)
+		if err != nil {
+			return nil, err
+		}
+		collect(dir, files)
+		return found, nil
+	}
+	if err := u.walkRemote(dir, -1, opts.Concurrency, collect); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// find returns every file of dir named name, following the pages of the
+// find operation.
+func (u *UploadService) find(ctx context.Context, dir, name string) ([]types.FileInfo, error) {
+	var files []types.FileInfo
+	nextPageToken := ""
+	for {
+		opts := rest.Opts{
+			Method: "GET",
+			Path:   "/api/files",
+			Parameters: url.Values{
+				"path":          []string{dir},
+				"op":            []string{"find"},
+				"name":          []string{name},
+				"perPage":       []string{strconv.Itoa(u.listPageSize)},
+				"nextPageToken": []string{nextPageToken},
+			},
+		}
+		var info types.ReadMetadataResponse
+		var resp *http.Response
+		err := u.pacer.Call(func() (bool, error) {
+			var err error
+			resp, err = u.http.CallJSON(ctx, &opts, nil, &info)
+			return shouldRetry(ctx, resp, err)
+		})
+		if err != nil && resp != nil && resp.StatusCode == 404 {
+			return nil, fs.ErrorDirNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info.Files...)
+		if info.NextPageToken == "" {
+			return files, nil
+		}
+		nextPageToken = info.NextPageToken
+	}
+}
+
+func matches(dir string, files []types.FileInfo) []Match {
+	found := make([]Match, 0, len(files))
+	for _, file := range files {
+		found = append(found, Match{Path: path.Join(dir, file.Name), FileInfo: file})
+	}
+	return found
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"uploader/pkg/types"
+)
+
+// fingerprintSample is the number of bytes read at the start, the middle
+// and the end of a file for its upload session key.
+const fingerprintSample = 64 << 10
+
+// sessionHash returns the key of the upload session of src, which must
+// change whenever the content does: besides the name, destination and
+// size, it covers the modification time and samples of the content, so
+// the parts of a replaced file of the same size are never reused.
+func (u *UploadService) sessionHash(ctx context.Context, src Source, fileName string, destDir string) (string, error) {
+	size := src.Size()
+	h := md5.New()
+	fmt.Fprintf(h, "%s:%s:%d", fileName, destDir, size)
+	if modTime := src.ModTime(); !modTime.IsZero() {
+		fmt.Fprintf(h, ":%d", modTime.Unix())
+	}
+
+	sample := int64(fingerprintSample)
+	if size <= 3*sample {
+		sample = size
+	}
+	for _, offset := range []int64{0, size/2 - sample/2, size - sample} {
+		if sample == 0 {
+			break
+		}
+		rc, err := src.Open(ctx, offset, sample)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, io.LimitReader(rc, sample))
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		if sample == size {
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// invalidPart returns the first part of a previous upload session that
+// doesn't fit the current part boundaries, e.g. because the part size
+// changed between runs, in which case the session can't be reused.
+func (u *UploadService) invalidPart(parts []types.PartFile, fileSize int64) (types.PartFile, bool) {
+	totalParts := (fileSize + u.partSize - 1) / u.partSize
+	for _, part := range parts {
+		if part.PartNo < 1 || int64(part.PartNo) > totalParts {
+			return part, true
+		}
+		expected := u.partSize
+		if int64(part.PartNo) == totalParts {
+			expected = fileSize - (totalParts-1)*u.partSize
+		}
+		if part.Size != expected {
+			return part, true
+		}
+	}
+	return types.PartFile{}, false
+}
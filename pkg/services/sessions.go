@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+	"uploader/pkg/state"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/lib/rest"
+	"go.uber.org/zap"
+)
+
+// WithSessionIndex records the upload sessions started and not finished in
+// index, so they can be listed and aborted later.
+func WithSessionIndex(index *state.SessionIndex) UploadOption {
+	return func(u *UploadService) {
+		u.sessions = index
+	}
+}
+
+// UploadSession is an unfinished upload session with the parts uploaded so
+// far.
+type UploadSession struct {
+	state.Session
+	Parts int
+	Bytes int64
+}
+
+// trackSession records the session of uploadURL for the file at remotePath.
+func (u *UploadService) trackSession(uploadURL, remotePath string, size int64) {
+	if u.sessions == nil {
+		return
+	}
+	session := state.Session{Hash: path.Base(uploadURL), Path: remotePath, Size: size, Started: time.Now()}
+	if err := u.sessions.Add(session); err != nil {
+		u.logger.Warn("record upload session failed", zap.String("sessionHash", session.Hash), zap.Error(err))
+	}
+}
+
+// WithCleanupOnFailure removes the parts uploaded for a file whose upload
+// failed, with its session, instead of keeping them to resume the upload on
+// the next run. The parts of uploads stopped by cancelling the run are kept.
+func WithCleanupOnFailure(cleanup bool) UploadOption {
+	return func(u *UploadService) {
+		u.cleanupOnFailure = cleanup
+	}
+}
+
+// cleanupFailed removes the parts of filePayload, uploaded for a file that
+// failed, along with the session of uploadURL, if WithCleanupOnFailure is set.
+func (u *UploadService) cleanupFailed(ctx context.Context, uploadURL string, filePayload *types.FilePayload) {
+	if !u.cleanupOnFailure || ctx.Err() != nil {
+		return
+	}
+	var err error
+	if len(filePayload.Parts) == 0 {
+		err = u.deleteSession(ctx, uploadURL)
+	} else {
+		err = u.discardParts(ctx, uploadURL, filePayload)
+	}
+	if err != nil {
+		u.logger.Error("remove parts of failed upload failed", zap.String("fileName", filePayload.Name), zap.Error(err))
+		return
+	}
+	u.logger.Info("removed parts of failed upload", zap.String("fileName", filePayload.Name), zap.Int("parts", len(filePayload.Parts)))
+}
+
+// deleteSession deletes the session of uploadURL along with its parts.
+func (u *UploadService) deleteSession(ctx context.Context, uploadURL string) error {
+	err := u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(ctx, &rest.Opts{Method: "DELETE", Path: uploadURL}, nil, nil)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err == nil && u.sessions != nil {
+		if err := u.sessions.Remove(path.Base(uploadURL)); err != nil {
+			u.logger.Warn("forget upload session failed", zap.String("uploadURL", uploadURL), zap.Error(err))
+		}
+	}
+	return err
+}
+
+// Uploads returns the recorded upload sessions with their uploaded parts.
+// Sessions the server doesn't know anymore are forgotten. It needs
+// WithSessionIndex.
+func (u *UploadService) Uploads() ([]UploadSession, error) {
+	var uploads []UploadSession
+	for _, session := range u.sessions.List() {
+		parts, err := u.sessionParts(session.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 0 {
+			if err := u.sessions.Remove(session.Hash); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		upload := UploadSession{Session: session, Parts: len(parts)}
+		for _, part := range parts {
+			upload.Bytes += part.Size
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// AbortUpload deletes the upload session with the given hash and its parts.
+func (u *UploadService) AbortUpload(hash string) error {
+	return u.deleteSession(u.ctx, "/api/uploads/"+hash)
+}
+
+func (u *UploadService) sessionParts(hash string) ([]types.PartFile, error) {
+	var uploadFile types.UploadFile
+	var resp *http.Response
+	err := u.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = u.http.CallJSON(u.ctx, &rest.Opts{Method: "GET", Path: "/api/uploads/" + hash}, nil, &uploadFile)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return uploadFile.Parts, nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithSettle defers the upload of local files modified less than window
+// ago until they weren't modified for that long, so files still being
+// written, like running downloads, aren't uploaded half-written.
+func WithSettle(window time.Duration) UploadOption {
+	return func(u *UploadService) {
+		u.settle = window
+	}
+}
+
+// deferUnsettled reports whether the local file at filePath was modified
+// within the settle window, and if so calls enqueue again once it may have
+// settled.
+func (u *UploadService) deferUnsettled(filePath string, enqueue func()) bool {
+	if u.settle <= 0 {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	wait := u.settle - time.Since(info.ModTime())
+	if wait <= 0 {
+		return false
+	}
+
+	u.logger.Info("file modified recently, deferring its upload", zap.String("filePath", filePath), zap.Duration("wait", wait))
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		select {
+		case <-time.After(wait):
+			enqueue()
+		case <-u.ctx.Done():
+		}
+	}()
+	return true
+}
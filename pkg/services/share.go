@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// ErrNotShared is returned when revoking the link of a file that isn't
+// shared.
+var ErrNotShared = errors.New("not shared")
+
+// CreateShare creates the public share link of the file or folder with the
+// given ID. An empty password leaves the link unprotected and a zero expiry
+// never expires it.
+func (u *UploadService) CreateShare(id string, password string, expiresAt time.Time) error {
+	req := types.ShareRequest{Password: password}
+	if !expiresAt.IsZero() {
+		req.ExpiresAt = &expiresAt
+	}
+	opts := rest.Opts{
+		Method: "POST",
+		Path:   "/api/files/" + id + "/share",
+	}
+	return u.pacer.Call(func() (bool, error) {
+		resp, err := u.http.CallJSON(u.ctx, &opts, &req, nil)
+		return shouldRetry(u.ctx, resp, err)
+	})
+}
+
+// GetShare returns the public share link of the file or folder with the
+// given ID, or nil if it isn't shared.
+func (u *UploadService) GetShare(id string) (*types.Share, error) {
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/api/files/" + id + "/share",
+	}
+	var share types.Share
+	var resp *http.Response
+	err := u.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = u.http.CallJSON(u.ctx, &opts, nil, &share)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if share.Id == "" {
+		return nil, nil
+	}
+	return &share, nil
+}
+
+// DeleteShare revokes the public share link of the file or folder with the
+// given ID.
+func (u *UploadService) DeleteShare(id string) error {
+	opts := rest.Opts{
+		Method: "DELETE",
+		Path:   "/api/files/" + id + "/share",
+	}
+	var resp *http.Response
+	err := u.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = u.http.CallJSON(u.ctx, &opts, nil, nil)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return ErrNotShared
+	}
+	return err
+}
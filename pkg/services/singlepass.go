@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// sniffLength is the number of bytes http.DetectContentType looks at.
+const sniffLength = 512
+
+// WithSinglePass reads every file once, sequentially, instead of reading
+// each part separately and the file again for its MIME type and checksum:
+// the parts are read in order into buffers, within the limit of
+// WithMaxMemory, while the MIME type is sniffed and the content hashed on
+// the way. It saves seeks and reads on hard disks and requests on http and
+// S3 sources, at the cost of holding up to one part per worker in memory.
+func WithSinglePass() UploadOption {
+	return func(u *UploadService) {
+		u.singlePass = true
+	}
+}
+
+// singlePass reads a source from start to end, keeping its first bytes and
+// its hash.
+type singlePass struct {
+	r      io.ReadCloser
+	pool   *memoryPool
+	hash   hash.Hash
+	format func([]byte) string
+	head   []byte
+}
+
+// newSinglePass opens src for a single pass, hashing the content if hashed.
+func (u *UploadService) newSinglePass(ctx context.Context, src Source, hashed bool) (*singlePass, error) {
+	rc, err := src.Open(ctx, 0, src.Size())
+	if err != nil {
+		return nil, err
+	}
+	// the parts are read ahead already, a read-ahead buffer would compete
+	// with them for memory
+	p := &singlePass{r: rc, pool: u.memory}
+	if hashed {
+		p.hash = u.newContentHash()
+		p.format = u.formatContentHash
+	}
+	return p, nil
+}
+
+func (p *singlePass) Write(b []byte) (int, error) {
+	if p.hash != nil {
+		p.hash.Write(b)
+	}
+	if len(p.head) < sniffLength {
+		p.head = append(p.head, b[:min(len(b), sniffLength-len(p.head))]...)
+	}
+	return len(b), nil
+}
+
+// read returns the next n bytes in a buffer of the memory pool.
+func (p *singlePass) read(ctx context.Context, n int64) ([]byte, error) {
+	buf, err := p.pool.get(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		p.pool.put(buf)
+		return nil, err
+	}
+	p.Write(buf)
+	return buf, nil
+}
+
+// skip reads past the next n bytes, e.g. a part sent by a previous run.
+func (p *singlePass) skip(n int64) error {
+	_, err := io.CopyN(p, p.r, n)
+	return err
+}
+
+func (p *singlePass) mimeType() string {
+	return http.DetectContentType(p.head)
+}
+
+// sum returns the hash of the content read so far, "" if not hashed.
+func (p *singlePass) sum() string {
+	if p.hash == nil {
+		return ""
+	}
+	return p.format(p.hash.Sum(nil))
+}
+
+func (p *singlePass) Close() error {
+	return p.r.Close()
+}
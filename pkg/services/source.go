@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source is something that can be uploaded: a local file or a remote object.
+type Source interface {
+	// Name is the file name used on the remote
+	Name() string
+	// Size is the total size in bytes
+	Size() int64
+	// ModTime is the last modification time, zero if unknown
+	ModTime() time.Time
+	// String is the location of the source, used in logs and the history
+	String() string
+	// Open returns a reader for length bytes starting at offset
+	Open(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+}
+
+// IsURL reports whether the source path is an http(s) URL.
+func IsURL(sourcePath string) bool {
+	lower := strings.ToLower(sourcePath)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// OpenSource returns the source for a local path, an http(s) URL or an
+// s3://bucket/key object.
+func (u *UploadService) OpenSource(sourcePath string) (Source, error) {
+	if IsURL(sourcePath) {
+		return newURLSource(u.ctx, u.sourceClient(), sourcePath)
+	}
+	if IsS3(sourcePath) {
+		return u.newS3Source(sourcePath)
+	}
+	return newLocalSource(sourcePath)
+}
+
+// absPath returns the absolute form of a local path, or the path itself if
+// it can't be resolved.
+func absPath(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
+
+type localSource struct {
+	path string
+	info os.FileInfo
+}
+
+func newLocalSource(filePath string) (*localSource, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", filePath)
+	}
+	return &localSource{path: filePath, info: info}, nil
+}
+
+func (s *localSource) Name() string       { return filepath.Base(s.path) }
+func (s *localSource) Size() int64        { return s.info.Size() }
+func (s *localSource) ModTime() time.Time { return s.info.ModTime() }
+func (s *localSource) String() string     { return s.path }
+
+type fileSection struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (f *fileSection) Close() error {
+	return f.file.Close()
+}
+
+func (s *localSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSection{SectionReader: io.NewSectionReader(file, offset, length), file: file}, nil
+}
+
+// urlHeaderTimeout is how long the server of an http(s) source has to
+// answer a request, the body may take longer.
+const urlHeaderTimeout = 30 * time.Second
+
+// WithSourceTransport fetches the http(s) sources through transport, like
+// the one built from the connection settings of the server, instead of the
+// Go defaults.
+func WithSourceTransport(transport http.RoundTripper) UploadOption {
+	return func(u *UploadService) {
+		u.sourceTransport = transport
+	}
+}
+
+func (u *UploadService) sourceClient() *http.Client {
+	if u.sourceTransport == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: u.sourceTransport}
+}
+
+// urlSource streams a remote object over http(s) using range requests, so
+// every part is fetched independently and can be retried or resumed.
+type urlSource struct {
+	client   *http.Client
+	url      string
+	name     string
+	size     int64
+	modTime  time.Time
+	mimeType string
+	ranges   bool
+}
+
+func newURLSource(ctx context.Context, client *http.Client, rawURL string) (*urlSource, error) {
+	ctx, cancel := context.WithTimeout(ctx, urlHeaderTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	s := &urlSource{client: client, url: rawURL, size: -1, mimeType: resp.Header.Get("Content-Type")}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		s.ranges = true
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			s.size, _ = strconv.ParseInt(total, 10, 64)
+		}
+	case http.StatusOK:
+		s.size = resp.ContentLength
+	default:
+		return nil, fmt.Errorf("get %s: %s", rawURL, resp.Status)
+	}
+	if s.size < 0 {
+		return nil, fmt.Errorf("get %s: unknown content length", rawURL)
+	}
+
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		s.modTime = modTime
+	}
+
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		s.name = path.Base(params["filename"])
+	} else if u, err := url.Parse(rawURL); err == nil {
+		if name, err := url.PathUnescape(path.Base(u.Path)); err == nil && name != "/" && name != "." {
+			s.name = name
+		}
+	}
+	if s.name == "" {
+		s.name = "download"
+	}
+
+	return s, nil
+}
+
+func (s *urlSource) Name() string       { return s.name }
+func (s *urlSource) Size() int64        { return s.size }
+func (s *urlSource) ModTime() time.Time { return s.modTime }
+func (s *urlSource) String() string     { return s.url }
+func (s *urlSource) MimeType() string   { return s.mimeType }
+
+func (s *urlSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	whole := offset == 0 && length == s.size
+	if !whole && !s.ranges {
+		return nil, errors.New("server doesn't support range requests, use a part size bigger than the file")
+	}
+
+	// the request is cancelled if the server doesn't answer in time
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if !whole {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	}
+	timer := time.AfterFunc(urlHeaderTimeout, cancel)
+	resp, err := s.client.Do(req)
+	timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent && !(whole && resp.StatusCode == http.StatusOK) {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("get %s: %s", s.url, resp.Status)
+	}
+	return &cancelBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// cancelBody is the body of a response, releasing its context once closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// reportedMimeType returns the MIME type reported by the source, if any.
+func reportedMimeType(src Source) string {
+	if typed, ok := src.(interface{ MimeType() string }); ok && typed.MimeType() != "" {
+		if mediaType, _, err := mime.ParseMediaType(typed.MimeType()); err == nil {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// detectMimeType returns the MIME type reported by the source, if any, or
+// sniffs it from the first bytes.
+func detectMimeType(ctx context.Context, src Source) (string, error) {
+	if mediaType := reportedMimeType(src); mediaType != "" {
+		return mediaType, nil
+	}
+
+	length := int64(sniffLength)
+	if src.Size() < length {
+		length = src.Size()
+	}
+	rc, err := src.Open(ctx, 0, length)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	buffer := make([]byte, length)
+	n, err := io.ReadFull(rc, buffer)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(buffer[:n]), nil
+}
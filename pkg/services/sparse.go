@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"go.uber.org/zap"
+)
+
+// Handling of sparse files by WithSparse.
+const (
+	// SparseWarn logs the sparse files, which are uploaded as they are.
+	SparseWarn = "warn"
+	// SparsePack uploads only the data of sparse files, see SparseMap.
+	SparsePack = "pack"
+)
+
+// sparseMinHoles is how much of a file must be holes to treat it as sparse.
+const sparseMinHoles = 1024 * 1024
+
+// ValidSparse reports whether mode is supported by WithSparse.
+func ValidSparse(mode string) bool {
+	return mode == SparseWarn || mode == SparsePack
+}
+
+// WithSparse detects sparse local files, like VM images, on Linux and macOS
+// and either only warns about them or uploads their data without the holes.
+func WithSparse(mode string) UploadOption {
+	return func(u *UploadService) {
+		u.sparse = mode
+	}
+}
+
+// SparseMap is stored as <name>.sparse.json next to <name>.sparse, holding
+// the data extents of a sparse file one after the other. Restore the file
+// with the unsparse command.
+type SparseMap struct {
+	Name    string         `json:"name"`
+	Size    int64          `json:"size"`
+	ModTime time.Time      `json:"modTime,omitempty"`
+	Extents []SparseExtent `json:"extents"`
+}
+
+// SparseExtent is a range of a sparse file holding data.
+type SparseExtent struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// isSparse reports whether src is a local file with holes worth skipping.
+func (u *UploadService) isSparse(src Source) (*localSource, bool) {
+	local, ok := asLocal(src)
+	if !ok || u.sparse == "" {
+		return nil, false
+	}
+	allocated, ok := allocatedSize(local.info)
+	return local, ok && local.Size()-allocated >= sparseMinHoles
+}
+
+// packedSource is the data of a sparse file without its holes.
+type packedSource struct {
+	Source
+	name    string
+	extents []SparseExtent
+	// starts are the offsets of the extents in the packed data
+	starts []int64
+	size   int64
+}
+
+func newPackedSource(src Source, name string, extents []SparseExtent) *packedSource {
+	p := &packedSource{Source: src, name: name, extents: extents}
+	for _, extent := range extents {
+		p.starts = append(p.starts, p.size)
+		p.size += extent.Size
+	}
+	return p
+}
+
+func (s *packedSource) Name() string     { return s.name }
+func (s *packedSource) Size() int64      { return s.size }
+func (s *packedSource) String() string   { return s.Source.String() + "#" + s.name }
+func (s *packedSource) MimeType() string { return "application/octet-stream" }
+
+func (s *packedSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	var readers []io.Reader
+	var closers []io.Closer
+	i := sort.Search(len(s.starts), func(i int) bool { return s.starts[i]+s.extents[i].Size > offset })
+	for ; i < len(s.extents) && length > 0; i++ {
+		skip := offset - s.starts[i]
+		n := min(s.extents[i].Size-skip, length)
+		rc, err := s.Source.Open(ctx, s.extents[i].Offset+skip, n)
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, rc)
+		closers = append(closers, rc)
+		offset += n
+		length -= n
+	}
+	return &multiReadCloser{Reader: io.MultiReader(readers...), closers: closers}, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// uploadSparse uploads the data of a sparse file as <name>.sparse, then its
+// map.
+func (u *UploadService) uploadSparse(local *localSource, src Source, historyPath string, destDir string) error {
+	extents, err := dataExtents(local.path, src.Size())
+	if err != nil {
+		return err
+	}
+	packed := newPackedSource(src, src.Name()+".sparse", extents)
+	u.logger.Info("uploading the data of a sparse file", zap.String("filePath", historyPath), zap.Int("extents", len(extents)), zap.Int64("size", src.Size()), zap.Int64("dataSize", packed.Size()))
+
+	// the map adds itself as a transfer
+	u.Progress.AddTransfer(0, packed.Size()-src.Size())
+	if err := u.UploadSource(packed, destDir); err != nil {
+		return err
+	}
+
+	mapName := src.Name() + ".sparse.json"
+	exists, err := u.checkFileExists(u.ctx, mapName, destDir)
+	if err != nil || exists {
+		return err
+	}
+	data, err := json.MarshalIndent(SparseMap{Name: src.Name(), Size: src.Size(), ModTime: src.ModTime(), Extents: extents}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return u.UploadStream(bytes.NewReader(data), historyPath, mapName, destDir)
+}
+
+// Unsparse recreates the sparse file uploaded as filePath.sparse, with its
+// holes, at localPath.
+func (u *UploadService) Unsparse(filePath string, localPath string) error {
+	filePath = path.Clean("/" + filePath)
+	var buf bytes.Buffer
+	if err := u.Cat(filePath+".sparse.json", &buf, 0, -1); err != nil {
+		return fmt.Errorf("read sparse map of %s: %w", filePath, err)
+	}
+	var m SparseMap
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		return fmt.Errorf("read sparse map of %s: %w", filePath, err)
+	}
+
+	packed, err := u.Stat(filePath + ".sparse")
+	if err != nil {
+		return err
+	}
+	src := &remoteSource{from: u, dir: path.Dir(filePath), file: *packed}
+
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	var packedOffset int64
+	for _, extent := range m.Extents {
+		w := io.NewOffsetWriter(f, extent.Offset)
+		if err = u.catFile(src, w, packedOffset, extent.Size); err != nil {
+			break
+		}
+		packedOffset += extent.Size
+	}
+	if err == nil {
+		err = f.Truncate(m.Size)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !m.ModTime.IsZero() {
+		err = os.Chtimes(localPath, m.ModTime, m.ModTime)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", localPath, err)
+	}
+	u.logger.Info("sparse file restored", zap.String("filePath", filePath), zap.String("size", fs.SizeSuffix(m.Size).String()))
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package services
+
+import "os"
+
+func allocatedSize(info os.FileInfo) (int64, bool) {
+	return 0, false
+}
+
+func dataExtents(filePath string, size int64) ([]SparseExtent, error) {
+	return []SparseExtent{{Offset: 0, Size: size}}, nil
+}
@@ -0,0 +1,51 @@
+//go:build linux || darwin
+
+package services
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocatedSize returns the disk space used by a file, smaller than its size
+// for sparse files.
+func allocatedSize(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Blocks) * 512, true
+}
+
+// dataExtents returns the ranges of the file at filePath holding data, the
+// rest are holes reading as zeros.
+func dataExtents(filePath string, size int64) ([]SparseExtent, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fd := int(f.Fd())
+
+	var extents []SparseExtent
+	for offset := int64(0); offset < size; {
+		start, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		end, err := unix.Seek(fd, start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		end = min(end, size)
+		extents = append(extents, SparseExtent{Offset: start, Size: end - start})
+		offset = end
+	}
+	return extents, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithSplitSize uploads files bigger than size, e.g. the maximum file size
+// of the server, as numbered volumes (file.001, file.002, ...) of at most
+// size bytes, plus a manifest describing how to join them back.
+func WithSplitSize(size int64) UploadOption {
+	return func(u *UploadService) {
+		u.splitSize = size
+	}
+}
+
+// SplitManifest is stored as <name>.manifest.json next to the volumes of a
+// split file. The original file is the concatenation of the volumes in
+// order, e.g. `cat file.0* > file`.
+type SplitManifest struct {
+	Name    string        `json:"name"`
+	Size    int64         `json:"size"`
+	ModTime time.Time     `json:"modTime,omitempty"`
+	Volumes []SplitVolume `json:"volumes"`
+}
+
+// SplitVolume is one volume of a split file.
+type SplitVolume struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// volumeSource is a byte range of another source uploaded as its own file.
+type volumeSource struct {
+	Source
+	name   string
+	offset int64
+	size   int64
+}
+
+func (s *volumeSource) Name() string   { return s.name }
+func (s *volumeSource) Size() int64    { return s.size }
+func (s *volumeSource) String() string { return s.Source.String() + "#" + s.name }
+
+func (s *volumeSource) Open(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	return s.Source.Open(ctx, s.offset+offset, length)
+}
+
+// uploadVolumes uploads src split in volumes of volumeSize bytes, then its
+// manifest. Volumes already on the remote are skipped, so an interrupted
+// split upload can be resumed.
+func (u *UploadService) uploadVolumes(src Source, historyPath string, destDir string, volumeSize int64) error {
+	manifest := SplitManifest{
+		Name:    src.Name(),
+		Size:    src.Size(),
+		ModTime: src.ModTime(),
+	}
+	for offset := int64(0); offset < src.Size(); offset += volumeSize {
+		size := volumeSize
+		if offset+size > src.Size() {
+			size = src.Size() - offset
+		}
+		manifest.Volumes = append(manifest.Volumes, SplitVolume{
+			Name:   fmt.Sprintf("%s.%03d", src.Name(), len(manifest.Volumes)+1),
+			Offset: offset,
+			Size:   size,
+		})
+	}
+	u.logger.Info("splitting file in volumes", zap.String("filePath", historyPath), zap.Int("volumes", len(manifest.Volumes)))
+
+	// every volume is a transfer of its own, the manifest adds itself
+	u.Progress.AddTransfer(len(manifest.Volumes)-1, 0)
+	for _, volume := range manifest.Volumes {
+		err := u.UploadSource(&volumeSource{Source: src, name: volume.Name, offset: volume.Offset, size: volume.Size}, destDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	manifestName := src.Name() + ".manifest.json"
+	exists, err := u.checkFileExists(u.ctx, manifestName, destDir)
+	if err != nil || exists {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return u.UploadStream(bytes.NewReader(data), historyPath, manifestName, destDir)
+}
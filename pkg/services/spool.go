@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WithSpoolDir copies every part to a file in dir before sending it, e.g. a
+// RAM disk like /dev/shm or an SSD, so slow and unstable sources, like
+// network shares and failing disks, are read before the connection to the
+// server is opened instead of stalling it into timeouts. Retries send the
+// copy without reading the source again. The folder takes a part for every
+// part being sent at once.
+func WithSpoolDir(dir string) UploadOption {
+	return func(u *UploadService) {
+		u.spoolDir = dir
+	}
+}
+
+// spool copies length bytes at offset of src to a file of the spool folder
+// and returns its path, removed by the caller once the part is sent.
+func (u *UploadService) spool(ctx context.Context, src Source, offset, length int64) (string, error) {
+	file, err := os.CreateTemp(u.spoolDir, "uploader-spool-*.part")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+
+	source, err := src.Open(ctx, offset, length)
+	if err == nil {
+		var n int64
+		n, err = io.CopyN(file, &contextReader{ctx: ctx, r: source}, length)
+		source.Close()
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("source ended after %d of %d bytes", n, length)
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// contextReader stops reading once ctx is done, so cancelling the run
+// doesn't wait for a stuck source to spool a whole part.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
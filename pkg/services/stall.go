@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrStalled is the cause of the part uploads cancelled because no data was
+// sent for the stall timeout.
+var ErrStalled = errors.New("upload stalled")
+
+// Stall actions, taken when no data was sent for the stall timeout while
+// parts are being sent.
+const (
+	// StallRetry cancels the parts being sent and sends them again.
+	StallRetry = "retry"
+	// StallAbort cancels the run.
+	StallAbort = "abort"
+)
+
+// stallCheckInterval is how often the data sent is checked.
+const stallCheckInterval = time.Second
+
+// stallWatch tracks the data sent by the part uploads to detect stalls.
+type stallWatch struct {
+	timeout time.Duration
+	abort   bool
+	// sent counts the bytes read by the part uploads
+	sent atomic.Int64
+
+	mu       sync.Mutex
+	inFlight map[*context.CancelCauseFunc]bool
+	// stalled is set when the run is cancelled
+	stalled bool
+	// done is closed by Close to stop the watch
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WithStallTimeout cancels the parts being sent when the run sent no data
+// for timeout while sending parts, and sends them again, or cancels the run
+// for StallAbort, instead of hanging on dead connections. A timeout of 0 or
+// less disables it.
+func WithStallTimeout(timeout time.Duration, action string) UploadOption {
+	return func(u *UploadService) {
+		if timeout > 0 {
+			u.stall = &stallWatch{timeout: timeout, abort: action == StallAbort, inFlight: map[*context.CancelCauseFunc]bool{}, done: make(chan struct{})}
+		}
+	}
+}
+
+// ValidStallAction reports whether action is a known stall action.
+func ValidStallAction(action string) bool {
+	return action == StallRetry || action == StallAbort
+}
+
+// Stalled reports whether the run was cancelled by StallAbort.
+func (u *UploadService) Stalled() bool {
+	if u.stall == nil {
+		return false
+	}
+	u.stall.mu.Lock()
+	defer u.stall.mu.Unlock()
+	return u.stall.stalled
+}
+
+// Close stops the background work of the service, the stall watch, once
+// its uploads are done. The service must not upload anymore.
+func (u *UploadService) Close() {
+	if u.stall != nil {
+		u.stall.closeOnce.Do(func() { close(u.stall.done) })
+	}
+}
+
+// startStallWatch checks the data sent until the run ends or the service
+// is closed. With StallAbort, it makes the context of the service
+// cancellable.
+func (u *UploadService) startStallWatch() {
+	if u.stall == nil {
+		return
+	}
+	var cancelRun context.CancelCauseFunc
+	if u.stall.abort {
+		u.ctx, cancelRun = context.WithCancelCause(u.ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(stallCheckInterval)
+		defer ticker.Stop()
+		last, lastChange := u.stall.sent.Load(), time.Now()
+		for {
+			select {
+			case <-u.ctx.Done():
+				return
+			case <-u.stall.done:
+				return
+			case now := <-ticker.C:
+				sent := u.stall.sent.Load()
+				if sent != last || !u.stall.active() {
+					last, lastChange = sent, now
+					continue
+				}
+				if now.Sub(lastChange) < u.stall.timeout {
+					continue
+				}
+				lastChange = now
+				if u.stall.abort {
+					u.logger.Error("no data sent, cancelling the run", zap.Duration("for", u.stall.timeout))
+					u.stall.cancelAll(true)
+					cancelRun(ErrStalled)
+					return
+				}
+				u.logger.Warn("no data sent, sending the parts again", zap.Duration("for", u.stall.timeout))
+				u.stall.cancelAll(false)
+			}
+		}
+	}()
+}
+
+// track registers the send of a part cancelled by cancel, and returns the
+// function unregistering it.
+func (s *stallWatch) track(cancel context.CancelCauseFunc) func() {
+	if s == nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[&cancel] = true
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.inFlight, &cancel)
+	}
+}
+
+// active reports whether parts are being sent.
+func (s *stallWatch) active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.inFlight) > 0
+}
+
+// cancelAll cancels the parts being sent with ErrStalled.
+func (s *stallWatch) cancelAll(abort bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stalled = s.stalled || abort
+	for cancel := range s.inFlight {
+		(*cancel)(ErrStalled)
+	}
+}
+
+// count adds n bytes to the data sent.
+func (s *stallWatch) count(n int) {
+	if s != nil {
+		s.sent.Add(int64(n))
+	}
+}
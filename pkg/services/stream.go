@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+	"uploader/pkg/types"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+// streamChunk is the buffer a stream part starts with, grown as data
+// arrives, so small streams don't take a whole part of memory.
+const streamChunk = 4 * 1024 * 1024
+
+// UploadStream uploads everything read from r as fileName into destDir,
+// like rclone rcat. source describes r in the history, e.g. "-" for the
+// standard input. The size isn't known in advance, so every part is
+// buffered in memory before being sent: up to one part per worker plus the
+// one being read, within the limit of WithMaxMemory. A stream bigger than a
+// part therefore takes up to PART_SIZE times WORKERS plus one of memory,
+// while a smaller one only takes about its size.
+func (u *UploadService) UploadStream(r io.Reader, source string, fileName string, destDir string) (err error) {
+	started := time.Now()
+	var fileSize int64
+	defer func() {
+		u.recordTransfer(source, destDir, fileSize, started, false, err)
+	}()
+
+	exists, err := u.checkFileExists(u.ctx, fileName, destDir)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%s already exists in %s", fileName, destDir)
+	}
+
+	bar := u.Progress.NewBar(-1, fileName)
+	defer bar.Close()
+	u.Progress.AddBar(bar)
+	u.Progress.AddTransfer(1, 0)
+
+	session, _ := uuid.NewV4()
+	uploadURL := "/api/uploads/" + hex.EncodeToString(session.Bytes())
+	u.trackSession(uploadURL, path.Join(destDir, fileName), -1)
+	channelID := u.channelFor(destDir)
+	limiter := u.fileLimiter()
+
+	// the parts after a full one start at the part size, the stream is
+	// known to be big
+	chunk := min(int64(streamChunk), u.partSize)
+	readPart := func() ([]byte, error) {
+		buf, err := u.memory.get(u.ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for {
+			var read int
+			read, err = io.ReadFull(r, buf[n:])
+			n += read
+			if err != nil || int64(len(buf)) == u.partSize {
+				break
+			}
+			if buf, err = u.memory.grow(u.ctx, buf, min(2*int64(len(buf)), u.partSize)); err != nil {
+				return nil, err
+			}
+		}
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			u.memory.put(buf)
+			return nil, err
+		}
+		if n == 0 {
+			u.memory.put(buf)
+			return nil, nil
+		}
+		if int64(n) == u.partSize {
+			chunk = u.partSize
+		}
+		fileSize += int64(n)
+		u.Progress.AddTransfer(0, int64(n))
+		return buf[:n], nil
+	}
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		parts      []types.FilePart
+		partErr    error
+		mimeType   string
+		totalParts int64
+	)
+	concurrentWorkers := make(chan struct{}, u.numWorkers)
+
+	for {
+		var current []byte
+		current, err = readPart()
+		if current == nil || err != nil {
+			break
+		}
+		totalParts++
+		last := len(current) < int(u.partSize)
+
+		if totalParts == 1 {
+			mimeType = http.DetectContentType(current)
+		}
+		// the number of parts is only known for a stream of a single part
+		total := int64(0)
+		if totalParts == 1 && last {
+			total = 1
+		}
+		partName := u.partName(fileName, totalParts, total)
+
+		wg.Add(1)
+		concurrentWorkers <- struct{}{}
+		go func(partNo int64, partName string, data []byte) {
+			defer wg.Done()
+			defer func() {
+				u.memory.put(data)
+				<-concurrentWorkers
+			}()
+
+			err := u.waitForWindow(u.ctx)
+			var partFile types.PartFile
+			sent := false
+			if err == nil {
+				size := int64(len(data))
+				open := func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(data)), nil
+				}
+				partFile, sent, err = u.sendPartWithTimeout(u.ctx, uploadURL, open, bar, size, partName, fileName, partNo, channelID, u.encryptFiles, limiter)
+			}
+			if err == nil && !sent {
+				err = errors.New("part not stored by the server")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				u.logger.Error("send part file failed", zap.String("fileName", fileName), zap.Int64("partNumber", partNo), zap.Error(err))
+				if partErr == nil {
+					partErr = err
+				}
+				return
+			}
+			parts = append(parts, types.FilePart{ID: int64(partFile.PartId), PartNo: partFile.PartNo, Salt: partFile.Salt})
+		}(totalParts, partName, current)
+
+		if last {
+			break
+		}
+	}
+	wg.Wait()
+
+	if err == nil {
+		err = partErr
+	}
+	if err == nil && totalParts == 0 {
+		err = errors.New("nothing to upload, the input is empty")
+	}
+	if err != nil {
+		bar.Abort()
+		if partErr != nil {
+			u.cleanupFailed(u.ctx, uploadURL, &types.FilePayload{Name: fileName, Type: "file", Parts: parts, Path: destDir, Size: fileSize, ChannelID: channelID, Encrypted: u.encryptFiles})
+		}
+		return err
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNo < parts[j].PartNo
+	})
+
+	filePayload := types.FilePayload{
+		Name:      fileName,
+		Type:      "file",
+		Parts:     parts,
+		MimeType:  mimeType,
+		Path:      destDir,
+		Size:      fileSize,
+		ChannelID: channelID,
+		Encrypted: u.encryptFiles,
+	}
+	// the name was free when checked before reading the input
+	fileID, err := u.finalize(u.ctx, uploadURL, &filePayload, nil)
+	if errors.Is(err, errAlreadyUploaded) {
+		bar.Finish()
+		u.logger.Info("file exists", zap.String("fileName", fileName))
+		return nil
+	}
+	if err != nil {
+		bar.Abort()
+		return err
+	}
+	bar.Finish()
+	u.recordManifest(fileID, source, destDir, fileName, fileSize, "")
+
+	u.addUsage(fileSize)
+
+	u.logger.Info("file sent", zap.String("fileName", fileName), zap.Int64("fileSize", fileSize))
+
+	return nil
+}
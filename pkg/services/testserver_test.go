@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"uploader/pkg/pb"
+	"uploader/pkg/state"
+	"uploader/pkg/testserver"
+	"uploader/pkg/transport"
+
+	"github.com/rclone/rclone/lib/rest"
+	"go.uber.org/zap"
+)
+
+const testPartSize = 1024
+
+// newTestUploader returns an upload service for a test server injecting
+// faults, with parts of testPartSize bytes.
+func newTestUploader(t *testing.T, faults testserver.Faults, options ...UploadOption) (*UploadService, *testserver.Server) {
+	t.Helper()
+	server := testserver.New(faults)
+	url, stop := server.Start()
+	t.Cleanup(stop)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	progress := pb.NewProgress(&wg, pb.OptionSetWriter(io.Discard))
+	client := NewClient(url, "", CompatAuto, transport.New(transport.Options{}))
+	u := NewUploadService(client, 2, 1, testPartSize, false, false, testserver.ChannelID, false, NewPacer(ctx), ctx, progress, &wg, zap.NewNop(), options...)
+	return u, server
+}
+
+// writeTestFile writes size bytes of a repeating pattern to a file named
+// name in a temporary folder, returning its path and data.
+func writeTestFile(t *testing.T, name string, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath, data
+}
+
+func TestUploadResumesSession(t *testing.T) {
+	u, server := newTestUploader(t, testserver.Faults{})
+	filePath, data := writeTestFile(t, "resume.bin", 3*testPartSize-100)
+
+	// the first part of an interrupted run, told apart by its content
+	src, err := newLocalSource(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := u.sessionHash(u.ctx, src, src.Name(), "/backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := bytes.Repeat([]byte{'x'}, testPartSize)
+	size := int64(len(sent))
+	_, err = u.http.Call(u.ctx, &rest.Opts{
+		Method:        "POST",
+		Path:          "/api/uploads/" + hash,
+		Body:          bytes.NewReader(sent),
+		ContentLength: &size,
+		Parameters:    map[string][]string{"partNo": {"1"}, "partName": {"resume.bin.1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.UploadFile(filePath, "/backups"); err != nil {
+		t.Fatal(err)
+	}
+	content, ok := server.Content("/backups/resume.bin")
+	if !ok {
+		t.Fatal("file not created")
+	}
+	want := append(append([]byte{}, sent...), data[testPartSize:]...)
+	if !bytes.Equal(content, want) {
+		t.Errorf("the part of the earlier session wasn't reused")
+	}
+}
+
+func TestUploadRetriesServerErrors(t *testing.T) {
+	u, server := newTestUploader(t, testserver.Faults{ServerError: 0.3, Seed: 1})
+	filePath, data := writeTestFile(t, "retry.bin", 4*testPartSize)
+
+	if err := u.UploadFile(filePath, "/backups"); err != nil {
+		t.Fatal(err)
+	}
+	content, ok := server.Content("/backups/retry.bin")
+	if !ok || !bytes.Equal(content, data) {
+		t.Errorf("content of %d bytes, want %d", len(content), len(data))
+	}
+	if server.Injected()[500] == 0 {
+		t.Errorf("no server error injected, the retries weren't tested")
+	}
+}
+
+func TestUploadReportsConflict(t *testing.T) {
+	u, server := newTestUploader(t, testserver.Faults{Conflict: 1})
+	filePath, _ := writeTestFile(t, "conflict.bin", 2*testPartSize)
+
+	err := u.UploadFile(filePath, "/backups")
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want %v", err, ErrConflict)
+	}
+	for _, p := range server.Paths() {
+		if p == "/backups/conflict.bin" {
+			t.Errorf("%s created despite the conflict", p)
+		}
+	}
+}
+
+func TestChecksumReplacesChangedFile(t *testing.T) {
+	dir := state.Dir
+	state.Dir = t.TempDir()
+	t.Cleanup(func() { state.Dir = dir })
+	index, err := state.LoadHashIndex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, server := newTestUploader(t, testserver.Faults{}, WithChecksum(index))
+	filePath, data := writeTestFile(t, "changed.bin", 2*testPartSize)
+	if err := u.UploadFile(filePath, "/backups"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range data {
+		data[i] ^= 0xff
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UploadFile(filePath, "/backups"); err != nil {
+		t.Fatal(err)
+	}
+	content, ok := server.Content("/backups/changed.bin")
+	if !ok || !bytes.Equal(content, data) {
+		t.Errorf("the changed content wasn't uploaded")
+	}
+	if paths := server.Paths(); len(paths) != 2 {
+		t.Errorf("got %v, want the folder and the file", paths)
+	}
+}
+
+func TestSizeOnlyReplacesFile(t *testing.T) {
+	u, server := newTestUploader(t, testserver.Faults{}, WithSizeOnly())
+	filePath, _ := writeTestFile(t, "resized.bin", 2*testPartSize)
+	if err := u.UploadFile(filePath, "/backups"); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath, data := writeTestFile(t, "resized.bin", 3*testPartSize)
+	if err := u.UploadFile(filePath, "/backups"); err != nil {
+		t.Fatal(err)
+	}
+	content, ok := server.Content("/backups/resized.bin")
+	if !ok || !bytes.Equal(content, data) {
+		t.Errorf("content of %d bytes, want %d", len(content), len(data))
+	}
+	if paths := server.Paths(); len(paths) != 2 {
+		t.Errorf("got %v, want the folder and the file", paths)
+	}
+}
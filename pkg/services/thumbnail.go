@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"uploader/pkg/thumbnail"
+
+	"go.uber.org/zap"
+)
+
+// ThumbnailDir is the folder, next to the uploaded files, holding their
+// thumbnails.
+const ThumbnailDir = ".thumbnails"
+
+// WithThumbnails uploads a JPEG thumbnail of every image and video, named
+// like the file with a .jpg extension, into the .thumbnails folder next to
+// it. Video thumbnails need ffmpeg installed.
+func WithThumbnails() UploadOption {
+	return func(u *UploadService) {
+		u.thumbnails = true
+	}
+}
+
+func (u *UploadService) uploadThumbnail(src Source, mimeType string, destDir string) error {
+	local, ok := asLocal(src)
+	if !ok || !u.thumbnails {
+		return nil
+	}
+
+	thumb, err := thumbnail.Create(u.ctx, local.path, mimeType)
+	if errors.Is(err, thumbnail.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	thumbDir := path.Join(destDir, ThumbnailDir)
+	if err := u.CreateRemoteDir(thumbDir); err != nil {
+		return err
+	}
+	u.Progress.AddTransfer(1, int64(len(thumb)))
+	if err := u.UploadSource(&bytesSource{name: src.Name() + ".jpg", data: thumb}, thumbDir); err != nil {
+		return err
+	}
+	u.logger.Debug("thumbnail sent", zap.String("fileName", src.Name()))
+	return nil
+}
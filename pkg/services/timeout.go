@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"uploader/pkg/pb"
+	"uploader/pkg/types"
+
+	"github.com/rclone/rclone/fs/fserrors"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// partTimeoutRetries is how many times a part that timed out, or failed
+// with an error worth retrying, is sent again.
+const partTimeoutRetries = 3
+
+// WithPartTimeout aborts sending a part that takes longer than its size at
+// minSpeed bytes per second plus slack, and sends it again, so a stalled
+// connection doesn't hold a worker forever. A minSpeed of 0 or less
+// disables the timeout.
+func WithPartTimeout(minSpeed int64, slack time.Duration) UploadOption {
+	return func(u *UploadService) {
+		u.minSpeed = minSpeed
+		u.timeoutSlack = slack
+	}
+}
+
+// partTimeout returns the time allowed to send size bytes, 0 if unlimited.
+func (u *UploadService) partTimeout(size int64) time.Duration {
+	if u.minSpeed <= 0 {
+		return 0
+	}
+	return time.Duration(size/u.minSpeed)*time.Second + u.timeoutSlack
+}
+
+// countingReader counts the bytes read through it, and adds them to the
+// data sent watched for stalls.
+type countingReader struct {
+	io.Reader
+	n     int64
+	stall *stallWatch
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	c.stall.count(n)
+	return n, err
+}
+
+// sendPartWithTimeout sends the size bytes returned by open as a part,
+// reporting them to bar and within the rate of limiter if not nil, and sends
+// them again when the part timeout expires, the run stalls or the error is
+// worth retrying, like a connection reset or a 500.
+func (u *UploadService) sendPartWithTimeout(ctx context.Context, uploadURL string, open func() (io.ReadCloser, error), bar *pb.Bar, size int64, partName, fileName string, partNo int64, channelID int64, encrypted bool, limiter *rate.Limiter) (types.PartFile, bool, error) {
+	timeout := u.partTimeout(size)
+	if timeout > 0 && limiter != nil {
+		// a limited file is slower than MIN_SPEED on purpose
+		timeout = max(timeout, u.limitedPartTimeout(size))
+	}
+	started := time.Now()
+	for attempt := 0; ; attempt++ {
+		body, err := open()
+		if err != nil {
+			u.recordPart(fileName, partNo, size, attempt+1, time.Since(started), err)
+			return types.PartFile{}, false, err
+		}
+		reader := &countingReader{Reader: bar.ProxyReader(body), stall: u.stall}
+
+		sendCtx, cancelStalled := context.WithCancelCause(ctx)
+		untrack := u.stall.track(cancelStalled)
+		cancel := context.CancelFunc(func() {})
+		if timeout > 0 {
+			sendCtx, cancel = context.WithTimeout(sendCtx, timeout)
+		}
+		partFile, sent, err := u.sendPart(sendCtx, uploadURL, io.LimitReader(limitReader(sendCtx, reader, limiter), size), size, partName, fileName, partNo, channelID, encrypted)
+		stalled := err != nil && ctx.Err() == nil && errors.Is(context.Cause(sendCtx), ErrStalled)
+		timedOut := err != nil && ctx.Err() == nil && errors.Is(sendCtx.Err(), context.DeadlineExceeded)
+		retriable := err != nil && ctx.Err() == nil && !stalled && !timedOut && (fserrors.ShouldRetry(err) || fserrors.IsRetryError(err))
+		untrack()
+		cancel()
+		cancelStalled(nil)
+		body.Close()
+
+		if !timedOut && !stalled && !retriable {
+			u.recordPart(fileName, partNo, size, attempt+1, time.Since(started), err)
+			return partFile, sent, err
+		}
+		if attempt == partTimeoutRetries {
+			switch {
+			case stalled:
+				err = fmt.Errorf("part %d stalled: %w", partNo, err)
+			case timedOut:
+				err = fmt.Errorf("part %d not sent within %v: %w", partNo, timeout, err)
+			}
+			u.recordPart(fileName, partNo, size, attempt+1, time.Since(started), err)
+			return partFile, false, err
+		}
+		bar.IncrInt64(-reader.n)
+		bar.SetPartState(int(partNo), pb.PartRetrying)
+		switch {
+		case stalled:
+			u.logger.Warn("send part stalled, retrying", zap.String("fileName", fileName), zap.Int64("partNumber", partNo), zap.Int("attempt", attempt+1))
+		case timedOut:
+			u.logger.Warn("send part timed out, retrying", zap.String("fileName", fileName), zap.Int64("partNumber", partNo), zap.Duration("timeout", timeout), zap.Int("attempt", attempt+1))
+		default:
+			u.logger.Warn("send part failed, retrying", zap.String("fileName", fileName), zap.Int64("partNumber", partNo), zap.Int("attempt", attempt+1), zap.Error(err))
+			// the server may be overloaded, unlike a stalled connection
+			select {
+			case <-time.After(time.Duration(attempt+1) * time.Second):
+			case <-ctx.Done():
+				u.recordPart(fileName, partNo, size, attempt+1, time.Since(started), ctx.Err())
+				return partFile, false, ctx.Err()
+			}
+		}
+	}
+}
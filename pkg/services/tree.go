@@ -0,0 +1,72 @@
+package services
+
+import (
+	"path"
+	"sort"
+	"uploader/pkg/types"
+)
+
+// TreeNode is a remote file or folder with its contents.
+type TreeNode struct {
+	types.FileInfo
+	Path     string
+	Children []*TreeNode
+	// Listed is false for the folders below the depth limit, whose
+	// contents and size are unknown.
+	Listed bool
+	// Complete is true for files and for the folders listed all the way
+	// down, whose size is exact.
+	Complete bool
+}
+
+// Tree returns the hierarchy below dir, listing folders down to depth levels
+// or all of them if negative, up to concurrency at once. The size of a
+// listed folder is the total of everything below it, as far as it was
+// listed, see Complete. Folders come first, then files, both sorted by name.
+func (u *UploadService) Tree(dir string, depth, concurrency int) (*TreeNode, error) {
+	root := &TreeNode{Path: path.Clean("/" + dir)}
+	root.Name = root.Path
+	root.Type = "folder"
+	nodes := map[string]*TreeNode{root.Path: root}
+	err := u.walkRemote(root.Path, depth, concurrency, func(dir string, files []types.FileInfo) {
+		parent := nodes[dir]
+		parent.Listed = true
+		for _, file := range files {
+			node := &TreeNode{FileInfo: file, Path: path.Join(dir, file.Name)}
+			parent.Children = append(parent.Children, node)
+			if file.Type == "folder" {
+				nodes[node.Path] = node
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	root.total()
+	return root, nil
+}
+
+// total sets the size of the listed folders and sorts their contents.
+func (n *TreeNode) total() {
+	if n.Type != "folder" {
+		n.Complete = true
+		return
+	}
+	if !n.Listed {
+		return
+	}
+	n.Size = 0
+	n.Complete = true
+	for _, child := range n.Children {
+		child.total()
+		n.Size += child.Size
+		n.Complete = n.Complete && child.Complete
+	}
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if (a.Type == "folder") != (b.Type == "folder") {
+			return a.Type == "folder"
+		}
+		return a.Name < b.Name
+	})
+}
@@ -1,27 +1,32 @@
 package services
 
 import (
+	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 	"uploader/pkg/pb"
+	"uploader/pkg/rewrite"
+	"uploader/pkg/state"
+	"uploader/pkg/tracing"
 	"uploader/pkg/types"
 
-	"github.com/gofrs/uuid"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/lib/rest"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -48,10 +53,71 @@ type UploadService struct {
 	Progress          *pb.Progress
 	wg                *sync.WaitGroup
 	logger            *zap.Logger
+	history           *state.History
+	quota             quota
+	window            *TransferWindow
+	windowMu          sync.Mutex
+	windowChanged     chan struct{}
+	dirSettings       map[string]*dirSettings
+	dirSettingsMu     sync.Mutex
+	s3                *s3Store
+	compression       string
+	splitSize         int64
+	maxFileSize       int64
+	oversizeSplit     bool
+	parity            int
+	thumbnails        bool
+	preserveMetadata  bool
+	sparse            string
+	channelRules      []ChannelRule
+	maxDepth          int
+	settle            time.Duration
+	bots              *botPool
+	videoMetadata     bool
+	rewriteRules      rewrite.Rules
+	flatten           string
+	partNameTemplate  *template.Template
+	ignoreCase        bool
+	sizeOnly          bool
+	hashes            *state.HashIndex
+	hashAlgorithm     string
+	sessions          *state.SessionIndex
+	listPageSize      int
+	listConcurrency   int
+	listings          destListings
+	dirs              remoteDirs
+	manifest          *manifest
+	minSpeed          int64
+	timeoutSlack      time.Duration
+	fileBwLimit       int64
+	slowPart          int64
+	cleanupOnFailure  bool
+	stall             *stallWatch
+	memory            *memoryPool
+	bufferSize        int64
+	spoolDir          string
+	sourceTransport   http.RoundTripper
+	singlePass        bool
+	scheduler         *partScheduler
+	smallFileSize     int64
+	smallFiles        chan struct{}
+	queuedFiles       chan struct{}
+	inFlightMu        sync.Mutex
+	inFlight          map[string]bool
 }
 
-func NewUploadService(http *rest.Client, numWorkers int, numTransfers int, partSize int64, encryptFiles bool, randomisePart bool, channelID int64, deleteAfterUpload bool, pacer *fs.Pacer, ctx context.Context, progress *pb.Progress, wg *sync.WaitGroup, logger *zap.Logger) *UploadService {
-	return &UploadService{
+// UploadOption is the type all options of the upload service need to adhere to
+type UploadOption func(u *UploadService)
+
+// WithHistory records every transfer in the local history
+func WithHistory(h *state.History) UploadOption {
+	return func(u *UploadService) {
+		u.history = h
+	}
+}
+
+func NewUploadService(http *rest.Client, numWorkers int, numTransfers int, partSize int64, encryptFiles bool, randomisePart bool, channelID int64, deleteAfterUpload bool, pacer *fs.Pacer, ctx context.Context, progress *pb.Progress, wg *sync.WaitGroup, logger *zap.Logger, options ...UploadOption) *UploadService {
+	u := &UploadService{
 		http:              http,
 		numWorkers:        numWorkers,
 		concurrentFiles:   make(chan struct{}, numTransfers),
@@ -65,7 +131,17 @@ func NewUploadService(http *rest.Client, numWorkers int, numTransfers int, partS
 		wg:                wg,
 		Progress:          progress,
 		logger:            logger,
+		s3:                &s3Store{},
+		memory:            newMemoryPool(),
+		listPageSize:      500,
+		listConcurrency:   8,
+		hashAlgorithm:     HashSHA256,
 	}
+	for _, o := range options {
+		o(u)
+	}
+	u.startStallWatch()
+	return u
 }
 
 func shouldRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
@@ -75,7 +151,31 @@ func shouldRetry(ctx context.Context, resp *http.Response, err error) (bool, err
 	return fserrors.ShouldRetry(err) || fserrors.ShouldRetryHTTP(resp, retryErrorCodes), err
 }
 
-func (u *UploadService) checkFileExists(fileName string, path string) (bool, error) {
+func (u *UploadService) checkFileExists(ctx context.Context, fileName string, path string) (bool, error) {
+	file, err := u.findFile(ctx, fileName, path)
+	return file != nil, err
+}
+
+// findFile returns the remote entry named fileName in path, or nil if there
+// is none.
+func (u *UploadService) findFile(ctx context.Context, fileName string, path string) (*types.FileInfo, error) {
+	if u.ignoreCase {
+		// the find operation of the API matches the exact name
+		files, err := u.list(path)
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			if u.sameName(files[i].Name, fileName) {
+				return &files[i], nil
+			}
+		}
+		return nil, nil
+	}
+
 	opts := rest.Opts{
 		Method: "GET",
 		Path:   "/api/files",
@@ -91,76 +191,158 @@ func (u *UploadService) checkFileExists(fileName string, path string) (bool, err
 	var resp *http.Response
 
 	err = u.pacer.Call(func() (bool, error) {
-		resp, err = u.http.CallJSON(u.ctx, &opts, nil, &info)
-		return shouldRetry(u.ctx, resp, err)
+		resp, err = u.http.CallJSON(ctx, &opts, nil, &info)
+		return shouldRetry(ctx, resp, err)
 	})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	if resp != nil && resp.StatusCode != 404 && len(info.Files) > 0 {
-		return true, nil
+		return &info.Files[0], nil
 	}
 
-	return false, nil
+	return nil, nil
 }
 
+// UploadFile uploads a local file or an http(s) URL into destDir.
 func (u *UploadService) UploadFile(filePath string, destDir string) error {
-	file, err := os.Open(filePath)
+	src, err := u.OpenSource(filePath)
 	if err != nil {
-		u.logger.Fatal("open file failed", zap.String("filePath", filePath), zap.Error(err))
+		u.logger.Error("open source failed", zap.String("filePath", filePath), zap.Error(err))
 		return err
 	}
-	defer file.Close()
+	return u.UploadSource(src, destDir)
+}
 
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil {
-		u.logger.Fatal("read file failed", zap.String("filePath", filePath), zap.Error(err))
+// UploadSource uploads src into destDir, reusing the parts of a previous
+// upload session of the same file when possible.
+func (u *UploadService) UploadSource(src Source, destDir string) error {
+	return u.uploadSource(src, destDir, nil)
+}
+
+// uploadSource uploads src into destDir. Unless nil, replace is the remote
+// file src replaces once finalized, uploaded without comparing them.
+func (u *UploadService) uploadSource(src Source, destDir string, replace *types.FileInfo) (err error) {
+	filePath := src.String()
+	fileSize := src.Size()
+	fileName := src.Name()
+
+	historyPath := filePath
+	if _, ok := asLocal(src); ok {
+		historyPath = absPath(filePath)
+	}
+
+	if err := u.quota.queueIfExceeded(filePath, destDir, fileSize); err != nil {
+		u.Progress.AddTransfer(-1, -fileSize)
+		u.Progress.AddGroup(destDir, -1, -fileSize)
+		u.logger.Info("transfer quota reached, file queued for the next run", zap.String("filePath", filePath))
+		return err
+	}
+
+	var mimeType string
+	if u.singlePass && u.compression == "" {
+		// sniffed while reading the parts
+		mimeType = reportedMimeType(src)
+	} else if mimeType, err = detectMimeType(u.ctx, src); err != nil {
+		u.logger.Error("read file failed", zap.String("filePath", filePath), zap.Error(err))
+		return err
+	}
+
+	if local, ok := u.isSparse(src); ok {
+		if u.sparse == SparsePack {
+			return u.uploadSparse(local, src, historyPath, destDir)
+		}
+		u.logger.Warn("sparse file, its holes are uploaded as zeros", zap.String("filePath", filePath), zap.Int64("fileSize", fileSize))
+	}
+
+	if err := u.checkFileSize(fileName, fileSize); err != nil {
+		u.logger.Error("file too big", zap.String("filePath", filePath), zap.Int64("fileSize", fileSize), zap.Int64("maxFileSize", u.maxFileSize))
 		return err
 	}
+	if volume := u.volumeSize(fileSize); volume > 0 {
+		return u.uploadVolumes(src, historyPath, destDir, volume)
+	}
+
+	if u.shouldCompress(src, mimeType) {
+		return u.uploadCompressed(src, historyPath, destDir)
+	}
+
+	ctx, span := tracing.Start(u.ctx, "UploadFile",
+		attribute.String("file.name", fileName),
+		attribute.String("file.dest", destDir),
+		attribute.Int64("file.size", fileSize))
+	defer func() { tracing.End(span, err) }()
 
-	mimeType := http.DetectContentType(buffer)
-
-	fileInfo, _ := file.Stat()
-	fileSize := fileInfo.Size()
-	fileName := filepath.Base(filePath)
-
-	bar := pb.NewOptions64(fileSize,
-		pb.OptionShowCount(),
-		pb.OptionEnableColorCodes(true),
-		pb.OptionShowBytes(true),
-		pb.OptionSetWidth(10),
-		pb.OptionSetDescription(fileName),
-		pb.OptionSetTheme(pb.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-		pb.OptionFullWidth(),
-		pb.OptionSetRenderBlankState(true))
+	started := time.Now()
+	skipped := false
+	defer func() {
+		u.recordTransfer(historyPath, destDir, fileSize, started, skipped, err)
+	}()
+
+	bar := u.Progress.NewBar(fileSize, fileName, pb.OptionSetGroup(destDir))
 
 	defer bar.Close()
 
 	u.Progress.AddBar(bar)
 
-	exists, err := u.checkFileExists(fileName, destDir)
+	var existing *types.FileInfo
+	if replace == nil {
+		existing, err = u.lookupFile(ctx, fileName, destDir)
+	}
+	contentHash := ""
+	if err == nil && u.hashFirst(src, existing, destDir) {
+		if contentHash, err = u.contentHash(ctx, src); err != nil {
+			bar.Abort()
+			u.logger.Error("read file failed", zap.String("filePath", filePath), zap.Error(err))
+			return err
+		}
+	}
+	uploaded := false
+	if err == nil && contentHash != "" && replace == nil {
+		uploaded, existing, replace, err = u.compareChecksum(ctx, contentHash, existing, fileName, destDir)
+	}
+	if err == nil && !uploaded && existing != nil && existing.Size != fileSize {
+		if err = u.resolveSizeMismatch(existing, fileSize, destDir); err == nil {
+			existing, replace = nil, existing
+		}
+	}
 	if err != nil {
 		bar.Abort()
 		u.logger.Error("check file exists failed", zap.String("fileName", fileName), zap.String("destDir", destDir), zap.Error(err))
 		return err
 	}
-	if exists {
+	if uploaded || existing != nil {
+		skipped = true
+		u.Progress.RemoveBar(bar)
+		u.Progress.AddGroup(destDir, -1, -fileSize)
 		u.Progress.AddExisting(fileSize)
 		u.logger.Info("file exists", zap.String("fileName", fileName))
 		return nil
 	}
 
-	input := fmt.Sprintf("%s:%s:%d", fileName, destDir, fileSize)
+	if err := u.quota.reserve(filePath, destDir, fileSize); errors.Is(err, ErrBiggerThanQuota) {
+		bar.Abort()
+		u.logger.Error("file bigger than the transfer quota", zap.String("filePath", filePath), zap.Int64("fileSize", fileSize), zap.Error(err))
+		return err
+	} else if err != nil {
+		u.Progress.RemoveBar(bar)
+		u.Progress.AddTransfer(-1, -fileSize)
+		u.Progress.AddGroup(destDir, -1, -fileSize)
+		u.logger.Info("transfer quota reached, file queued for the next run", zap.String("filePath", filePath))
+		return err
+	}
+	defer func() {
+		if err != nil {
+			u.quota.release(fileSize)
+		}
+	}()
 
-	hash := md5.Sum([]byte(input))
-	hashString := hex.EncodeToString(hash[:])
+	hashString, err := u.sessionHash(ctx, src, fileName, destDir)
+	if err != nil {
+		bar.Abort()
+		u.logger.Error("read file failed", zap.String("filePath", filePath), zap.Error(err))
+		return err
+	}
 
 	uploadURL := fmt.Sprintf("/api/uploads/%s", hashString)
 
@@ -173,17 +355,31 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 			Path:   uploadURL,
 		}
 
+		done := u.Progress.StartPhase("looking up the upload session of %s", fileName)
 		err := u.pacer.Call(func() (bool, error) {
-			resp, err := u.http.CallJSON(u.ctx, &opts, nil, &uploadFile)
+			resp, err := u.http.CallJSON(ctx, &opts, nil, &uploadFile)
 			return shouldRetry(u.ctx, resp, err)
 		})
+		done()
 		if err == nil {
 			existingParts = make(map[int]types.PartFile, len(uploadFile.Parts))
 			for _, part := range uploadFile.Parts {
 				existingParts[part.PartNo] = part
 			}
 		}
+		u.logger.Debug("upload session", zap.String("fileName", fileName), zap.String("sessionHash", hashString), zap.Int("existingParts", len(existingParts)), zap.Error(err))
+
+		if bad, ok := u.invalidPart(uploadFile.Parts, fileSize); ok {
+			u.logger.Warn("upload session doesn't match the file, starting over", zap.String("fileName", fileName), zap.Int("partNumber", bad.PartNo), zap.Int64("partSize", bad.Size))
+			if err := u.deleteSession(ctx, uploadURL); err != nil {
+				bar.Abort()
+				return err
+			}
+			existingParts = nil
+			uploadFile.Parts = nil
+		}
 	}
+	u.trackSession(uploadURL, path.Join(destDir, fileName), fileSize)
 
 	var wg sync.WaitGroup
 
@@ -193,11 +389,13 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 	}
 
 	uploadedParts := make(chan types.PartFile, totalParts)
-	concurrentWorkers := make(chan struct{}, u.numWorkers)
+	bar.SetParts(int(totalParts))
+	acquireWorker, releaseWorker := u.partWorkers(fileSize)
 
-	channelID := u.channelID
+	channelID := u.channelFor(destDir)
+	limiter := u.fileLimiter()
 
-	encryptFile := u.encryptFiles
+	encryptFile := u.encryptFor(destDir)
 
 	if len(uploadFile.Parts) > 0 {
 		channelID = uploadFile.Parts[0].ChannelID
@@ -233,13 +431,17 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 	// 	barOptions...,
 	// )
 
-	go func() {
-		wg.Wait()
-		close(uploadedParts)
-		bar.Finish()
-	}()
-
-	partName := fileName
+	var pass *singlePass
+	if u.singlePass {
+		pass, err = u.newSinglePass(ctx, src, u.hashes != nil && contentHash == "")
+		if err != nil {
+			bar.Abort()
+			u.logger.Error("open source failed", zap.String("filePath", filePath), zap.Error(err))
+			return err
+		}
+		defer pass.Close()
+	}
+	var readErr error
 
 	for i := int64(0); i < totalParts; i++ {
 		start := i * u.partSize
@@ -249,73 +451,106 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 		}
 
 		wg.Add(1)
-		concurrentWorkers <- struct{}{}
+		if readErr = acquireWorker(ctx); readErr != nil {
+			wg.Done()
+			break
+		}
+
+		var data []byte
+		if pass != nil {
+			if _, ok := existingParts[int(i)+1]; ok {
+				readErr = pass.skip(end - start)
+			} else {
+				data, readErr = pass.read(ctx, end-start)
+			}
+			if readErr != nil {
+				u.logger.Error("read file failed", zap.String("filePath", filePath), zap.Int64("partNumber", i+1), zap.Error(readErr))
+				releaseWorker()
+				wg.Done()
+				break
+			}
+		}
 
-		go func(partNumber int64, start, end int64) {
+		go func(partNumber int64, start, end int64, data []byte) {
 			defer wg.Done()
 			defer func() {
-				<-concurrentWorkers
+				if data != nil {
+					u.memory.put(data)
+				}
+				releaseWorker()
 			}()
 
-			file, err := os.Open(filePath)
-			if err != nil {
-				u.logger.Error("open file failed", zap.String("filePath", filePath), zap.Error(err))
-				return
-			}
-			defer file.Close()
+			partCtx, partSpan := tracing.Start(ctx, "UploadPart",
+				attribute.Int64("part.number", partNumber+1),
+				attribute.Int64("part.size", end-start))
+			var partErr error
+			defer func() { tracing.End(partSpan, partErr) }()
+
 			if existing, ok := existingParts[int(partNumber)+1]; ok {
 				uploadedParts <- existing
 				bar.IncrInt64(existing.Size)
+				bar.SetPartState(int(partNumber)+1, pb.PartDone)
 				return
 			}
 
-			_, err = file.Seek(start, io.SeekStart)
-
-			if err != nil {
-				u.logger.Error("seek file failed", zap.String("filePath", filePath), zap.Error(err))
+			if err := u.waitForWindow(partCtx); err != nil {
+				partErr = err
 				return
 			}
-
-			pr := bar.ProxyReader(file)
+			bar.SetPartState(int(partNumber)+1, pb.PartUploading)
 
 			contentLength := end - start
-			reader := io.LimitReader(pr, contentLength)
 
-			if u.randomisePart {
-				u1, _ := uuid.NewV4()
-				partName = hex.EncodeToString(u1.Bytes())
-			} else if totalParts > 1 {
-				partName = fmt.Sprintf("%s.part.%03d", fileName, partNumber+1)
+			var spooled string
+			if data == nil && u.spoolDir != "" {
+				spooled, partErr = u.spool(partCtx, src, start, contentLength)
+				if partErr != nil {
+					bar.SetPartState(int(partNumber)+1, pb.PartFailed)
+					u.logger.Error("spool part failed", zap.String("filePath", filePath), zap.Int64("partNumber", partNumber+1), zap.String("spoolDir", u.spoolDir), zap.Error(partErr))
+					return
+				}
+				defer os.Remove(spooled)
 			}
 
-			opts := rest.Opts{
-				Method:        "POST",
-				Path:          uploadURL,
-				Body:          reader,
-				ContentLength: &contentLength,
-				Parameters: url.Values{
-					"partName":  []string{partName},
-					"fileName":  []string{fileName},
-					"partNo":    []string{strconv.FormatInt(partNumber+1, 10)},
-					"channelId": []string{strconv.FormatInt(int64(channelID), 10)},
-					"encrypted": []string{strconv.FormatBool(encryptFile)},
-				},
+			open := func() (io.ReadCloser, error) {
+				if data != nil {
+					return io.NopCloser(bytes.NewReader(data)), nil
+				}
+				if spooled != "" {
+					return os.Open(spooled)
+				}
+				source, err := src.Open(partCtx, start, contentLength)
+				if err != nil {
+					u.logger.Error("open source failed", zap.String("filePath", filePath), zap.Int64("partNumber", partNumber+1), zap.Error(err))
+					return nil, err
+				}
+				return u.readAhead(partCtx, source), nil
 			}
 
-			var partFile types.PartFile
-			resp, err := u.http.CallJSON(context.TODO(), &opts, nil, &partFile)
+			partName := u.partName(fileName, partNumber+1, totalParts)
 
+			partFile, sent, err := u.sendPartWithTimeout(partCtx, uploadURL, open, bar, contentLength, partName, fileName, partNumber+1, channelID, encryptFile, limiter)
 			if err != nil {
+				partErr = err
+				bar.SetPartState(int(partNumber)+1, pb.PartFailed)
 				u.logger.Error("send part file failed", zap.String("filePath", filePath), zap.Int64("partNumber", partNumber+1), zap.Int64("totalParts", totalParts), zap.Int64("partSize", contentLength), zap.Error(err))
 				return
 			}
-			if resp.StatusCode == 201 {
+			bar.SetPartState(int(partNumber)+1, pb.PartDone)
+			if sent {
 				uploadedParts <- partFile
 				u.logger.Debug("part file sent", zap.String("fileName", fileName), zap.String("partName", partFile.Name), zap.Int("partNumber", partFile.PartNo), zap.Int64("totalParts", totalParts), zap.Int64("partSize", partFile.Size), zap.Int("partId", partFile.PartId))
 			}
-		}(i, start, end)
+		}(i, start, end, data)
 	}
 
+	// every part is added to wg by now, so Wait can't return early
+	go func() {
+		wg.Wait()
+		close(uploadedParts)
+		bar.Finish()
+	}()
+
 	var parts []types.FilePart
 	for uploadPart := range uploadedParts {
 		if uploadPart.PartId != 0 && uploadPart.Size != 0 {
@@ -323,9 +558,14 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 		}
 	}
 
+	if readErr != nil {
+		bar.Abort()
+		return readErr
+	}
 	if len(parts) != int(totalParts) {
 		bar.Abort()
 		u.logger.Error("uploaded parts incomplete", zap.String("fileName", fileName), zap.Int("uploadedParts", len(parts)), zap.Int64("totalParts", totalParts))
+		u.cleanupFailed(ctx, uploadURL, &types.FilePayload{Name: fileName, Type: "file", Parts: parts, Path: destDir, Size: fileSize, ChannelID: channelID, Encrypted: encryptFile})
 		return fmt.Errorf("uploaded parts incomplete")
 	}
 	// bar.Wait()
@@ -334,6 +574,16 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 		return parts[i].PartNo < parts[j].PartNo
 	})
 
+	passHashed := false
+	if pass != nil {
+		if mimeType == "" {
+			mimeType = pass.mimeType()
+		}
+		if sum := pass.sum(); sum != "" {
+			contentHash, passHashed = sum, true
+		}
+	}
+
 	filePayload := types.FilePayload{
 		Name:      fileName,
 		Type:      "file",
@@ -343,41 +593,216 @@ func (u *UploadService) UploadFile(filePath string, destDir string) error {
 		Size:      fileSize,
 		ChannelID: channelID,
 		Encrypted: encryptFile,
+		Metadata:  u.probeVideo(src, mimeType),
 	}
 
-	_, err = json.Marshal(filePayload)
+	if passHashed {
+		renamed, err := u.findRenamed(ctx, contentHash, fileName, destDir)
+		if err != nil {
+			return err
+		}
+		if renamed {
+			skipped = true
+			return u.discardParts(ctx, uploadURL, &filePayload)
+		}
+	}
 
+	var fileID string
+	if replace != nil {
+		fileID, err = u.replaceFile(ctx, uploadURL, &filePayload, replace)
+	} else {
+		fileID, err = u.finalize(ctx, uploadURL, &filePayload, existing)
+	}
+	if errors.Is(err, errAlreadyUploaded) {
+		skipped = true
+		u.logger.Info("file exists", zap.String("fileName", fileName))
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	u.recordManifest(fileID, historyPath, destDir, fileName, fileSize, contentHash)
+
+	if contentHash != "" {
+		if err := u.hashes.Set(path.Join(destDir, fileName), contentHash); err != nil {
+			u.logger.Error("record file hash failed", zap.String("fileName", fileName), zap.Error(err))
+		}
+	}
+
+	u.addUsage(fileSize)
+
+	u.logger.Info("file sent", zap.String("fileName", fileName), zap.Int64("fileSize", fileSize))
+
+	if err := u.uploadParity(src, destDir); err != nil {
+		u.logger.Error("upload parity files failed", zap.String("filePath", filePath), zap.Error(err))
+	}
+	if err := u.uploadThumbnail(src, mimeType, destDir); err != nil {
+		u.logger.Error("upload thumbnail failed", zap.String("filePath", filePath), zap.Error(err))
+	}
+	if err := u.uploadMetadata(src, destDir); err != nil {
+		u.logger.Error("upload metadata failed", zap.String("filePath", filePath), zap.Error(err))
+	}
+
+	return nil
+}
+
+// sendPart uploads one part of a file to the upload session at uploadURL,
+// sent is false if the server didn't store it.
+func (u *UploadService) sendPart(ctx context.Context, uploadURL string, body io.Reader, size int64, partName, fileName string, partNo int64, channelID int64, encrypted bool) (partFile types.PartFile, sent bool, err error) {
+	opts := rest.Opts{
+		Method:        "POST",
+		Path:          uploadURL,
+		Body:          body,
+		ContentLength: &size,
+		Parameters: url.Values{
+			"partName":  []string{partName},
+			"fileName":  []string{fileName},
+			"partNo":    []string{strconv.FormatInt(partNo, 10)},
+			"channelId": []string{strconv.FormatInt(channelID, 10)},
+			"encrypted": []string{strconv.FormatBool(encrypted)},
+		},
+	}
+	bot := u.bots.pick()
+	if bot != "" {
+		opts.Parameters.Set(botParameter, bot)
+	}
+
+	started := time.Now()
+	resp, err := u.http.CallJSON(ctx, &opts, nil, &partFile)
+	u.bots.report(bot, resp, err)
+	u.recordAttempt(fileName, partNo, bot, size, time.Since(started), err)
+	if err != nil && fserrors.ShouldRetryHTTP(resp, retryErrorCodes) {
+		err = fserrors.RetryError(err)
+	}
+	if err != nil {
+		return partFile, false, err
+	}
+	return partFile, resp.StatusCode == 201, nil
+}
+
+// finalize creates the file from its uploaded parts, removes the upload
+// session and returns the ID of the file. An attempt timing out may still
+// have created the file, so before sending it again, and on a conflict after
+// a retry, the file is looked up: a file of the same name and size, other
+// than existing, the entry of that name found before uploading or nil,
+// means an earlier attempt went through.
+func (u *UploadService) finalize(ctx context.Context, uploadURL string, filePayload *types.FilePayload, existing *types.FileInfo) (string, error) {
+	defer u.Progress.StartPhase("finalizing %s", filePayload.Name)()
 
 	opts := rest.Opts{
 		Method: "POST",
 		Path:   "/api/files",
 	}
 
-	err = u.pacer.Call(func() (bool, error) {
-		resp, err := u.http.CallJSON(u.ctx, &opts, &filePayload, nil)
+	finalizeCtx, finalizeSpan := tracing.Start(ctx, "Finalize", attribute.Int("file.parts", len(filePayload.Parts)))
+	// a file already there is not one created by an attempt
+	var existingID string
+	if existing != nil {
+		existingID = existing.Id
+	}
+	var (
+		resp     *http.Response
+		attempts int
+		created  types.FileInfo
+		// finalized is the file created by an earlier attempt
+		finalized *types.FileInfo
+		// rejected is set when the last attempt was refused by the server,
+		// which didn't create the file then; a timeout or rate limit isn't
+		// a refusal, the parts stay for the next run
+		rejected bool
+	)
+	err := u.pacer.Call(func() (bool, error) {
+		var err error
+		rejected = false
+		if attempts++; attempts > 1 {
+			if finalized, err = u.finalized(finalizeCtx, filePayload, existingID); err != nil || finalized != nil {
+				return shouldRetry(u.ctx, nil, err)
+			}
+		}
+		resp, err = u.http.CallJSON(finalizeCtx, &opts, filePayload, &created)
+		rejected = err != nil && resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests
 		return shouldRetry(u.ctx, resp, err)
 	})
+	tracing.End(finalizeSpan, err)
 
+	if rejected && resp.StatusCode == http.StatusConflict {
+		if attempts == 1 {
+			return "", u.resolveConflict(ctx, uploadURL, filePayload)
+		}
+		// the name may be taken by the file of an earlier attempt
+		if finalized, err = u.finalized(ctx, filePayload, existingID); err != nil {
+			return "", err
+		}
+		if finalized == nil {
+			return "", u.resolveConflict(ctx, uploadURL, filePayload)
+		}
+	}
+	if rejected && finalized == nil {
+		u.cleanupFailed(ctx, uploadURL, filePayload)
+	}
+	if finalized != nil {
+		u.logger.Info("file created by an earlier finalize attempt", zap.String("fileName", filePayload.Name), zap.Int("attempts", attempts))
+		created = *finalized
+	}
 	if err != nil {
-		return err
+		return "", err
+	}
+	if created.Name == "" {
+		created.Name, created.Type, created.Size = filePayload.Name, "file", filePayload.Size
 	}
+	u.addedFile(filePayload.Path, created)
 
-	err = u.pacer.Call(func() (bool, error) {
-		resp, err := u.http.CallJSON(u.ctx, &rest.Opts{Method: "DELETE", Path: uploadURL}, nil, nil)
-		return shouldRetry(u.ctx, resp, err)
-	})
+	return created.Id, u.deleteSession(ctx, uploadURL)
+}
 
-	if err != nil {
-		return err
+// finalized returns the file of filePayload if it exists with its size
+// and isn't the one with existingID, found before uploading, or nil.
+func (u *UploadService) finalized(ctx context.Context, filePayload *types.FilePayload, existingID string) (*types.FileInfo, error) {
+	file, err := u.findFile(ctx, filePayload.Name, filePayload.Path)
+	if err != nil || file == nil {
+		return nil, err
 	}
+	if file.Type != "file" || file.Size != filePayload.Size || file.Id == existingID {
+		return nil, nil
+	}
+	return file, nil
+}
 
-	u.logger.Info("file sent", zap.String("fileName", fileName), zap.Int64("fileSize", fileSize))
+// recordTransfer adds the outcome of a file transfer to the history, if enabled.
+func (u *UploadService) recordTransfer(filePath, destDir string, size int64, started time.Time, skipped bool, err error) {
+	if err != nil {
+		u.quota.fail(filePath, destDir, err)
+	}
+	if u.history == nil || errors.Is(err, ErrQuotaExceeded) {
+		return
+	}
 
-	return nil
+	duration := time.Since(started).Seconds()
+	t := state.Transfer{
+		Time:     started,
+		Path:     filePath,
+		Dest:     destDir,
+		Size:     size,
+		Duration: duration,
+		Result:   state.ResultUploaded,
+	}
+	switch {
+	case err != nil:
+		t.Result = state.ResultFailed
+		t.Error = err.Error()
+	case skipped:
+		t.Result = state.ResultSkipped
+	case duration > 0:
+		t.Speed = float64(size) / duration
+	}
+	if err := u.history.Record(t); err != nil {
+		u.logger.Warn("record transfer history failed", zap.String("filePath", filePath), zap.Error(err))
+	}
 }
+
+// CreateRemoteDir creates the folder path and the missing ones above it,
+// unless this run created it already.
 func (u *UploadService) CreateRemoteDir(path string) error {
 	opts := rest.Opts{
 		Method: "POST",
@@ -387,6 +812,9 @@ func (u *UploadService) CreateRemoteDir(path string) error {
 	if len(path) == 0 || path[0] != '/' {
 		path = "/" + path
 	}
+	if u.dirs.exists(path) {
+		return nil
+	}
 
 	mkdir := types.CreateDirRequest{
 		Path: path,
@@ -400,10 +828,30 @@ func (u *UploadService) CreateRemoteDir(path string) error {
 	if err != nil {
 		return err
 	}
+	u.remoteDirCreated(path)
 	return nil
 }
 
-func (u *UploadService) readMetaDataForPath(path string, options *types.MetadataRequestOptions) (*types.ReadMetadataResponse, error) {
+// CreateRemoteDirs creates path and every missing folder above it.
+func (u *UploadService) CreateRemoteDirs(remotePath string) error {
+	return u.EnsureRemoteDirs(remotePath)
+}
+
+// RemoteDirExists reports whether the folder dir exists on the remote.
+func (u *UploadService) RemoteDirExists(dir string) (bool, error) {
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		return true, nil
+	}
+	parent, name := path.Split(dir)
+	file, err := u.findFile(u.ctx, name, path.Clean("/"+parent))
+	if err != nil {
+		return false, err
+	}
+	return file != nil && file.Type == "folder", nil
+}
+
+func (u *UploadService) readMetaDataForPath(ctx context.Context, path string, options *types.MetadataRequestOptions) (*types.ReadMetadataResponse, error) {
 
 	opts := rest.Opts{
 		Method: "GET",
@@ -422,8 +870,8 @@ func (u *UploadService) readMetaDataForPath(path string, options *types.Metadata
 	var resp *http.Response
 
 	err = u.pacer.Call(func() (bool, error) {
-		resp, err = u.http.CallJSON(u.ctx, &opts, nil, &info)
-		return shouldRetry(u.ctx, resp, err)
+		resp, err = u.http.CallJSON(ctx, &opts, nil, &info)
+		return shouldRetry(ctx, resp, err)
 	})
 
 	if err != nil && resp != nil && resp.StatusCode == 404 {
@@ -438,16 +886,20 @@ func (u *UploadService) readMetaDataForPath(path string, options *types.Metadata
 }
 
 func (u *UploadService) list(path string) (files []types.FileInfo, err error) {
+	ctx, span := tracing.Start(u.ctx, "ListDirectory", attribute.String("dir.path", path))
+	defer func() { tracing.End(span, err) }()
 
-	var limit uint64 = 500
 	var nextPageToken string = ""
 	for {
 		opts := &types.MetadataRequestOptions{
-			PerPage:       limit,
+			PerPage:       uint64(u.listPageSize),
 			NextPageToken: nextPageToken,
 		}
 
-		info, err := u.readMetaDataForPath(path, opts)
+		info, err := u.readPage(ctx, path, opts)
+		if err != nil && len(files) > 0 {
+			return files, &PartialListError{Dir: path, Listed: len(files), Err: err}
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -462,16 +914,38 @@ func (u *UploadService) list(path string) (files []types.FileInfo, err error) {
 	return files, nil
 }
 
-func (u *UploadService) checkFileExistsInDirectory(name string, files []types.FileInfo) bool {
-	for _, item := range files {
-		if item.Name == name {
-			return true
+func (u *UploadService) findFileInDirectory(name string, files []types.FileInfo) *types.FileInfo {
+	for i := range files {
+		if u.sameName(files[i].Name, name) {
+			return &files[i]
 		}
 	}
-	return false
+	return nil
 }
 
+// UploadFilesInDirectory uploads the folder sourcePath into destDir. Its
+// files are added to the totals of the progress as they're found.
 func (u *UploadService) UploadFilesInDirectory(sourcePath string, destDir string) error {
+	defer u.Progress.StartScan()()
+	if mapPath := u.pathMapper(); mapPath != nil {
+		return u.uploadMapped(sourcePath, destDir, mapPath)
+	}
+	settings, overridden, err := applyOverride(sourcePath, destDir, nil)
+	if err != nil {
+		return err
+	}
+	if overridden != destDir {
+		if err := u.CreateRemoteDirs(overridden); err != nil {
+			return err
+		}
+	}
+	return u.uploadDirectory(sourcePath, overridden, 1, settings)
+}
+
+// uploadDirectory uploads the files of sourcePath, found at level below the
+// uploaded folder, into destDir with settings and walks its folders.
+func (u *UploadService) uploadDirectory(sourcePath string, destDir string, level int, settings *dirSettings) error {
+
 	entries, err := os.ReadDir(sourcePath)
 	if err != nil {
 		u.logger.Error("read file failed", zap.String("sourcePath", sourcePath), zap.Error(err))
@@ -479,63 +953,67 @@ func (u *UploadService) UploadFilesInDirectory(sourcePath string, destDir string
 	}
 
 	destDir = strings.ReplaceAll(destDir, "\\", "/")
-
-	filesInRemote, err := u.list(destDir)
+	u.setDirSettings(destDir, settings)
+
+	filesInRemote, err := u.listDest(destDir)
+	var partial *PartialListError
+	if errors.As(err, &partial) {
+		// files missing from the listing are still checked one by one
+		u.logger.Warn("remote listing incomplete", zap.String("destDir", destDir), zap.Error(err))
+		err = nil
+	}
 	if err != nil {
 		u.logger.Error("list remote files failed", zap.String("destDir", destDir), zap.Error(err))
 		return err
 	}
 
+	u.addFolderGroup(entries, destDir, filesInRemote, settings)
+
 	for _, entry := range entries {
 		fullPath := filepath.Join(sourcePath, entry.Name())
+		if settings.excluded(entry.Name()) {
+			continue
+		}
 
 		if entry.IsDir() {
+			if !u.descend(level) {
+				continue
+			}
 			subDir := filepath.Join(destDir, entry.Name())
 			subDir = strings.ReplaceAll(subDir, "\\", "/")
-			err := u.CreateRemoteDir(subDir)
+			subSettings, overridden, err := applyOverride(fullPath, subDir, settings)
+			if err != nil {
+				u.logger.Error("read folder overrides failed", zap.String("fullPath", fullPath), zap.Error(err))
+				continue
+			}
+			if overridden != subDir {
+				subDir = overridden
+				err = u.CreateRemoteDirs(subDir)
+			} else {
+				err = u.CreateRemoteDir(subDir)
+			}
 			if err != nil {
 				u.logger.Error("create remote dir failed", zap.String("subDir", subDir), zap.Error(err))
 				continue
 			}
-			err = u.UploadFilesInDirectory(fullPath, subDir)
+			err = u.uploadDirectory(fullPath, subDir, level+1, subSettings)
 			if err != nil {
 				u.logger.Error("upload files in directory failed", zap.String("fullPath", fullPath), zap.String("subDir", subDir), zap.Error(err))
 				continue
 			}
 		} else {
-			exists := u.checkFileExistsInDirectory(entry.Name(), filesInRemote)
-			if !exists {
-				u.wg.Add(1)
-				u.concurrentFiles <- struct{}{}
-
-				go func(file os.DirEntry) {
-					defer u.wg.Done()
-					defer func() {
-						<-u.concurrentFiles
-					}()
-
-					err := u.UploadFile(fullPath, destDir)
-					if err != nil {
-						u.logger.Error("upload failed", zap.String("fullPath", fullPath), zap.Error(err))
-						return
-					}
-
-					if u.deleteAfterUpload {
-						err = os.Remove(fullPath)
-						if err != nil {
-							u.logger.Error("delete file failed", zap.String("fullPath", fullPath), zap.Error(err))
-							return
-						}
-						u.logger.Info("deleted file", zap.String("fullPath", fullPath))
-					}
-				}(entry)
+			existing := u.findFileInDirectory(entry.Name(), filesInRemote)
+			fileInfo, err := entry.Info()
+			if err != nil {
+				u.logger.Error("stat for existing file failed", zap.String("fullPath", fullPath), zap.Error(err))
+				return err
+			}
+			u.Progress.AddTransfer(1, fileInfo.Size())
+			if u.needsUpload(existing, fileInfo.Size()) {
+				u.EnqueueFile(fullPath, destDir)
 			} else {
-				fileInfo, err := os.Stat(fullPath)
-				if err != nil {
-					u.logger.Error("stat for existing file failed", zap.String("fullPath", fullPath), zap.Error(err))
-					return err
-				}
 				u.Progress.AddExisting(fileInfo.Size())
+				u.recordTransfer(absPath(fullPath), destDir, fileInfo.Size(), time.Now(), true, nil)
 				u.logger.Info("file in directory exists", zap.String("fullPath", fullPath))
 			}
 		}
@@ -544,38 +1022,127 @@ func (u *UploadService) UploadFilesInDirectory(sourcePath string, destDir string
 	return nil
 }
 
-func (u *UploadService) GetFilesInDirectoryInfo(sourcePath string) (FileInfo, error) {
-	entries, err := os.ReadDir(sourcePath)
-	if err != nil {
-		return FileInfo{}, err
-	}
-
-	var info FileInfo
+// needsUpload reports whether a local file of size, whose remote copy in
+// the folder listing is existing, is queued for upload.
+func (u *UploadService) needsUpload(existing *types.FileInfo, size int64) bool {
+	// files of another size, or compared by checksum, are checked again by
+	// UploadSource
+	return existing == nil || existing.Size != size || u.hashes != nil
+}
 
+// addFolderGroup adds the files of entries to upload into destDir to the
+// progress of the folder, shown with the bars grouped by folder.
+func (u *UploadService) addFolderGroup(entries []os.DirEntry, destDir string, filesInRemote []types.FileInfo, settings *dirSettings) {
+	files, size := 0, int64(0)
 	for _, entry := range entries {
-		fullPath := filepath.Join(sourcePath, entry.Name())
+		if entry.IsDir() || settings.excluded(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if u.needsUpload(u.findFileInDirectory(entry.Name(), filesInRemote), info.Size()) {
+			files++
+			size += info.Size()
+		}
+	}
+	u.Progress.AddGroup(destDir, files, size)
+}
 
-		if entry.IsDir() {
-			subInfo, err := u.GetFilesInDirectoryInfo(fullPath)
-			if err != nil {
-				return FileInfo{}, err
-			}
+// EnqueueFile uploads a file in the background, waiting while the maximum
+// number of concurrent transfers is reached. Use Progress.Wait to wait for
+// the queued uploads to finish.
+func (u *UploadService) EnqueueFile(fullPath string, destDir string) {
+	if !IsURL(fullPath) && !IsS3(fullPath) && u.deferUnsettled(fullPath, func() { u.EnqueueFile(fullPath, destDir) }) {
+		return
+	}
+	size := int64(-1)
+	if info, err := os.Stat(fullPath); err == nil {
+		size = info.Size()
+	}
+	u.enqueue(fullPath, sourceID(fullPath), path.Base(filepath.ToSlash(fullPath)), destDir, size, func() error {
+		return u.UploadFile(fullPath, destDir)
+	})
+}
 
-			info.TotalFiles += subInfo.TotalFiles
-			info.TotalSize += subInfo.TotalSize
-		} else {
-			info.TotalFiles++
-			fileInfo, err := os.Stat(fullPath)
-			if err == nil {
-				info.TotalSize += fileInfo.Size()
-			}
+// EnqueueSource uploads an already opened source in the background, like
+// EnqueueFile.
+func (u *UploadService) EnqueueSource(src Source, destDir string) {
+	id := src.String()
+	if local, ok := asLocal(src); ok {
+		if u.deferUnsettled(local.path, func() { u.enqueueRestat(src, local.path, destDir) }) {
+			return
 		}
+		id = fileID(local.path)
 	}
+	u.enqueue(src.String(), id, src.Name(), destDir, src.Size(), func() error {
+		return u.UploadSource(src, destDir)
+	})
+}
 
-	return info, nil
+// enqueueRestat enqueues src again after the file at filePath settled,
+// stat'ed anew since src holds the size and modification time it had
+// while still being written.
+func (u *UploadService) enqueueRestat(src Source, filePath, destDir string) {
+	fresh, err := newLocalSource(filePath)
+	if err != nil {
+		u.logger.Error("upload failed", zap.String("filePath", filePath), zap.Error(err))
+		u.Progress.AddFailed(src.Size())
+		return
+	}
+	var restated Source = fresh
+	if src.Name() != fresh.Name() {
+		restated = Rename(fresh, src.Name())
+	}
+	u.EnqueueSource(restated, destDir)
 }
 
-type FileInfo struct {
-	TotalFiles int
-	TotalSize  int64
+func (u *UploadService) enqueue(fullPath, id, fileName, destDir string, size int64, upload func() error) {
+	if u.refuseTooBig(fullPath, fileName, destDir, size) {
+		return
+	}
+	if !u.claim(id, fileName, destDir) {
+		if size > 0 {
+			u.Progress.AddExisting(size)
+		}
+		return
+	}
+	lane := u.fileLane(size)
+	u.wg.Add(1)
+	if u.queuedFiles != nil {
+		u.queuedFiles <- struct{}{}
+	} else {
+		lane <- struct{}{}
+	}
+
+	go func() {
+		defer u.wg.Done()
+		defer u.unclaim(id, fileName, destDir)
+		if u.queuedFiles != nil {
+			lane <- struct{}{}
+			<-u.queuedFiles
+		}
+		defer func() {
+			<-lane
+		}()
+
+		err := upload()
+		if errors.Is(err, ErrQuotaExceeded) {
+			return
+		}
+		if err != nil {
+			u.logger.Error("upload failed", zap.String("fullPath", fullPath), zap.Error(err))
+			return
+		}
+
+		if u.deleteAfterUpload && !IsURL(fullPath) && !IsS3(fullPath) {
+			err = os.Remove(fullPath)
+			if err != nil {
+				u.logger.Error("delete file failed", zap.String("fullPath", fullPath), zap.Error(err))
+				return
+			}
+			u.logger.Info("deleted file", zap.String("fullPath", fullPath))
+		}
+	}()
 }
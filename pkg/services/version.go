@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"uploader/pkg/types"
+
+	"github.com/gofrs/uuid"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+// MinServerVersion is the oldest Teldrive release whose API matches what
+// the uploader expects: an upload session at /api/uploads/{id} answering
+// with its parts, and files created from the IDs of their parts along with
+// their channel and encryption flag.
+const MinServerVersion = "1.0.0"
+
+// ServerVersion returns the build information of the server, or nil if
+// it doesn't report it.
+func (u *UploadService) ServerVersion() (*types.ServerVersion, error) {
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/api/version",
+	}
+	var version types.ServerVersion
+	var resp *http.Response
+	err := u.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = u.http.CallJSON(u.ctx, &opts, nil, &version)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// CheckCompatibility returns what doesn't match the API expected by the
+// uploader on the server reporting version, nil if nothing. Besides
+// comparing the release, it reads an unknown upload session, which must
+// answer with an object holding its parts.
+func (u *UploadService) CheckCompatibility(version *types.ServerVersion) ([]string, error) {
+	var problems []string
+	switch {
+	case version == nil:
+		problems = append(problems, fmt.Sprintf("the server doesn't report its version, releases before %s may not match the upload and file APIs", MinServerVersion))
+	case compareVersions(version.Version, MinServerVersion) < 0:
+		problems = append(problems, fmt.Sprintf("server version %s is older than %s, uploads may be finalized with a payload it doesn't expect", version.Version, MinServerVersion))
+	}
+
+	id, _ := uuid.NewV4()
+	opts := rest.Opts{
+		Method: "GET",
+		Path:   "/api/uploads/" + hex.EncodeToString(id.Bytes()),
+	}
+	var session json.RawMessage
+	var resp *http.Response
+	err := u.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = u.http.CallJSON(u.ctx, &opts, nil, &session)
+		return shouldRetry(u.ctx, resp, err)
+	})
+	switch {
+	case err != nil && resp != nil && resp.StatusCode == http.StatusNotFound:
+		problems = append(problems, "the server has no upload sessions at /api/uploads/{id}")
+	case err != nil:
+		return nil, err
+	default:
+		var parts types.UploadFile
+		if json.Unmarshal(session, &parts) != nil {
+			problems = append(problems, "upload sessions at /api/uploads/{id} don't answer with their parts")
+		}
+	}
+	return problems, nil
+}
+
+// compareVersions compares two dotted release versions like v1.2.3,
+// ignoring pre-release and build suffixes; unknown versions are newest.
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	fields := strings.Split(version, ".")
+	if len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TransferWindow is a daily time range, which may cross midnight, during
+// which bytes are allowed to be transferred.
+type TransferWindow struct {
+	start time.Duration // since midnight
+	end   time.Duration // since midnight
+
+	mu     sync.Mutex
+	paused bool
+}
+
+// ParseTransferWindow parses a window in the HH:MM-HH:MM format, e.g. 23:00-07:00.
+func ParseTransferWindow(s string) (*TransferWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid transfer window %q, must be HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid transfer window %q, start and end are the same", s)
+	}
+	return &TransferWindow{start: start, end: end}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// Contains reports whether t falls inside the window.
+func (w *TransferWindow) Contains(t time.Time) bool {
+	d := sinceMidnight(t)
+	if w.start < w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// NextOpening returns the next time the window opens after t.
+func (w *TransferWindow) NextOpening(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	opening := midnight.Add(w.start)
+	if !opening.After(t) {
+		opening = opening.AddDate(0, 0, 1)
+	}
+	return opening
+}
+
+// Wait blocks until the window is open or ctx is done.
+func (w *TransferWindow) Wait(ctx context.Context, logger *zap.Logger) error {
+	for {
+		now := time.Now()
+		if w.Contains(now) {
+			w.setPaused(false, now, logger)
+			return nil
+		}
+		next := w.NextOpening(now)
+		w.setPaused(true, next, logger)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// setPaused logs the transitions between paused and running once, instead
+// of once per waiting worker.
+func (w *TransferWindow) setPaused(paused bool, at time.Time, logger *zap.Logger) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused == paused {
+		return
+	}
+	w.paused = paused
+	if paused {
+		logger.Info("outside transfer window, transfers paused", zap.Time("resumeAt", at))
+	} else {
+		logger.Info("inside transfer window, transfers resumed")
+	}
+}
+
+// WithTransferWindow only starts part uploads while the window is open.
+// Parts already being sent when the window closes are finished.
+func WithTransferWindow(w *TransferWindow) UploadOption {
+	return func(u *UploadService) {
+		u.window = w
+	}
+}
+
+// SetTransferWindow replaces the transfer window of a running upload, nil
+// to transfer at any time. Workers waiting for the old window to open check
+// the new one.
+func (u *UploadService) SetTransferWindow(w *TransferWindow) {
+	u.windowMu.Lock()
+	defer u.windowMu.Unlock()
+	u.window = w
+	if u.windowChanged != nil {
+		close(u.windowChanged)
+		u.windowChanged = nil
+	}
+}
+
+// waitForWindow blocks until transfers are allowed.
+func (u *UploadService) waitForWindow(ctx context.Context) error {
+	for {
+		u.windowMu.Lock()
+		w := u.window
+		if u.windowChanged == nil {
+			u.windowChanged = make(chan struct{})
+		}
+		changed := u.windowChanged
+		u.windowMu.Unlock()
+		if w == nil {
+			return nil
+		}
+
+		waitCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changed:
+				cancel()
+			case <-waitCtx.Done():
+			}
+		}()
+		err := w.Wait(waitCtx, u.logger)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+}
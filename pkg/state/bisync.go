@@ -0,0 +1,55 @@
+package state
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// BisyncEntry is a file as it was on both sides after the last bisync.
+type BisyncEntry struct {
+	Size         int64     `json:"size"`
+	LocalModTime time.Time `json:"localModTime"`
+	RemoteID     string    `json:"remoteId"`
+}
+
+// bisyncFile returns the name of the baseline of a local and remote pair.
+func bisyncFile(server, localDir, remoteDir string) string {
+	sum := md5.Sum([]byte(server + "\x00" + localDir + "\x00" + remoteDir))
+	return "bisync-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// LoadBisync returns the baseline of the last bisync of localDir with
+// remoteDir on server, keyed by the slash separated relative paths, or nil
+// if there was none.
+func LoadBisync(server, localDir, remoteDir string) (map[string]BisyncEntry, error) {
+	p, err := path(bisyncFile(server, localDir, remoteDir))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	baseline := map[string]BisyncEntry{}
+	return baseline, json.Unmarshal(data, &baseline)
+}
+
+// SaveBisync replaces the baseline of localDir and remoteDir on server.
+func SaveBisync(server, localDir, remoteDir string, baseline map[string]BisyncEntry) error {
+	p, err := path(bisyncFile(server, localDir, remoteDir))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
@@ -0,0 +1,80 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const usageFile = "usage.json"
+
+// usage is the number of bytes uploaded per day, keyed by YYYY-MM-DD.
+type usage map[string]int64
+
+var usageMu sync.Mutex
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+func readUsage() (usage, error) {
+	p, err := path(usageFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return usage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	u := usage{}
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// DailyUsage returns the number of bytes uploaded today.
+func DailyUsage() (int64, error) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	u, err := readUsage()
+	if err != nil {
+		return 0, err
+	}
+	return u[today()], nil
+}
+
+// AddDailyUsage adds n bytes to today's usage. Only the last week is kept.
+func AddDailyUsage(n int64) error {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	u, err := readUsage()
+	if err != nil {
+		return err
+	}
+	u[today()] += n
+
+	cutoff := time.Now().AddDate(0, 0, -7).Format("2006-01-02")
+	for day := range u {
+		if day < cutoff {
+			delete(u, day)
+		}
+	}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	p, err := path(usageFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
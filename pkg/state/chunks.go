@@ -0,0 +1,81 @@
+package state
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ChunkIndex is the set of chunks known to be stored in a deduplicated
+// backup repository, kept as an append-only file with one hash per line.
+type ChunkIndex struct {
+	mu     sync.Mutex
+	file   string
+	chunks map[string]bool
+}
+
+// LoadChunkIndex returns the index of the repository identified by repo,
+// e.g. the server URL and remote directory.
+func LoadChunkIndex(repo string) (*ChunkIndex, error) {
+	sum := md5.Sum([]byte(repo))
+	p, err := path("chunks-" + hex.EncodeToString(sum[:4]) + ".txt")
+	if err != nil {
+		return nil, err
+	}
+
+	index := &ChunkIndex{file: p, chunks: map[string]bool{}}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if hash := strings.TrimSpace(scanner.Text()); hash != "" {
+			index.chunks[hash] = true
+		}
+	}
+	return index, scanner.Err()
+}
+
+// Has reports whether the chunk is stored in the repository.
+func (c *ChunkIndex) Has(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chunks[hash]
+}
+
+// Len returns the number of chunks in the index.
+func (c *ChunkIndex) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.chunks)
+}
+
+// Add records a chunk stored in the repository.
+func (c *ChunkIndex) Add(hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chunks[hash] {
+		return nil
+	}
+
+	f, err := os.OpenFile(c.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(hash + "\n"); err != nil {
+		return err
+	}
+	c.chunks[hash] = true
+	return nil
+}
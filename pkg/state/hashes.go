@@ -0,0 +1,111 @@
+package state
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HashIndex maps the remote paths of uploaded files to the hash of their
+// content, kept as an append-only file with one "hash path" entry per line
+// where later entries win. A hash is the hex sum prefixed by its algorithm
+// and a colon, e.g. "xxh3:…", or unprefixed for SHA-256.
+type HashIndex struct {
+	mu     sync.Mutex
+	file   string
+	hashes map[string]string
+	// paths maps the hashes back to the remote paths of the files, so the
+	// renamed files are found without scanning every entry
+	paths map[string]map[string]bool
+}
+
+// LoadHashIndex returns the index of the files uploaded to server, e.g. its
+// API URL.
+func LoadHashIndex(server string) (*HashIndex, error) {
+	sum := md5.Sum([]byte(server))
+	p, err := path("hashes-" + hex.EncodeToString(sum[:4]) + ".txt")
+	if err != nil {
+		return nil, err
+	}
+
+	index := &HashIndex{file: p, hashes: map[string]string{}, paths: map[string]map[string]bool{}}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, remotePath, ok := strings.Cut(scanner.Text(), " ")
+		if ok && remotePath != "" {
+			index.set(remotePath, hash)
+		}
+	}
+	return index, scanner.Err()
+}
+
+// Get returns the hash of the file uploaded at remotePath, or "" if unknown.
+func (h *HashIndex) Get(remotePath string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hashes[remotePath]
+}
+
+// Find returns the remote paths in dir of the files with the given hash.
+func (h *HashIndex) Find(hash string, dir string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var paths []string
+	for remotePath := range h.paths[hash] {
+		if strings.HasPrefix(remotePath, prefix) && !strings.Contains(remotePath[len(prefix):], "/") {
+			paths = append(paths, remotePath)
+		}
+	}
+	return paths
+}
+
+// Set records the hash of the file uploaded at remotePath.
+func (h *HashIndex) Set(remotePath string, hash string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hashes[remotePath] == hash {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %s\n", hash, remotePath); err != nil {
+		return err
+	}
+	h.set(remotePath, hash)
+	return nil
+}
+
+// set records the hash of remotePath in both maps, dropping its previous
+// hash.
+func (h *HashIndex) set(remotePath string, hash string) {
+	if old, ok := h.hashes[remotePath]; ok {
+		delete(h.paths[old], remotePath)
+		if len(h.paths[old]) == 0 {
+			delete(h.paths, old)
+		}
+	}
+	h.hashes[remotePath] = hash
+	if h.paths[hash] == nil {
+		h.paths[hash] = map[string]bool{}
+	}
+	h.paths[hash][remotePath] = true
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Transfer results recorded in the history.
+const (
+	ResultUploaded = "uploaded"
+	ResultSkipped  = "skipped"
+	ResultFailed   = "failed"
+)
+
+// Transfer is a history record of a single file transfer.
+type Transfer struct {
+	Time     time.Time `json:"time"`
+	RunID    string    `json:"runId"`
+	Path     string    `json:"path"`
+	Dest     string    `json:"dest"`
+	Size     int64     `json:"size"`
+	Duration float64   `json:"duration"` // seconds
+	Speed    float64   `json:"speed"`    // bytes per second
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// History is an append only log of transfers stored as JSON lines.
+type History struct {
+	mu    sync.Mutex
+	RunID string
+}
+
+const historyFile = "history.jsonl"
+
+// NewHistory returns the history, tagging new records with runID.
+func NewHistory(runID string) *History {
+	return &History{RunID: runID}
+}
+
+// Record appends a transfer to the history.
+func (h *History) Record(t Transfer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t.RunID == "" {
+		t.RunID = h.RunID
+	}
+	if t.Time.IsZero() {
+		t.Time = time.Now()
+	}
+
+	p, err := path(historyFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(t)
+}
+
+// ReadHistory returns the recorded transfers accepted by filter, oldest first.
+// A nil filter accepts every transfer.
+func ReadHistory(filter func(Transfer) bool) ([]Transfer, error) {
+	p, err := path(historyFile)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var transfers []Transfer
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var t Transfer
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			continue
+		}
+		if filter == nil || filter(t) {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, scanner.Err()
+}
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"time"
+)
+
+// Scopes of the lock taken by runs.
+const (
+	// LockDest keeps runs uploading to the same destination from running
+	// at the same time.
+	LockDest = "dest"
+	// LockGlobal keeps any two runs from running at the same time.
+	LockGlobal = "global"
+)
+
+// lockPoll is how often a waiting run tries to take the lock again.
+const lockPoll = 500 * time.Millisecond
+
+// RunLock is the lock held by a run, released by the system if the run
+// dies.
+type RunLock struct {
+	files []*os.File
+}
+
+// LockRun takes the lock of destDir on server, or of every destination
+// when destDir is empty, waiting while other runs hold it. waiting is
+// called once if it has to wait. Runs locking a destination share the
+// global lock, so they also wait for a run locking every destination.
+func LockRun(ctx context.Context, server string, destDir string, waiting func()) (*RunLock, error) {
+	global, err := path("run.lock")
+	if err != nil {
+		return nil, err
+	}
+	var dest string
+	if destDir != "" {
+		sum := md5.Sum([]byte(server + "\x00" + destDir))
+		if dest, err = path("run-" + hex.EncodeToString(sum[:4]) + ".lock"); err != nil {
+			return nil, err
+		}
+	}
+
+	waited := false
+	for {
+		lock, err := tryLockRun(global, dest)
+		if lock != nil || err != nil {
+			return lock, err
+		}
+		if !waited && waiting != nil {
+			waiting()
+		}
+		waited = true
+		select {
+		case <-time.After(lockPoll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryLockRun takes the global lock, exclusively without dest, and the lock
+// of dest. It returns nil if another run holds either.
+func tryLockRun(global string, dest string) (*RunLock, error) {
+	lock := &RunLock{}
+	ok, err := lock.take(global, dest == "")
+	if !ok || err != nil || dest == "" {
+		return lockOrNil(lock, ok, err)
+	}
+	ok, err = lock.take(dest, true)
+	return lockOrNil(lock, ok, err)
+}
+
+func lockOrNil(lock *RunLock, ok bool, err error) (*RunLock, error) {
+	if !ok || err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (l *RunLock) take(name string, exclusive bool) (bool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return false, err
+	}
+	ok, err := lockFile(f, exclusive)
+	if !ok || err != nil {
+		f.Close()
+		return false, err
+	}
+	l.files = append(l.files, f)
+	return true, nil
+}
+
+// Unlock releases the lock.
+func (l *RunLock) Unlock() {
+	for i := len(l.files) - 1; i >= 0; i-- {
+		unlockFile(l.files[i])
+		l.files[i].Close()
+	}
+	l.files = nil
+}
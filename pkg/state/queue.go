@@ -0,0 +1,63 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+const queueFile = "queue.json"
+
+// QueuedFile is a file left to upload by an interrupted run.
+type QueuedFile struct {
+	Path string `json:"path"`
+	Dest string `json:"dest"`
+	// Error is why the file is queued: the quota, or the error it failed
+	// with in a resumed run.
+	Error string `json:"error,omitempty"`
+}
+
+// SaveQueue persists the files left to upload, replacing any previous queue.
+func SaveQueue(files []QueuedFile) error {
+	p, err := path(queueFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+// LoadQueue returns the persisted queue, if any.
+func LoadQueue() ([]QueuedFile, error) {
+	p, err := path(queueFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []QueuedFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ClearQueue removes the persisted queue.
+func ClearQueue() error {
+	p, err := path(queueFile)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is an upload session started on the server, which keeps its parts
+// until the file is created or the session is deleted.
+type Session struct {
+	Hash string
+	Path string
+	// Size is -1 for streams of unknown size.
+	Size    int64
+	Started time.Time
+}
+
+// SessionIndex remembers the upload sessions started on a server and not
+// finished yet, as the API can't list them. It is kept as a file with one
+// "hash size started path" entry per line.
+type SessionIndex struct {
+	mu       sync.Mutex
+	file     string
+	sessions map[string]Session
+}
+
+// LoadSessionIndex returns the sessions started on server, e.g. its API URL.
+func LoadSessionIndex(server string) (*SessionIndex, error) {
+	sum := md5.Sum([]byte(server))
+	p, err := path("sessions-" + hex.EncodeToString(sum[:4]) + ".txt")
+	if err != nil {
+		return nil, err
+	}
+
+	index := &SessionIndex{file: p, sessions: map[string]Session{}}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		started, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		index.sessions[fields[0]] = Session{Hash: fields[0], Size: size, Started: time.Unix(started, 0), Path: fields[3]}
+	}
+	return index, scanner.Err()
+}
+
+// List returns the sessions, oldest first.
+func (s *SessionIndex) List() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Started.Before(sessions[j].Started)
+	})
+	return sessions
+}
+
+// Add records a started session, unless it is known already.
+func (s *SessionIndex) Add(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[session.Hash]; ok {
+		return nil
+	}
+	s.sessions[session.Hash] = session
+	return s.save()
+}
+
+// Remove forgets a finished or deleted session.
+func (s *SessionIndex) Remove(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[hash]; !ok {
+		return nil
+	}
+	delete(s.sessions, hash)
+	return s.save()
+}
+
+func (s *SessionIndex) save() error {
+	var b strings.Builder
+	for _, session := range s.sessions {
+		fmt.Fprintf(&b, "%s %d %d %s\n", session.Hash, session.Size, session.Started.Unix(), session.Path)
+	}
+	return os.WriteFile(s.file, []byte(b.String()), 0o644)
+}
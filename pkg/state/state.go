@@ -0,0 +1,34 @@
+// Package state stores the local state of the uploader between runs.
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Dir is the directory holding the local state, relative to the working
+// directory like the logs directory.
+var Dir = "state"
+
+// path returns the location of a state file, creating the state directory
+// if needed.
+func path(name string) (string, error) {
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return "", err
+	}
+	return filepath.Join(Dir, name), nil
+}
+
+// NewRunID returns the identifier attached to every log entry and report of
+// a run.
+func NewRunID() string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return id.String()
+}
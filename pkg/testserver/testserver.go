@@ -0,0 +1,533 @@
+// Package testserver is an in-memory Teldrive server with the upload, file
+// and folder endpoints the uploader uses, and faults injected on purpose, so
+// resuming, retries and conflicts can be tested end to end without
+// Telegram.
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"uploader/pkg/types"
+
+	"github.com/gofrs/uuid"
+)
+
+// Version is the Teldrive release the server reports.
+const Version = "1.0.0"
+
+// ChannelID is the channel of the user the parts are stored in.
+const ChannelID = 1
+
+// Faults are the chances, from 0 to 1, of answering a request with an error
+// instead of serving it.
+type Faults struct {
+	// Conflict answers file creations with 409 Conflict, as if the name
+	// were taken.
+	Conflict float64
+	// RateLimit answers requests with 429 Too Many Requests and a
+	// Retry-After of a second.
+	RateLimit float64
+	// ServerError answers requests with 500 Internal Server Error.
+	ServerError float64
+	// Seed makes the faults repeat from run to run, unless 0.
+	Seed int64
+}
+
+// node is a file or folder.
+type node struct {
+	types.FileMetadata
+	children map[string]*node
+}
+
+// Server is the in-memory Teldrive server. Its zero value isn't usable,
+// create it with New.
+type Server struct {
+	// Token is the session token the requests must send, any when empty.
+	Token string
+
+	mu       sync.Mutex
+	faults   Faults
+	rand     *rand.Rand
+	root     *node
+	nodes    map[string]*node
+	sessions map[string][]types.PartFile
+	parts    map[int][]byte
+	lastPart int
+	requests int
+	injected map[int]int
+}
+
+// New returns an empty server injecting faults.
+func New(faults Faults) *Server {
+	seed := faults.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	root := &node{
+		FileMetadata: types.FileMetadata{Id: "root", Name: "root", Type: "folder", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		children:     map[string]*node{},
+	}
+	return &Server{
+		faults:   faults,
+		rand:     rand.New(rand.NewSource(seed)),
+		root:     root,
+		nodes:    map[string]*node{root.Id: root},
+		sessions: map[string][]types.PartFile{},
+		parts:    map[int][]byte{},
+		injected: map[int]int{},
+	}
+}
+
+// Start serves s on a local port until the returned function is called, for
+// tests. The URL is the API_URL of the server.
+func (s *Server) Start() (url string, stop func()) {
+	srv := httptest.NewServer(s)
+	return srv.URL, srv.Close
+}
+
+// Requests returns the number of requests served, faults included.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Injected returns the number of faults injected by status code.
+func (s *Server) Injected() map[int]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	injected := make(map[int]int, len(s.injected))
+	for status, n := range s.injected {
+		injected[status] = n
+	}
+	return injected
+}
+
+// Content returns the data of the file at filePath, its parts joined in
+// order, and whether it exists.
+func (s *Server) Content(filePath string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file := s.lookup(filePath)
+	if file == nil || file.Type != "file" {
+		return nil, false
+	}
+	return s.content(file), true
+}
+
+// Paths returns the paths of all the files and folders, sorted.
+func (s *Server) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	var walk func(dir string, n *node)
+	walk = func(dir string, n *node) {
+		for name, child := range n.children {
+			p := path.Join(dir, name)
+			paths = append(paths, p)
+			walk(p, child)
+		}
+	}
+	walk("/", s.root)
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the body is read before locking, so parts are received concurrently
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if r.URL.Path == "/api/version" {
+		writeJSON(w, http.StatusOK, types.ServerVersion{Version: Version, GoVersion: runtime.Version(), Os: runtime.GOOS, Arch: runtime.GOARCH})
+		return
+	}
+	if s.Token != "" && token(r) != s.Token {
+		writeError(w, http.StatusUnauthorized, "invalid session token")
+		return
+	}
+	if s.inject(w, r) {
+		return
+	}
+
+	p := r.URL.Path
+	switch {
+	case r.Method == "GET" && p == "/api/users/channels":
+		writeJSON(w, http.StatusOK, []types.Channel{{ChannelID: ChannelID, ChannelName: "test"}})
+	case strings.HasPrefix(p, "/api/uploads/"):
+		s.serveUpload(w, r, strings.TrimPrefix(p, "/api/uploads/"))
+	case r.Method == "GET" && p == "/api/files":
+		s.serveList(w, r)
+	case r.Method == "POST" && p == "/api/files":
+		s.serveCreate(w, r)
+	case r.Method == "POST" && p == "/api/files/directories":
+		s.serveMkdir(w, r)
+	case r.Method == "POST" && p == "/api/files/delete":
+		s.serveDelete(w, r)
+	case strings.HasPrefix(p, "/api/files/"):
+		s.serveFile(w, r, strings.TrimPrefix(p, "/api/files/"))
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// token returns the session token of r, sent in a cookie or as a bearer
+// token.
+func token(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return bearer
+	}
+	for _, name := range []string{"access_token", "user-session"} {
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// inject answers r with a fault by the chances of the faults, reporting
+// whether it did.
+func (s *Server) inject(w http.ResponseWriter, r *http.Request) bool {
+	status := 0
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/api/files" && s.rand.Float64() < s.faults.Conflict:
+		status = http.StatusConflict
+	case s.rand.Float64() < s.faults.RateLimit:
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", "1")
+	case s.rand.Float64() < s.faults.ServerError:
+		status = http.StatusInternalServerError
+	default:
+		return false
+	}
+	s.injected[status]++
+	writeError(w, status, "injected fault")
+	return true
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, types.UploadFile{Parts: s.sessions[id]})
+	case "DELETE":
+		s.release(s.sessions[id])
+		delete(s.sessions, id)
+		w.WriteHeader(http.StatusOK)
+	case "POST":
+		var data bytes.Buffer
+		if _, err := data.ReadFrom(r.Body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q := r.URL.Query()
+		partNo, err := strconv.Atoi(q.Get("partNo"))
+		if err != nil || partNo < 1 {
+			writeError(w, http.StatusBadRequest, "invalid partNo")
+			return
+		}
+		channelID, _ := strconv.ParseInt(q.Get("channelId"), 10, 64)
+		if channelID == 0 {
+			channelID = ChannelID
+		}
+		s.lastPart++
+		s.parts[s.lastPart] = data.Bytes()
+		part := types.PartFile{
+			Name:      q.Get("partName"),
+			PartId:    s.lastPart,
+			PartNo:    partNo,
+			Size:      int64(data.Len()),
+			ChannelID: channelID,
+			Encrypted: q.Get("encrypted") == "true",
+		}
+		// a part sent again replaces the earlier one
+		var replaced []types.PartFile
+		parts := s.sessions[id][:0]
+		for _, p := range s.sessions[id] {
+			if p.PartNo != partNo {
+				parts = append(parts, p)
+			} else {
+				replaced = append(replaced, p)
+			}
+		}
+		s.release(replaced)
+		s.sessions[id] = append(parts, part)
+		writeJSON(w, http.StatusCreated, part)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dir := s.lookup(q.Get("path"))
+	find := q.Get("op") == "find"
+	if dir == nil || dir.Type != "folder" {
+		if find {
+			writeJSON(w, http.StatusOK, types.ReadMetadataResponse{})
+		} else {
+			writeError(w, http.StatusNotFound, "folder not found")
+		}
+		return
+	}
+
+	var files []types.FileInfo
+	for name, child := range dir.children {
+		if !find || name == q.Get("name") {
+			files = append(files, fileInfo(child))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	perPage, err := strconv.Atoi(q.Get("perPage"))
+	if err != nil || perPage < 1 {
+		perPage = 500
+	}
+	start, _ := strconv.Atoi(q.Get("nextPageToken"))
+	start = min(max(start, 0), len(files))
+	res := types.ReadMetadataResponse{Files: files[start:min(start+perPage, len(files))]}
+	if start+perPage < len(files) {
+		res.NextPageToken = strconv.Itoa(start + perPage)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) serveCreate(w http.ResponseWriter, r *http.Request) {
+	var payload types.FilePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid file")
+		return
+	}
+	for _, part := range payload.Parts {
+		if _, ok := s.parts[int(part.ID)]; !ok {
+			writeError(w, http.StatusBadRequest, "unknown part "+strconv.FormatInt(part.ID, 10))
+			return
+		}
+	}
+	parent, status := s.mkdir(payload.Path)
+	if parent == nil {
+		writeError(w, status, "parent folder can't be created")
+		return
+	}
+	if _, taken := parent.children[payload.Name]; taken {
+		writeError(w, http.StatusConflict, "file exists")
+		return
+	}
+	if payload.Type == "" {
+		payload.Type = "file"
+	}
+	channelID := payload.ChannelID
+	if channelID == 0 {
+		channelID = ChannelID
+	}
+	file := s.add(parent, types.FileMetadata{
+		Name:      payload.Name,
+		Type:      payload.Type,
+		MimeType:  payload.MimeType,
+		Size:      payload.Size,
+		ChannelID: channelID,
+		Encrypted: payload.Encrypted,
+		Parts:     payload.Parts,
+	})
+	writeJSON(w, http.StatusOK, fileInfo(file))
+}
+
+func (s *Server) serveMkdir(w http.ResponseWriter, r *http.Request) {
+	var mkdir types.CreateDirRequest
+	if err := json.NewDecoder(r.Body).Decode(&mkdir); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid folder")
+		return
+	}
+	if dir, status := s.mkdir(mkdir.Path); dir == nil {
+		writeError(w, status, "folder can't be created")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) serveDelete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Files []string `json:"files"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid files")
+		return
+	}
+	for _, id := range req.Files {
+		if n, ok := s.nodes[id]; ok && n != s.root {
+			s.remove(n)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveFile serves /api/files/{id}: the metadata of the file and its
+// renames, or its content at /api/files/{id}/{name}.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, rest string) {
+	id, name, download := strings.Cut(rest, "/")
+	file, ok := s.nodes[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	switch {
+	case download && r.Method == "GET":
+		if file.Type != "file" {
+			writeError(w, http.StatusBadRequest, "not a file")
+			return
+		}
+		http.ServeContent(w, r, name, file.UpdatedAt, bytes.NewReader(s.content(file)))
+	case r.Method == "GET":
+		writeJSON(w, http.StatusOK, file.FileMetadata)
+	case r.Method == "PATCH":
+		var update struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil || update.Name == "" {
+			writeError(w, http.StatusBadRequest, "invalid name")
+			return
+		}
+		parent := s.nodes[file.ParentId]
+		if _, taken := parent.children[update.Name]; taken && update.Name != file.Name {
+			writeError(w, http.StatusConflict, "file exists")
+			return
+		}
+		delete(parent.children, file.Name)
+		file.Name = update.Name
+		file.UpdatedAt = time.Now()
+		parent.children[file.Name] = file
+		writeJSON(w, http.StatusOK, fileInfo(file))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// lookup returns the file or folder at p, or nil.
+func (s *Server) lookup(p string) *node {
+	n := s.root
+	for _, name := range strings.Split(path.Clean("/"+p), "/") {
+		if name == "" {
+			continue
+		}
+		if n = n.children[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// mkdir creates the folder p and the missing ones above it, returning it,
+// or nil and the status to answer with when a file is in the way.
+func (s *Server) mkdir(p string) (*node, int) {
+	n := s.root
+	for _, name := range strings.Split(path.Clean("/"+p), "/") {
+		if name == "" {
+			continue
+		}
+		child := n.children[name]
+		if child == nil {
+			child = s.add(n, types.FileMetadata{Name: name, Type: "folder"})
+		}
+		if child.Type != "folder" {
+			return nil, http.StatusConflict
+		}
+		n = child
+	}
+	return n, http.StatusOK
+}
+
+// add creates a file or folder of meta in parent.
+func (s *Server) add(parent *node, meta types.FileMetadata) *node {
+	id, _ := uuid.NewV4()
+	meta.Id = id.String()
+	meta.ParentId = parent.Id
+	meta.CreatedAt = time.Now()
+	meta.UpdatedAt = meta.CreatedAt
+	n := &node{FileMetadata: meta}
+	if meta.Type == "folder" {
+		n.children = map[string]*node{}
+	}
+	parent.children[meta.Name] = n
+	s.nodes[n.Id] = n
+	return n
+}
+
+// remove deletes n, with everything below a folder.
+func (s *Server) remove(n *node) {
+	for _, child := range n.children {
+		s.remove(child)
+	}
+	if parent, ok := s.nodes[n.ParentId]; ok {
+		delete(parent.children, n.Name)
+	}
+	delete(s.nodes, n.Id)
+}
+
+// release frees the data of parts, unless a file was created from them.
+func (s *Server) release(parts []types.PartFile) {
+	if len(parts) == 0 {
+		return
+	}
+	used := map[int64]bool{}
+	for _, n := range s.nodes {
+		for _, part := range n.Parts {
+			used[part.ID] = true
+		}
+	}
+	for _, part := range parts {
+		if !used[int64(part.PartId)] {
+			delete(s.parts, part.PartId)
+		}
+	}
+}
+
+// content returns the data of the parts of file in order.
+func (s *Server) content(file *node) []byte {
+	parts := append([]types.FilePart(nil), file.Parts...)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNo < parts[j].PartNo })
+	var data []byte
+	for _, part := range parts {
+		data = append(data, s.parts[int(part.ID)]...)
+	}
+	return data
+}
+
+func fileInfo(n *node) types.FileInfo {
+	return types.FileInfo{
+		Id:       n.Id,
+		Name:     n.Name,
+		MimeType: n.MimeType,
+		Size:     n.Size,
+		ParentId: n.ParentId,
+		Type:     n.Type,
+		ModTime:  n.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
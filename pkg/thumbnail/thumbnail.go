@@ -0,0 +1,118 @@
+// Package thumbnail creates JPEG previews of images and videos.
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// MaxSize is the maximum width and height of a thumbnail.
+const MaxSize = 320
+
+// FFmpegCommand is the executable used to grab a frame of videos.
+const FFmpegCommand = "ffmpeg"
+
+// ErrUnsupported is returned for files no thumbnail can be created for.
+var ErrUnsupported = errors.New("thumbnail: unsupported file type")
+
+// Create returns a JPEG thumbnail of the image or video at filePath.
+// Videos need ffmpeg installed.
+func Create(ctx context.Context, filePath string, mimeType string) ([]byte, error) {
+	switch {
+	case mimeType == "image/jpeg", mimeType == "image/png", mimeType == "image/gif":
+		return fromImage(filePath)
+	case strings.HasPrefix(mimeType, "video/"):
+		if _, err := exec.LookPath(FFmpegCommand); err != nil {
+			return nil, ErrUnsupported
+		}
+		// a few seconds in, past black intros, unless the video is shorter
+		thumb, err := fromVideo(ctx, filePath, "3")
+		if err != nil || len(thumb) == 0 {
+			thumb, err = fromVideo(ctx, filePath, "0")
+		}
+		return thumb, err
+	}
+	return nil, ErrUnsupported
+}
+
+func fromImage(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(img, MaxSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func fromVideo(ctx context.Context, filePath string, seek string) ([]byte, error) {
+	size := strconv.Itoa(MaxSize)
+	cmd := exec.CommandContext(ctx, FFmpegCommand, "-v", "error",
+		"-ss", seek, "-i", filePath, "-frames:v", "1",
+		"-vf", "scale='min("+size+",iw)':'min("+size+",ih)':force_original_aspect_ratio=decrease",
+		"-f", "image2pipe", "-vcodec", "mjpeg", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("ffmpeg: " + strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// scale shrinks img to fit in a max x max square, averaging the pixels
+// covered by every thumbnail pixel.
+func scale(img image.Image, max int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	tw, th := max, h*max/w
+	if h > w {
+		tw, th = w*max/h, max
+	}
+	if tw == 0 {
+		tw = 1
+	}
+	if th == 0 {
+		th = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := bounds.Min.Y+ty*h/th, bounds.Min.Y+(ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := bounds.Min.X+tx*w/tw, bounds.Min.X+(tx+1)*w/tw
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := img.At(x, y).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			thumb.Set(tx, ty, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return thumb
+}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DumpFlags selects what the dump transport logs.
+type DumpFlags int
+
+const (
+	// DumpHeaders logs request and response headers
+	DumpHeaders DumpFlags = 1 << iota
+	// DumpBodies logs request and response bodies as well as headers
+	DumpBodies
+	// DumpAuth logs the session cookie and authorization headers unredacted
+	DumpAuth
+)
+
+// maxDumpBody is the largest body that is logged when dumping bodies,
+// bigger ones (e.g. file parts) are replaced by their length.
+const maxDumpBody = 64 * 1024
+
+// ParseDumpFlags parses a comma separated list of headers, bodies and auth.
+func ParseDumpFlags(s string) (DumpFlags, error) {
+	var flags DumpFlags
+	for _, f := range strings.Split(s, ",") {
+		switch strings.TrimSpace(strings.ToLower(f)) {
+		case "":
+		case "headers":
+			flags |= DumpHeaders
+		case "bodies":
+			flags |= DumpHeaders | DumpBodies
+		case "auth":
+			flags |= DumpHeaders | DumpAuth
+		default:
+			return 0, fmt.Errorf("unknown dump flag %q, must be headers, bodies or auth", f)
+		}
+	}
+	return flags, nil
+}
+
+type dumpTransport struct {
+	base   http.RoundTripper
+	flags  DumpFlags
+	logger *zap.Logger
+}
+
+// NewDumpTransport wraps base and logs every request and response according to flags.
+func NewDumpTransport(base http.RoundTripper, flags DumpFlags, logger *zap.Logger) http.RoundTripper {
+	return &dumpTransport{base: base, flags: flags, logger: logger}
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dumpBody := t.flags&DumpBodies != 0 && req.ContentLength >= 0 && req.ContentLength <= maxDumpBody
+	dump, err := httputil.DumpRequestOut(req, dumpBody)
+	if err != nil {
+		t.logger.Error("dump request failed", zap.Error(err))
+	} else {
+		if t.flags&DumpBodies != 0 && !dumpBody {
+			dump = append(dump, omittedBody(req.ContentLength)...)
+		}
+		t.logger.Info("http request", zap.String("method", req.Method), zap.String("url", req.URL.String()), zap.String("dump", t.redact(dump)))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.logger.Info("http response", zap.String("method", req.Method), zap.String("url", req.URL.String()), zap.Duration("duration", time.Since(start)), zap.Error(err))
+		return resp, err
+	}
+
+	// streamed bodies of unknown length would be read whole into memory
+	dumpBody = t.flags&DumpBodies != 0 && resp.ContentLength >= 0 && resp.ContentLength <= maxDumpBody
+	dump, err = httputil.DumpResponse(resp, dumpBody)
+	if err != nil {
+		t.logger.Error("dump response failed", zap.Error(err))
+		return resp, nil
+	}
+	if t.flags&DumpBodies != 0 && !dumpBody {
+		dump = append(dump, omittedBody(resp.ContentLength)...)
+	}
+	t.logger.Info("http response", zap.String("method", req.Method), zap.String("url", req.URL.String()), zap.Int("status", resp.StatusCode), zap.Duration("duration", time.Since(start)), zap.String("dump", t.redact(dump)))
+
+	return resp, nil
+}
+
+// omittedBody is the placeholder of a body too big, or of unknown length,
+// to dump.
+func omittedBody(length int64) string {
+	if length < 0 {
+		return "<body of unknown length omitted>"
+	}
+	return fmt.Sprintf("<%d bytes body omitted>", length)
+}
+
+var sensitiveHeaders = regexp.MustCompile(`(?mi)^((?:Cookie|Set-Cookie|Authorization):\s*).*$`)
+
+// redact hides credentials unless auth dumping was requested.
+func (t *dumpTransport) redact(dump []byte) string {
+	if t.flags&DumpAuth == 0 {
+		dump = sensitiveHeaders.ReplaceAll(dump, []byte("${1}XXXX"))
+	}
+	return string(bytes.TrimRight(dump, "\r\n"))
+}
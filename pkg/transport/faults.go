@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs/fserrors"
+	"go.uber.org/zap"
+)
+
+// Faults are the failures of a flaky network the fault transport simulates,
+// to see retries, resuming and cleanup at work.
+type Faults struct {
+	// FailPartEvery fails every Nth part upload before it's sent, 0 for
+	// none
+	FailPartEvery int
+	// Latency delays every request
+	Latency time.Duration
+}
+
+type faultTransport struct {
+	base   http.RoundTripper
+	faults Faults
+	logger *zap.Logger
+	parts  atomic.Int64
+}
+
+// NewFaultTransport wraps base and makes its requests fail or slow down
+// according to faults.
+func NewFaultTransport(base http.RoundTripper, faults Faults, logger *zap.Logger) http.RoundTripper {
+	return &faultTransport{base: base, faults: faults, logger: logger}
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.faults.Latency > 0 {
+		timer := time.NewTimer(t.faults.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+
+	if t.faults.FailPartEvery > 0 && isPartUpload(req) {
+		if n := t.parts.Add(1); n%int64(t.faults.FailPartEvery) == 0 {
+			closeBody(req)
+			t.logger.Warn("injected part upload failure", zap.String("url", req.URL.String()), zap.Int64("part", n))
+			// retriable like the connection resets it stands for
+			return nil, fserrors.RetryErrorf("injected failure of part upload %d", n)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// isPartUpload reports whether req sends a part to an upload session, at
+// /api/uploads/{id} or the /api/upload/{id} of older servers.
+func isPartUpload(req *http.Request) bool {
+	return req.Method == http.MethodPost && (strings.Contains(req.URL.Path, "/api/uploads/") || strings.Contains(req.URL.Path, "/api/upload/"))
+}
+
+// closeBody closes the body of a request that isn't sent, as RoundTrip
+// must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
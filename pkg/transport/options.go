@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP versions of Options.HTTPVersion.
+const (
+	// HTTPAuto negotiates HTTP/2 over TLS and uses HTTP/1.1 otherwise
+	HTTPAuto = ""
+	// HTTP1 always uses HTTP/1.1
+	HTTP1 = "1.1"
+	// HTTP2 always uses HTTP/2, in clear text for http:// servers
+	HTTP2 = "2"
+)
+
+// ValidHTTPVersion reports whether version is a known HTTP version.
+func ValidHTTPVersion(version string) bool {
+	return version == HTTPAuto || version == HTTP1 || version == HTTP2
+}
+
+// Options tunes the connections to the Teldrive server, for reverse proxies
+// handling the default request style poorly.
+type Options struct {
+	// ExpectContinue sends the Expect: 100-continue header with requests
+	// that have a body, so a rejected part isn't sent in full
+	ExpectContinue bool
+	// NoChunked sends a Content-Length with every request instead of using
+	// chunked transfer encoding for bodies of unknown length
+	NoChunked bool
+	// KeepAlive is the TCP keep-alive period, negative to disable
+	KeepAlive time.Duration
+	// MaxIdleConns is the maximum number of idle connections, 0 for no limit
+	MaxIdleConns int
+	// IdleConnTimeout closes connections idle for longer, 0 for no limit
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is the maximum number of idle connections to the
+	// server, 0 for the Go default of 2
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the connections to the server, 0 for no limit
+	MaxConnsPerHost int
+	// HTTPVersion forces HTTP/1.1 or HTTP/2, see HTTPAuto
+	HTTPVersion string
+}
+
+// New returns the transport for the Teldrive API configured by opts.
+func New(opts Options) http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: opts.KeepAlive}
+	t.DialContext = dialer.DialContext
+	t.MaxIdleConns = opts.MaxIdleConns
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = opts.MaxConnsPerHost
+
+	var base http.RoundTripper = t
+	switch opts.HTTPVersion {
+	case HTTP1:
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case HTTP2:
+		base = newHTTP2Transport(dialer)
+	}
+	if !opts.ExpectContinue && !opts.NoChunked {
+		return base
+	}
+	return &requestTransport{base: base, opts: opts}
+}
+
+// http2Transport sends every request with HTTP/2, over TLS or in clear text
+// (h2c) depending on the scheme. HTTP/2 multiplexes the requests over a
+// single connection, so the connection limits don't apply.
+type http2Transport struct {
+	tls, clear *http2.Transport
+}
+
+func newHTTP2Transport(dialer *net.Dialer) *http2Transport {
+	return &http2Transport{
+		tls: &http2.Transport{},
+		clear: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.clear.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+// requestTransport adjusts the requests according to the options.
+type requestTransport struct {
+	base http.RoundTripper
+	opts Options
+}
+
+func (t *requestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if t.opts.NoChunked && req.ContentLength <= 0 {
+		// only the small JSON bodies of the API have an unknown length
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = int64(len(body))
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if t.opts.ExpectContinue {
+		req.Header.Set("Expect", "100-continue")
+	}
+	return t.base.RoundTrip(req)
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type PartFile struct {
 	Name      string `json:"name"`
 	PartId    int    `json:"partId"`
@@ -21,14 +23,23 @@ type UploadFile struct {
 }
 
 type FilePayload struct {
-	Name      string     `json:"name"`
-	Type      string     `json:"type"`
-	Parts     []FilePart `json:"parts,omitempty"`
-	MimeType  string     `json:"mimeType"`
-	Path      string     `json:"path"`
-	Size      int64      `json:"size"`
-	ChannelID int64      `json:"channelId"`
-	Encrypted bool       `json:"encrypted"`
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Parts     []FilePart     `json:"parts,omitempty"`
+	MimeType  string         `json:"mimeType"`
+	Path      string         `json:"path"`
+	Size      int64          `json:"size"`
+	ChannelID int64          `json:"channelId"`
+	Encrypted bool           `json:"encrypted"`
+	Metadata  *VideoMetadata `json:"metadata,omitempty"`
+}
+
+// VideoMetadata describes the main video stream of a file
+type VideoMetadata struct {
+	Duration float64 `json:"duration"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Codec    string  `json:"codec"`
 }
 
 type CreateDirRequest struct {
@@ -58,3 +69,46 @@ type ReadMetadataResponse struct {
 	Files         []FileInfo `json:"results"`
 	NextPageToken string     `json:"nextPageToken,omitempty"`
 }
+
+// ShareRequest creates a public share link of a file or folder
+type ShareRequest struct {
+	Password  string     `json:"password,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Share is the public share link of a file or folder
+type Share struct {
+	Id        string     `json:"id"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Protected bool       `json:"protected"`
+}
+
+// FileMetadata is the full metadata of a file
+type FileMetadata struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	MimeType  string     `json:"mimeType"`
+	Size      int64      `json:"size"`
+	ParentId  string     `json:"parentId"`
+	ChannelID int64      `json:"channelId"`
+	Encrypted bool       `json:"encrypted"`
+	Parts     []FilePart `json:"parts"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// ServerVersion is the build information of a Teldrive server
+type ServerVersion struct {
+	Version   string `json:"version"`
+	CommitSHA string `json:"commitSHA"`
+	GoVersion string `json:"goVersion"`
+	Os        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// Channel is a Telegram channel of the user
+type Channel struct {
+	ChannelID   int64  `json:"channelId"`
+	ChannelName string `json:"channelName"`
+}